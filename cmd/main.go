@@ -19,6 +19,9 @@ import (
 	"flag"
 	"log"
 
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+	"github.com/wentaojin/dmgr/pkg/cluster/operation"
+	"github.com/wentaojin/dmgr/pkg/cluster/task"
 	"github.com/wentaojin/dmgr/service"
 
 	"github.com/wentaojin/dmgr/router"
@@ -57,7 +60,12 @@ func main() {
 		dmgrutil.Logger.Fatal("mysql sync error", zap.Error(err))
 	}
 
-	// 4. 程序运行
+	// 4. 初始化集群操作后台工作池、并行任务并发限制以及文件传输带宽上限
+	operation.InitPool(&cfg.OperationConfig)
+	task.InitConcurrency(&cfg.OperationConfig)
+	executor.InitTransferLimit(&cfg.OperationConfig)
+
+	// 5. 程序运行
 	if err := router.Run(cfg); err != nil {
 		dmgrutil.Logger.Fatal("server run error", zap.Error(err))
 	}
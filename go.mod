@@ -21,6 +21,7 @@ require (
 	github.com/pingcap/errors v0.11.4
 	github.com/pingcap/failpoint v0.0.0-20210316064728-7acb0f0a3dfd
 	github.com/pingcap/log v0.0.0-20210625125904-98ed8e2eb1c7
+	github.com/pkg/sftp v1.13.4
 	github.com/tidwall/gjson v1.6.0
 	github.com/ulule/limiter/v3 v3.8.0
 	github.com/xxjwxc/gowp v0.0.0-20210520113007-57eb4693b12d
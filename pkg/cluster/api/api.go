@@ -34,6 +34,7 @@ import (
 
 var (
 	dmMembersURI = "apis/v1alpha1/members"
+	dmLeaderURI  = "apis/v1alpha1/leader"
 
 	DefaultRetryOpt = &dmgrutil.RetryOption{
 		Delay:   time.Second * 5,
@@ -193,6 +194,24 @@ func (dm *DMMasterClient) GetWorker(name string) (string, error) {
 	return stage, nil
 }
 
+// GetWorkers returns all dm workers with stage and bound source
+func (dm *DMMasterClient) GetWorkers() ([]*dmpb.WorkerInfo, error) {
+	endpoints := dm.getEndpoints(dmMembersURI + "?worker=true")
+	memberResp, err := dm.getMember(endpoints)
+	if err != nil {
+		dmgrutil.Logger.Error("get dm worker status failed", zap.Error(err))
+		return nil, err
+	}
+
+	var workers []*dmpb.WorkerInfo
+	for _, member := range memberResp.Members {
+		if w := member.GetWorker(); w != nil {
+			workers = append(workers, w.GetWorkers()...)
+		}
+	}
+	return workers, nil
+}
+
 // GetLeader gets leader of dm cluster
 func (dm *DMMasterClient) GetLeader(retryOpt *dmgrutil.RetryOption) (string, string, error) {
 	query := "?leader=true"
@@ -256,8 +275,120 @@ func (dm *DMMasterClient) GetRegisteredMembers() ([]string, []string, error) {
 	return registeredMasters, registeredWorkers, nil
 }
 
-// EvictDMMasterLeader evicts the dm master leader
+func (dm *DMMasterClient) operateLeader(op dmpb.LeaderOp) error {
+	endpoints := dm.getEndpoints(fmt.Sprintf("%s/%d", dmLeaderURI, op))
+	_, err := tryURLs(endpoints, func(endpoint string) ([]byte, error) {
+		body, err := dm.httpClient.Put(endpoint, strings.NewReader("{}"))
+		if err != nil {
+			return body, err
+		}
+
+		resp := &dmpb.OperateLeaderResponse{}
+		if err := jsonpb.Unmarshal(strings.NewReader(string(body)), resp); err != nil {
+			return body, err
+		}
+		if !resp.Result {
+			return body, errors.New("dm-master operate leader failed: " + resp.Msg)
+		}
+		return body, nil
+	})
+	return err
+}
+
+// EvictDMMasterLeader evicts the dm master leader and waits for a new leader elected
+// 驱逐后原 leader 不再参与选举，重启后恢复
 func (dm *DMMasterClient) EvictDMMasterLeader(retryOpt *dmgrutil.RetryOption) error {
+	if retryOpt == nil {
+		retryOpt = DefaultRetryOpt
+	}
+
+	oldLeader, _, err := dm.GetLeader(retryOpt)
+	if err != nil {
+		return err
+	}
+	if oldLeader == "" {
+		return errors.New("dm-master leader not found")
+	}
+
+	if err := dmgrutil.Retry(func() error {
+		return dm.operateLeader(dmpb.LeaderOp_EvictLeaderOp)
+	}, *retryOpt); err != nil {
+		return fmt.Errorf("error evict dm-master leader %s, %v", oldLeader, err)
+	}
+
+	if err := dmgrutil.Retry(func() error {
+		leader, _, err := dm.GetLeader(retryOpt)
+		if err != nil {
+			return err
+		}
+		if leader == "" || leader == oldLeader {
+			return fmt.Errorf("dm-master leader still %s", oldLeader)
+		}
+		dmgrutil.Logger.Info("dm-master leader evicted", zap.String("old", oldLeader), zap.String("new", leader))
+		return nil
+	}, *retryOpt); err != nil {
+		return fmt.Errorf("error wait new dm-master leader after evicting %s, %v", oldLeader, err)
+	}
+	return nil
+}
+
+// CancelEvictDMMasterLeader cancels the leader eviction on every dm master
+// 被驱逐的 dm-master 恢复参与选举，不可达的 dm-master 跳过，全部失败时返回错误
+func (dm *DMMasterClient) CancelEvictDMMasterLeader(retryOpt *dmgrutil.RetryOption) error {
+	if retryOpt == nil {
+		retryOpt = DefaultRetryOpt
+	}
+
+	var (
+		canceled int
+		lastErr  error
+	)
+	for _, addr := range dm.addrs {
+		client := &DMMasterClient{addrs: []string{addr}, tlsEnabled: dm.tlsEnabled, httpClient: dm.httpClient}
+		if err := dmgrutil.Retry(func() error {
+			return client.operateLeader(dmpb.LeaderOp_CancelEvictLeaderOp)
+		}, *retryOpt); err != nil {
+			lastErr = err
+			continue
+		}
+		canceled++
+	}
+	if canceled == 0 && lastErr != nil {
+		return fmt.Errorf("error cancel evict dm-master leader, %v", lastErr)
+	}
+	return nil
+}
+
+// CheckMasterHealthy checks the dm master is alive and the dm cluster has a leader
+func (dm *DMMasterClient) CheckMasterHealthy(name string) error {
+	isFound, isActive, isLeader, err := dm.GetMaster(name)
+	if err != nil {
+		return err
+	}
+	if !isFound || (!isActive && !isLeader) {
+		return fmt.Errorf("dm-master %s is not alive", name)
+	}
+	if !isLeader {
+		leader, _, err := dm.GetLeader(&dmgrutil.RetryOption{Attempts: 1, Timeout: DmMasterApiTimeout})
+		if err != nil {
+			return err
+		}
+		if leader == "" {
+			return errors.New("dm-master leader not found")
+		}
+	}
+	return nil
+}
+
+// CheckWorkerHealthy checks the dm worker is registered and online
+func (dm *DMMasterClient) CheckWorkerHealthy(name string) error {
+	stage, err := dm.GetWorker(name)
+	if err != nil {
+		return err
+	}
+	if stage == "" || strings.EqualFold(stage, "offline") {
+		return fmt.Errorf("dm-worker %s is offline", name)
+	}
 	return nil
 }
 
@@ -17,6 +17,7 @@ package api
 
 import (
 	"bytes"
+	"crypto/tls"
 	"fmt"
 	"io"
 )
@@ -28,23 +29,23 @@ const (
 )
 
 // 获取所有数据源信息
-func GetSourcesALL(dmMasterHttpUrl string) ([]byte, error) {
+func GetSourcesALL(dmMasterHttpUrl string, tlsConfig *tls.Config) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s", dmMasterHttpUrl, sourceAPI)
-	client := NewHTTPClient(DmMasterApiTimeout, nil)
+	client := NewHTTPClient(DmMasterApiTimeout, tlsConfig)
 	return client.Get(url)
 }
 
 // 获取数据源状态
-func GetSourceStatusBySourceName(dmMasterHttpUrl, sourceName string) ([]byte, error) {
+func GetSourceStatusBySourceName(dmMasterHttpUrl, sourceName string, tlsConfig *tls.Config) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s/%s/status", dmMasterHttpUrl, sourceAPI, sourceName)
-	client := NewHTTPClient(DmMasterApiTimeout, nil)
+	client := NewHTTPClient(DmMasterApiTimeout, tlsConfig)
 	return client.Get(url)
 }
 
 // 删除某个上游
-func DeleteSourceBySourceName(dmMasterHttpUrl, sourceName string) ([]byte, error) {
+func DeleteSourceBySourceName(dmMasterHttpUrl, sourceName string, tlsConfig *tls.Config) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s/%s", dmMasterHttpUrl, sourceAPI, sourceName)
-	client := NewHTTPClient(DmMasterApiTimeout, nil)
+	client := NewHTTPClient(DmMasterApiTimeout, tlsConfig)
 	body, statusCode, err := client.Delete(url, nil)
 
 	if statusCode == 400 {
@@ -60,9 +61,9 @@ func DeleteSourceBySourceName(dmMasterHttpUrl, sourceName string) ([]byte, error
 }
 
 // 启动某个数据源同步任务
-func StartSourceBySourceName(dmMasterHttpUrl, sourceName string, body io.Reader) ([]byte, error) {
+func StartSourceBySourceName(dmMasterHttpUrl, sourceName string, body io.Reader, tlsConfig *tls.Config) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s/%s/start-relay", dmMasterHttpUrl, sourceAPI, sourceName)
-	client := NewHTTPClient(DmMasterApiTimeout, nil)
+	client := NewHTTPClient(DmMasterApiTimeout, tlsConfig)
 	resp, statusCode, err := client.Patch(url, body)
 
 	if statusCode == 400 {
@@ -79,9 +80,9 @@ func StartSourceBySourceName(dmMasterHttpUrl, sourceName string, body io.Reader)
 }
 
 // 停止某个数据源同步任务
-func StopSourceBySourceName(dmMasterHttpUrl, sourceName string, body io.Reader) ([]byte, error) {
+func StopSourceBySourceName(dmMasterHttpUrl, sourceName string, body io.Reader, tlsConfig *tls.Config) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s/%s/stop-relay", dmMasterHttpUrl, sourceAPI, sourceName)
-	client := NewHTTPClient(DmMasterApiTimeout, nil)
+	client := NewHTTPClient(DmMasterApiTimeout, tlsConfig)
 	resp, statusCode, err := client.Patch(url, body)
 
 	if statusCode == 400 {
@@ -97,38 +98,52 @@ func StopSourceBySourceName(dmMasterHttpUrl, sourceName string, body io.Reader)
 	return resp, nil
 }
 
+// 迁移数据源至指定 dm-worker
+func TransferSource(dmMasterHttpUrl, sourceName string, body io.Reader, tlsConfig *tls.Config) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s/%s/transfer", dmMasterHttpUrl, sourceAPI, sourceName)
+	client := NewHTTPClient(DmMasterApiTimeout, tlsConfig)
+	resp, err := client.Post(url, body)
+	if bytes.Contains(resp, []byte("not exists")) {
+		return resp, fmt.Errorf("source name [%v] to transfer does not exist", sourceName)
+	}
+	if err != nil {
+		return resp, fmt.Errorf("source name [%v] to transfer failed: %v %v", sourceName, err, string(resp))
+	}
+	return resp, nil
+}
+
 // 创建某个数据源
-func CreateSource(dmMasterHttpUrl string, body io.Reader) ([]byte, error) {
+func CreateSource(dmMasterHttpUrl string, body io.Reader, tlsConfig *tls.Config) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s", dmMasterHttpUrl, sourceAPI)
-	client := NewHTTPClient(DmMasterApiTimeout, nil)
+	client := NewHTTPClient(DmMasterApiTimeout, tlsConfig)
 	return client.Post(url, body)
 }
 
 // 任务创建及启动
-func StartTaskMigration(dmMasterHttpUrl string, body io.Reader) ([]byte, error) {
+func StartTaskMigration(dmMasterHttpUrl string, body io.Reader, tlsConfig *tls.Config) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s", dmMasterHttpUrl, taskAPI)
-	client := NewHTTPClient(DmMasterApiTimeout, nil)
+	client := NewHTTPClient(DmMasterApiTimeout, tlsConfig)
 	return client.Post(url, body)
 }
 
 // 获取所有任务信息
-func GetTaskALL(dmMasterHttpUrl string) ([]byte, error) {
+func GetTaskALL(dmMasterHttpUrl string, tlsConfig *tls.Config) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s", dmMasterHttpUrl, taskAPI)
-	client := NewHTTPClient(DmMasterApiTimeout, nil)
+	client := NewHTTPClient(DmMasterApiTimeout, tlsConfig)
 	return client.Get(url)
 }
 
 // 获取任务状态
-func GetTaskStatusByTaskName(dmMasterHttpUrl, taskName string) ([]byte, error) {
+func GetTaskStatusByTaskName(dmMasterHttpUrl, taskName string, tlsConfig *tls.Config) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s/%s/status", dmMasterHttpUrl, taskAPI, taskName)
-	client := NewHTTPClient(DmMasterApiTimeout, nil)
+	client := NewHTTPClient(DmMasterApiTimeout, tlsConfig)
 	return client.Get(url)
 }
 
 // 删除某个任务
-func DeleteTaskByTaskName(dmMasterHttpUrl, taskName string) ([]byte, error) {
+func DeleteTaskByTaskName(dmMasterHttpUrl, taskName string, tlsConfig *tls.Config) ([]byte, error) {
 	url := fmt.Sprintf("%s/%s/%s", dmMasterHttpUrl, taskAPI, taskName)
-	client := NewHTTPClient(DmMasterApiTimeout, nil)
+	client := NewHTTPClient(DmMasterApiTimeout, tlsConfig)
 	body, statusCode, err := client.Delete(url, nil)
 
 	if statusCode == 400 {
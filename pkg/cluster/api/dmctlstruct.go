@@ -57,6 +57,18 @@ func NewWorkerNameBody(workerName string) *WorkerNameBodyStruct {
 	}
 }
 
+// 数据源状态响应
+type SourceStatusListStruct struct {
+	Total int                  `json:"total"`
+	Data  []SourceStatusStruct `json:"data"`
+}
+
+type SourceStatusStruct struct {
+	SourceName string `json:"source_name"`
+	WorkerName string `json:"worker_name"`
+	ErrorMsg   string `json:"error_msg"`
+}
+
 // 任务 Source 请求
 type RelayStatusBodyStruct struct {
 	WorkerName      string `json:"worker_name"`
@@ -67,6 +67,23 @@ func (c *HTTPClient) Post(url string, body io.Reader) ([]byte, error) {
 	return checkHTTPResponse(res)
 }
 
+// Put send a PUT request to the url and returns the response
+func (c *HTTPClient) Put(url string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest("PUT", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return checkHTTPResponse(res)
+}
+
 // Delete send a DELETE request to the url and returns the response and status code.
 func (c *HTTPClient) Delete(url string, body io.Reader) ([]byte, int, error) {
 	var statusCode int
@@ -16,16 +16,30 @@ limitations under the License.
 package ctxt
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/wentaojin/dmgr/pkg/cluster/event"
 	"github.com/wentaojin/dmgr/pkg/cluster/executor"
 	"github.com/wentaojin/dmgr/pkg/cluster/mock"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"go.uber.org/zap"
 )
 
 // 上下文用于在多个任务执行时共享状态。
 // 使用互斥锁来防止某些字段的并发读/写
 // 因为可以在并行任务中共享相同的上下文。
+// 内嵌 context.Context，用于取消或到期时中断任务运行
 type Context struct {
+	context.Context
+
 	Exec struct {
 		sync.RWMutex
 		Executors    map[string]executor.Executor
@@ -37,11 +51,69 @@ type Context struct {
 	// 私钥/公钥用于通过用户访问远程服务器
 	PrivateKeyPath string
 	PublicKeyPath  string
+
+	// 所属集群操作 ID，非 0 时推送运行事件
+	OperationID uint64
+
+	// 主机 SSH 跳板机，未配置跳板机的主机直连
+	SSHProxies map[string]*executor.SSHProxyConfig
+	// 已信任的主机公钥指纹，key 为 host:port
+	SSHHostKeys map[string]string
+
+	// 集群操作步骤检查点，用于断点续做
+	checkpoint struct {
+		sync.Mutex
+		occurrences map[string]int
+		done        map[string]struct{}
+		record      func(stepKey, stepName string) error
+	}
+
+	// 集群操作步骤重试记录
+	retry struct {
+		sync.Mutex
+		record func(msg string) error
+	}
+
+	// 集群操作远程命令执行记录
+	command struct {
+		sync.Mutex
+		record func(rec CommandRecord) error
+	}
+
+	// 集群操作结束时运行的清理函数（如删除文件复制的远程备份），Detach 后共享
+	cleanups *cleanupList
+
+	// 集群操作标记的敏感参数，命令日志、错误、事件以及命令执行记录中脱敏，Detach 后共享
+	secrets *executor.SecretSource
+}
+
+type cleanupList struct {
+	sync.Mutex
+	fns []func(ctx *Context)
+}
+
+// CommandRecord 远程命令执行记录
+type CommandRecord struct {
+	Host     string
+	Command  string
+	Sudo     bool
+	ExitCode int // 0 表示成功，-1 表示未获取到退出码（连接失败、超时或取消）
+	Duration time.Duration
+	Stdout   string
+	Stderr   string
+	ErrorMsg string
 }
 
 // NewContext create a context instance.
 func NewContext() *Context {
+	return NewContextWith(context.Background())
+}
+
+// NewContextWith create a context instance derived from the parent context.
+func NewContextWith(parent context.Context) *Context {
+	secrets := &executor.SecretSource{}
 	return &Context{
+		Context: executor.WithSecretSource(parent, secrets),
 		Exec: struct {
 			sync.RWMutex
 			Executors    map[string]executor.Executor
@@ -54,14 +126,214 @@ func NewContext() *Context {
 			Stderrs:      make(map[string][]byte),
 			CheckResults: make(map[string][]interface{}),
 		},
+		cleanups: &cleanupList{},
+		secrets:  secrets,
+	}
+}
+
+// NewOperationContext create a context instance bound to the cluster operation.
+func NewOperationContext(parent context.Context, operationID uint64) *Context {
+	ctx := NewContextWith(parent)
+	ctx.OperationID = operationID
+	return ctx
+}
+
+// Detach 返回不受取消或到期影响的上下文，共享执行器、SSH 密钥、SSH 跳板机、主机公钥、集群操作 ID、命令执行记录以及敏感参数，用于任务回滚
+func (ctx *Context) Detach() *Context {
+	nctx := NewContext()
+	ctx.Exec.RLock()
+	for host, e := range ctx.Exec.Executors {
+		nctx.Exec.Executors[host] = e
+	}
+	ctx.Exec.RUnlock()
+	nctx.PrivateKeyPath = ctx.PrivateKeyPath
+	nctx.PublicKeyPath = ctx.PublicKeyPath
+	nctx.OperationID = ctx.OperationID
+	nctx.SSHProxies = ctx.SSHProxies
+	nctx.SSHHostKeys = ctx.SSHHostKeys
+	ctx.command.Lock()
+	nctx.command.record = ctx.command.record
+	ctx.command.Unlock()
+	nctx.cleanups = ctx.cleanups
+	nctx.Context = executor.WithSecretSource(context.Background(), ctx.secrets)
+	nctx.secrets = ctx.secrets
+	return nctx
+}
+
+// AddSecrets 标记集群操作中的敏感参数，如 grafana 用户密码、跳板机密码
+func (ctx *Context) AddSecrets(secrets ...string) {
+	ctx.secrets.Add(secrets...)
+}
+
+// AddCleanup 添加集群操作结束时运行的清理函数
+func (ctx *Context) AddCleanup(fn func(ctx *Context)) {
+	ctx.cleanups.Lock()
+	defer ctx.cleanups.Unlock()
+	ctx.cleanups.fns = append(ctx.cleanups.fns, fn)
+}
+
+// Cleanup 逆序运行清理函数，集群操作结束（包含回滚完成）时调用
+// 清理使用不受取消或到期影响的上下文
+func (ctx *Context) Cleanup() {
+	ctx.cleanups.Lock()
+	fns := ctx.cleanups.fns
+	ctx.cleanups.fns = nil
+	ctx.cleanups.Unlock()
+
+	rctx := ctx.Detach()
+	for i := len(fns) - 1; i >= 0; i-- {
+		fns[i](rctx)
+	}
+}
+
+// SetCheckpoint 设置集群操作步骤检查点
+// done 为已完成的步骤标识，record 用于记录新完成的步骤
+func (ctx *Context) SetCheckpoint(done []string, record func(stepKey, stepName string) error) {
+	ctx.checkpoint.Lock()
+	defer ctx.checkpoint.Unlock()
+	ctx.checkpoint.occurrences = make(map[string]int)
+	ctx.checkpoint.done = make(map[string]struct{}, len(done))
+	for _, key := range done {
+		ctx.checkpoint.done[key] = struct{}{}
+	}
+	ctx.checkpoint.record = record
+}
+
+// StepKey 生成步骤标识，相同步骤名按出现次序区分，未设置检查点返回空
+func (ctx *Context) StepKey(stepName string) string {
+	ctx.checkpoint.Lock()
+	defer ctx.checkpoint.Unlock()
+	if ctx.checkpoint.record == nil {
+		return ""
+	}
+	ctx.checkpoint.occurrences[stepName]++
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s#%d", stepName, ctx.checkpoint.occurrences[stepName])))
+	return hex.EncodeToString(sum[:])
+}
+
+// StepDone 步骤是否已完成
+func (ctx *Context) StepDone(stepKey string) bool {
+	if stepKey == "" {
+		return false
+	}
+	ctx.checkpoint.Lock()
+	defer ctx.checkpoint.Unlock()
+	_, ok := ctx.checkpoint.done[stepKey]
+	return ok
+}
+
+// RecordStep 记录步骤完成
+func (ctx *Context) RecordStep(stepKey, stepName string) error {
+	if stepKey == "" {
+		return nil
+	}
+	ctx.checkpoint.Lock()
+	record := ctx.checkpoint.record
+	ctx.checkpoint.done[stepKey] = struct{}{}
+	ctx.checkpoint.Unlock()
+	return record(stepKey, stepName)
+}
+
+// StepMark 返回当前步骤出现次序，用于任务组重试时回退
+func (ctx *Context) StepMark() map[string]int {
+	ctx.checkpoint.Lock()
+	defer ctx.checkpoint.Unlock()
+	mark := make(map[string]int, len(ctx.checkpoint.occurrences))
+	for name, n := range ctx.checkpoint.occurrences {
+		mark[name] = n
+	}
+	return mark
+}
+
+// RewindSteps 回退步骤出现次序，任务组重试时已完成的步骤生成相同的步骤标识从而跳过
+func (ctx *Context) RewindSteps(mark map[string]int) {
+	ctx.checkpoint.Lock()
+	defer ctx.checkpoint.Unlock()
+	for name := range ctx.checkpoint.occurrences {
+		if n, ok := mark[name]; ok {
+			ctx.checkpoint.occurrences[name] = n
+		} else {
+			delete(ctx.checkpoint.occurrences, name)
+		}
+	}
+}
+
+// SetRetryRecord 设置集群操作步骤重试记录
+func (ctx *Context) SetRetryRecord(record func(msg string) error) {
+	ctx.retry.Lock()
+	defer ctx.retry.Unlock()
+	ctx.retry.record = record
+}
+
+// RecordRetry 记录步骤重试，未设置重试记录时忽略
+func (ctx *Context) RecordRetry(msg string) error {
+	ctx.retry.Lock()
+	record := ctx.retry.record
+	ctx.retry.Unlock()
+	if record == nil {
+		return nil
 	}
+	return record(msg)
+}
+
+// SetCommandRecord 设置集群操作远程命令执行记录
+func (ctx *Context) SetCommandRecord(record func(rec CommandRecord) error) {
+	ctx.command.Lock()
+	defer ctx.command.Unlock()
+	ctx.command.record = record
+}
+
+// RecordCommand 记录远程命令执行，未设置执行记录时忽略
+func (ctx *Context) RecordCommand(rec CommandRecord) error {
+	ctx.command.Lock()
+	record := ctx.command.record
+	ctx.command.Unlock()
+	if record == nil {
+		return nil
+	}
+	return record(rec)
+}
+
+// Emit 推送集群操作运行事件
+func (ctx *Context) Emit(ev event.Event) {
+	if ctx.OperationID == 0 {
+		return
+	}
+	ev.OperationID = ctx.OperationID
+	event.Publish(ev)
 }
 
 // SetExecutor set the executor.
+// 替换的执行器关闭其复用的连接
 func (ctx *Context) SetExecutor(host string, e executor.Executor) {
 	ctx.Exec.Lock()
+	old := ctx.Exec.Executors[host]
 	ctx.Exec.Executors[host] = e
 	ctx.Exec.Unlock()
+	if old != nil && old != e {
+		closeExecutor(host, old)
+	}
+}
+
+// Close 关闭所有执行器复用的连接，集群操作结束时调用
+func (ctx *Context) Close() {
+	ctx.Exec.Lock()
+	executors := ctx.Exec.Executors
+	ctx.Exec.Executors = make(map[string]executor.Executor)
+	ctx.Exec.Unlock()
+	for host, e := range executors {
+		closeExecutor(host, e)
+	}
+}
+
+func closeExecutor(host string, e executor.Executor) {
+	c, ok := e.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := c.Close(); err != nil {
+		dmgrutil.Logger.Warn("CloseExecutor", zap.String("host", host), zap.Error(err))
+	}
 }
 
 // GetExecutor get the executor.
@@ -74,9 +346,22 @@ func (ctx *Context) GetExecutor(host string) (e executor.Executor, ok bool) {
 	ctx.Exec.RLock()
 	e, ok = ctx.Exec.Executors[host]
 	ctx.Exec.RUnlock()
+	if ok && e != nil && ctx.OperationID != 0 {
+		e = &eventExecutor{Executor: e, host: host, ctx: ctx}
+	}
 	return
 }
 
+// SSHProxy 主机 SSH 跳板机，未配置返回 nil
+func (ctx *Context) SSHProxy(host string) *executor.SSHProxyConfig {
+	return ctx.SSHProxies[host]
+}
+
+// SSHHostKey 主机已信任的公钥指纹，未信任返回空
+func (ctx *Context) SSHHostKey(host string, port uint64) string {
+	return ctx.SSHHostKeys[net.JoinHostPort(host, strconv.FormatUint(port, 10))]
+}
+
 // GetSSHKeySet implements the operation.ExecutorGetter interface.
 func (ctx *Context) GetSSHKeySet() (privateKeyPath, publicKeyPath string) {
 	return ctx.PrivateKeyPath, ctx.PublicKeyPath
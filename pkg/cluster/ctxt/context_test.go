@@ -0,0 +1,85 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ctxt
+
+import "testing"
+
+func TestStepKeyWithoutCheckpoint(t *testing.T) {
+	ctx := NewContext()
+	if key := ctx.StepKey("CopyFile: local=a, remote=h:b"); key != "" {
+		t.Fatalf("step key without checkpoint = %q, want empty", key)
+	}
+	if ctx.StepDone("") {
+		t.Fatal("empty step key reported done")
+	}
+	if err := ctx.RecordStep("", "noop"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStepKeyOccurrence(t *testing.T) {
+	steps := []string{"start", "restart", "restart", "start"}
+	keys := func() []string {
+		ctx := NewContext()
+		ctx.SetCheckpoint(nil, func(stepKey, stepName string) error { return nil })
+		var keys []string
+		for _, name := range steps {
+			keys = append(keys, ctx.StepKey(name))
+		}
+		return keys
+	}
+
+	first := keys()
+	seen := make(map[string]bool)
+	for i, key := range first {
+		if seen[key] {
+			t.Fatalf("step %d [%s] key duplicated", i, steps[i])
+		}
+		seen[key] = true
+	}
+	// 断点续做时相同的步骤序列生成相同的步骤标识
+	for i, key := range keys() {
+		if key != first[i] {
+			t.Fatalf("step %d [%s] key changed between runs", i, steps[i])
+		}
+	}
+}
+
+func TestRecordStep(t *testing.T) {
+	ctx := NewContext()
+	var recorded []string
+	ctx.SetCheckpoint(nil, func(stepKey, stepName string) error {
+		recorded = append(recorded, stepName)
+		return nil
+	})
+
+	key := ctx.StepKey("deploy")
+	if ctx.StepDone(key) {
+		t.Fatal("step done before record")
+	}
+	if err := ctx.RecordStep(key, "deploy"); err != nil {
+		t.Fatal(err)
+	}
+	if !ctx.StepDone(key) || len(recorded) != 1 || recorded[0] != "deploy" {
+		t.Fatalf("step not recorded, done=%v recorded=%v", ctx.StepDone(key), recorded)
+	}
+
+	resumed := NewContext()
+	resumed.SetCheckpoint([]string{key}, func(stepKey, stepName string) error { return nil })
+	if !resumed.StepDone(resumed.StepKey("deploy")) {
+		t.Fatal("recorded step not done after resume")
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ctxt
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/wentaojin/dmgr/pkg/cluster/event"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"go.uber.org/zap"
+)
+
+const (
+	// 命令执行记录单个输出最大长度，超出保留末尾部分
+	maxRecordOutput = 64 * 1024
+	// 文件传输进度事件推送间隔
+	progressInterval = time.Second
+)
+
+// eventExecutor 推送执行器输出事件，记录命令执行
+type eventExecutor struct {
+	executor.Executor
+	host string
+	ctx  *Context
+}
+
+// Execute implements the Executor interface
+// 推送事件以及命令执行记录中的敏感参数脱敏，见 executor.WithSecrets
+func (e *eventExecutor) Execute(ctx context.Context, cmd string, sudo bool, timeout ...time.Duration) ([]byte, []byte, error) {
+	start := time.Now()
+	stdout, stderr, err := e.Executor.Execute(ctx, cmd, sudo, timeout...)
+	duration := time.Since(start)
+
+	e.ctx.Exec.Lock()
+	e.ctx.Exec.Stdouts[e.host] = stdout
+	e.ctx.Exec.Stderrs[e.host] = stderr
+	e.ctx.Exec.Unlock()
+
+	ev := event.Event{
+		Type:   event.CommandOutput,
+		Host:   e.host,
+		Stdout: executor.Redact(ctx, string(stdout)),
+		Stderr: executor.Redact(ctx, string(stderr)),
+	}
+	rec := CommandRecord{
+		Host:     e.host,
+		Command:  executor.Redact(ctx, cmd),
+		Sudo:     sudo,
+		ExitCode: exitCode(err),
+		Duration: duration,
+		Stdout:   truncateOutput(ev.Stdout),
+		Stderr:   truncateOutput(ev.Stderr),
+	}
+	if err != nil {
+		ev.Error = executor.Redact(ctx, err.Error())
+		rec.ErrorMsg = ev.Error
+	}
+	e.ctx.Emit(ev)
+	e.record(rec)
+	return stdout, stderr, err
+}
+
+// Transfer implements the Executor interface
+func (e *eventExecutor) Transfer(ctx context.Context, src, dst string, download bool, limit int) error {
+	start := time.Now()
+	step := fmt.Sprintf("src=%s, dst=%s, download=%v", src, dst, download)
+
+	// 按间隔推送传输进度
+	var transferred, total int64
+	lastProgress := start
+	ctx = executor.WithTransferProgress(ctx, func(n, t int64) {
+		transferred, total = n, t
+		if now := time.Now(); now.Sub(lastProgress) >= progressInterval {
+			lastProgress = now
+			e.ctx.Emit(event.Event{
+				Type:   event.FileTransfer,
+				Host:   e.host,
+				Step:   step,
+				Status: fmt.Sprintf("%d/%d bytes", n, t),
+			})
+		}
+	})
+
+	err := e.Executor.Transfer(ctx, src, dst, download, limit)
+	ev := event.Event{
+		Type:   event.FileTransfer,
+		Host:   e.host,
+		Step:   step,
+		Status: fmt.Sprintf("%d/%d bytes", transferred, total),
+	}
+	rec := CommandRecord{
+		Host:     e.host,
+		Command:  fmt.Sprintf("upload %s %s", src, dst),
+		ExitCode: exitCode(err),
+		Duration: time.Since(start),
+		Stdout:   fmt.Sprintf("transferred %d/%d bytes", transferred, total),
+	}
+	if download {
+		rec.Command = fmt.Sprintf("download %s %s", src, dst)
+	}
+	if err != nil {
+		ev.Error = err.Error()
+		rec.ErrorMsg = err.Error()
+	}
+	e.ctx.Emit(ev)
+	e.record(rec)
+	return err
+}
+
+// 记录失败不影响任务运行
+func (e *eventExecutor) record(rec CommandRecord) {
+	if err := e.ctx.RecordCommand(rec); err != nil {
+		dmgrutil.Logger.Error("RecordCommand", zap.String("host", e.host), zap.Error(err))
+	}
+}
+
+// 命令退出码，沿错误链查找远程命令或本地命令退出状态
+func exitCode(err error) int {
+	for err != nil {
+		switch v := err.(type) {
+		case interface{ ExitStatus() int }:
+			return v.ExitStatus()
+		case interface{ ExitCode() int }:
+			return v.ExitCode()
+		}
+		switch v := err.(type) {
+		case interface{ Unwrap() error }:
+			err = v.Unwrap()
+		case interface{ Cause() error }:
+			err = v.Cause()
+		default:
+			return -1
+		}
+	}
+	return 0
+}
+
+func truncateOutput(out string) string {
+	if len(out) <= maxRecordOutput {
+		return out
+	}
+	return "...(truncated)\n" + out[len(out)-maxRecordOutput:]
+}
@@ -0,0 +1,120 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ctxt
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type exitError struct{ status int }
+
+func (e exitError) Error() string   { return "exit status" }
+func (e exitError) ExitStatus() int { return e.status }
+
+// stubExecutor 返回固定输出，不运行任何命令
+type stubExecutor struct {
+	stdout, stderr []byte
+	err            error
+}
+
+func (s *stubExecutor) Execute(ctx context.Context, cmd string, sudo bool, timeout ...time.Duration) ([]byte, []byte, error) {
+	return s.stdout, s.stderr, s.err
+}
+
+func (s *stubExecutor) Transfer(ctx context.Context, src, dst string, download bool, limit int) error {
+	return s.err
+}
+
+func recordingContext(stub *stubExecutor) (*Context, *[]CommandRecord) {
+	ctx := NewOperationContext(context.Background(), 3001)
+	var records []CommandRecord
+	ctx.SetCommandRecord(func(rec CommandRecord) error {
+		records = append(records, rec)
+		return nil
+	})
+	ctx.SetExecutor("h1", stub)
+	return ctx, &records
+}
+
+func TestExecutorRecordsCommand(t *testing.T) {
+	ctx, records := recordingContext(&stubExecutor{stdout: []byte("ok"), stderr: []byte("warn"), err: exitError{status: 2}})
+
+	e, ok := ctx.GetExecutor("h1")
+	if !ok {
+		t.Fatal("executor not found")
+	}
+	stdout, _, err := e.Execute(ctx, `mysql -uroot --password=s3cret -e "select 1"`, true)
+	if err == nil || string(stdout) != "ok" {
+		t.Fatalf("execute returned stdout %q, err %v", stdout, err)
+	}
+
+	if len(*records) != 1 {
+		t.Fatalf("recorded %d commands, want 1", len(*records))
+	}
+	rec := (*records)[0]
+	if strings.Contains(rec.Command, "s3cret") || !strings.Contains(rec.Command, "--password=******") {
+		t.Fatalf("command not redacted: %s", rec.Command)
+	}
+	if rec.Host != "h1" || !rec.Sudo || rec.ExitCode != 2 || rec.Stdout != "ok" || rec.Stderr != "warn" || rec.ErrorMsg == "" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+}
+
+func TestExecutorTruncatesRecordedOutput(t *testing.T) {
+	out := strings.Repeat("a", maxRecordOutput) + "end"
+	ctx, records := recordingContext(&stubExecutor{stdout: []byte(out)})
+
+	e, _ := ctx.GetExecutor("h1")
+	if _, _, err := e.Execute(ctx, "cat big.log", false); err != nil {
+		t.Fatal(err)
+	}
+	rec := (*records)[0]
+	if rec.ExitCode != 0 {
+		t.Fatalf("exit code = %d, want 0", rec.ExitCode)
+	}
+	if !strings.HasPrefix(rec.Stdout, "...(truncated)\n") || !strings.HasSuffix(rec.Stdout, "end") ||
+		len(rec.Stdout) != len("...(truncated)\n")+maxRecordOutput {
+		t.Fatalf("stdout not truncated to last %d bytes, length %d", maxRecordOutput, len(rec.Stdout))
+	}
+}
+
+func TestExecutorRecordsTransfer(t *testing.T) {
+	ctx, records := recordingContext(&stubExecutor{})
+
+	e, _ := ctx.GetExecutor("h1")
+	if err := e.Transfer(ctx, "/tmp/a", "/data/a", false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Transfer(ctx, "/data/b", "/tmp/b", true, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := []string{(*records)[0].Command, (*records)[1].Command}; got[0] != "upload /tmp/a /data/a" || got[1] != "download /data/b /tmp/b" {
+		t.Fatalf("transfer records = %v", got)
+	}
+}
+
+func TestExecutorWithoutOperation(t *testing.T) {
+	ctx := NewContext()
+	stub := &stubExecutor{}
+	ctx.SetExecutor("h1", stub)
+	// 非集群操作上下文不包装执行器，不记录命令
+	if e, _ := ctx.GetExecutor("h1"); e != stub {
+		t.Fatal("executor wrapped outside cluster operation")
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// 集群操作事件类型
+	OperationStart  = "operation_start"
+	OperationFinish = "operation_finish"
+	GroupStart      = "group_start"
+	GroupFinish     = "group_finish"
+	StepStart       = "step_start"
+	StepFinish      = "step_finish"
+	CommandOutput   = "command_output"
+	FileTransfer    = "file_transfer"
+	Rollback        = "rollback"
+	Retry           = "retry"
+
+	// 单个订阅者事件缓冲，订阅者消费过慢时丢弃事件，不阻塞任务运行
+	subscriberBufferSize = 256
+	// 集群操作结束后事件保留时间，便于稍后连接的订阅者回放
+	streamRetention = 10 * time.Minute
+	// 单个集群操作保留的事件历史数量，超出丢弃最早的事件
+	maxHistoryEvents = 2000
+	// 命令输出事件单个输出最大长度，超出保留末尾部分
+	maxEventOutput = 16 * 1024
+)
+
+// Event 集群操作运行事件
+type Event struct {
+	OperationID uint64    `json:"operation_id"`
+	Type        string    `json:"type"`
+	Step        string    `json:"step,omitempty"`
+	Host        string    `json:"host,omitempty"`
+	Stdout      string    `json:"stdout,omitempty"`
+	Stderr      string    `json:"stderr,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// 单个集群操作事件流
+type stream struct {
+	history     []Event
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+var (
+	mu      sync.Mutex
+	streams = make(map[uint64]*stream)
+)
+
+// Open 创建集群操作事件流，已关闭的事件流（断点续做）重新创建
+func Open(operationID uint64) {
+	mu.Lock()
+	defer mu.Unlock()
+	if st, ok := streams[operationID]; !ok || st.closed {
+		streams[operationID] = &stream{subscribers: make(map[chan Event]struct{})}
+	}
+}
+
+// Publish 推送集群操作事件，事件流不存在或已关闭则忽略
+func Publish(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if ev.Type == CommandOutput {
+		ev.Stdout, ev.Stderr = truncateOutput(ev.Stdout), truncateOutput(ev.Stderr)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	st, ok := streams[ev.OperationID]
+	if !ok || st.closed {
+		return
+	}
+	if len(st.history) >= maxHistoryEvents {
+		n := copy(st.history, st.history[len(st.history)-maxHistoryEvents+1:])
+		st.history = st.history[:n]
+	}
+	st.history = append(st.history, ev)
+	for ch := range st.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Close 关闭集群操作事件流，关闭所有订阅者，事件历史保留一段时间后清理
+func Close(operationID uint64) {
+	mu.Lock()
+	defer mu.Unlock()
+	st, ok := streams[operationID]
+	if !ok || st.closed {
+		return
+	}
+	st.closed = true
+	for ch := range st.subscribers {
+		close(ch)
+	}
+	st.subscribers = nil
+
+	time.AfterFunc(streamRetention, func() {
+		mu.Lock()
+		if streams[operationID] == st {
+			delete(streams, operationID)
+		}
+		mu.Unlock()
+	})
+}
+
+// Subscribe 订阅集群操作事件
+// 返回已产生的事件历史（最近 maxHistoryEvents 个）以及后续事件 channel，事件流不存在或已关闭时 channel 为 nil
+func Subscribe(operationID uint64) ([]Event, <-chan Event, func()) {
+	mu.Lock()
+	defer mu.Unlock()
+	st, ok := streams[operationID]
+	if !ok {
+		return nil, nil, func() {}
+	}
+
+	history := make([]Event, len(st.history))
+	copy(history, st.history)
+	if st.closed {
+		return history, nil, func() {}
+	}
+
+	ch := make(chan Event, subscriberBufferSize)
+	st.subscribers[ch] = struct{}{}
+	return history, ch, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := st.subscribers[ch]; ok {
+			delete(st.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// 截断过长的命令输出，保留末尾部分
+func truncateOutput(out string) string {
+	if len(out) <= maxEventOutput {
+		return out
+	}
+	return "...(truncated)\n" + out[len(out)-maxEventOutput:]
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package event
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPublishKeepsLatestHistory(t *testing.T) {
+	const id = 1001
+	Open(id)
+	defer Close(id)
+
+	total := maxHistoryEvents + 10
+	for i := 0; i < total; i++ {
+		Publish(Event{OperationID: id, Type: StepStart, Status: strconv.Itoa(i)})
+	}
+
+	history, ch, cancel := Subscribe(id)
+	defer cancel()
+	if ch == nil {
+		t.Fatal("subscribe to open stream returned nil channel")
+	}
+	if len(history) != maxHistoryEvents {
+		t.Fatalf("history length = %d, want %d", len(history), maxHistoryEvents)
+	}
+	if first, last := history[0].Status, history[len(history)-1].Status; first != strconv.Itoa(10) || last != strconv.Itoa(total-1) {
+		t.Fatalf("history range = [%s, %s], want [%s, %s]", first, last, strconv.Itoa(10), strconv.Itoa(total-1))
+	}
+}
+
+func TestPublishTruncatesCommandOutput(t *testing.T) {
+	const id = 1002
+	Open(id)
+	defer Close(id)
+
+	_, ch, cancel := Subscribe(id)
+	defer cancel()
+
+	long := strings.Repeat("x", maxEventOutput) + "tail"
+	Publish(Event{OperationID: id, Type: CommandOutput, Stdout: long, Stderr: "short"})
+	// 非命令输出事件不截断
+	Publish(Event{OperationID: id, Type: StepFinish, Stdout: long})
+
+	ev := <-ch
+	if !strings.HasPrefix(ev.Stdout, "...(truncated)\n") || !strings.HasSuffix(ev.Stdout, "tail") {
+		t.Fatalf("stdout not truncated to tail: %q...", ev.Stdout[:32])
+	}
+	if n := len(strings.TrimPrefix(ev.Stdout, "...(truncated)\n")); n != maxEventOutput {
+		t.Fatalf("truncated stdout length = %d, want %d", n, maxEventOutput)
+	}
+	if ev.Stderr != "short" {
+		t.Fatalf("stderr = %q, want unchanged", ev.Stderr)
+	}
+	if ev.Time.IsZero() {
+		t.Fatal("event time not set")
+	}
+	if ev = <-ch; ev.Stdout != long {
+		t.Fatal("step event output truncated")
+	}
+}
+
+func TestCloseEndsSubscriptionAndKeepsHistory(t *testing.T) {
+	const id = 1003
+	Open(id)
+	_, ch, cancel := Subscribe(id)
+	defer cancel()
+
+	Publish(Event{OperationID: id, Type: OperationStart})
+	Close(id)
+	// 关闭后推送的事件忽略
+	Publish(Event{OperationID: id, Type: OperationFinish})
+
+	var got []string
+	for ev := range ch {
+		got = append(got, ev.Type)
+	}
+	if len(got) != 1 || got[0] != OperationStart {
+		t.Fatalf("received %v, want [%s]", got, OperationStart)
+	}
+
+	history, ch, _ := Subscribe(id)
+	if ch != nil {
+		t.Fatal("subscribe to closed stream returned channel")
+	}
+	if len(history) != 1 {
+		t.Fatalf("replay history length = %d, want 1", len(history))
+	}
+}
@@ -16,6 +16,7 @@ limitations under the License.
 package executor
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -35,10 +36,11 @@ var (
 type Executor interface {
 	// 执行 run 命令，返回 stdout 和 stderr
 	// 如果 cmd 超时不能退出，会返回 error，默认超时时间为 60 秒
-	Execute(cmd string, sudo bool, timeout ...time.Duration) (stdout []byte, stderr []byte, err error)
+	// 上下文取消或到期时终止命令并返回 error
+	Execute(ctx context.Context, cmd string, sudo bool, timeout ...time.Duration) (stdout []byte, stderr []byte, err error)
 
-	// 从或向目标传输副本文件
-	Transfer(src, dst string, download bool, limit int) error
+	// 从或向目标传输副本文件，上下文取消或到期时中断传输
+	Transfer(ctx context.Context, src, dst string, download bool, limit int) error
 }
 
 // 创建 SSH executor
@@ -62,7 +64,7 @@ func NewSSHExecutor(sudo bool, c SSHConfig) (Executor, error) {
 }
 
 // FindSSHAuthorizedKeysFile 找到 SSH 授权密钥文件的正确路径
-func FindSSHAuthorizedKeysFile(exec Executor) string {
+func FindSSHAuthorizedKeysFile(ctx context.Context, exec Executor) string {
 	// 检测是否设置了授权密钥文件的自定义路径
 	// NOTE: we do not yet support:
 	//   - custom config for user (~/.ssh/config)
@@ -72,7 +74,7 @@ func FindSSHAuthorizedKeysFile(exec Executor) string {
 	cmd := "grep -Ev '^\\s*#|^\\s*$' /etc/ssh/sshd_config"
 
 	// 错误被忽略，因为有默认值
-	stdout, _, _ := exec.Execute(cmd, true)
+	stdout, _, _ := exec.Execute(ctx, cmd, true)
 	for _, line := range strings.Split(string(stdout), "\n") {
 		if !strings.Contains(line, "AuthorizedKeysFile") {
 			continue
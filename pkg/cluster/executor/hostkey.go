@@ -0,0 +1,99 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package executor
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrSSHHostKeyUntrusted = errNSSSH.NewType("host_key_untrusted")
+	ErrSSHHostKeyMismatch  = errNSSSH.NewType("host_key_mismatch")
+
+	// 获取主机公钥后中断 SSH 握手
+	errHostKeyScanned = errors.New("host key scanned")
+)
+
+// HostKeyCallback 按已信任的主机公钥指纹（SHA256）校验主机公钥
+// 指纹为空表示主机未信任，拒绝连接
+func HostKeyCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		actual := ssh.FingerprintSHA256(key)
+		if fingerprint == "" {
+			return ErrSSHHostKeyUntrusted.New("host key of %s is not trusted, fingerprint %s, trust the host first (POST /v1/machine/hostkey/backfill for machines added before host key checking)", hostname, actual)
+		}
+		if actual != fingerprint {
+			return ErrSSHHostKeyMismatch.New("host key of %s mismatch, expected %s, got %s, re-trust the host if it was reinstalled", hostname, fingerprint, actual)
+		}
+		return nil
+	}
+}
+
+// DialSSH 建立 SSH 连接，proxy 非 nil 时通过跳板机连接
+// SSH 握手错误不保留错误类型，主机公钥校验失败时返回校验错误
+func DialSSH(addr string, config *ssh.ClientConfig, proxy *SSHProxyConfig) (*ssh.Client, error) {
+	var keyErr error
+	cfg := *config
+	cfg.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := config.HostKeyCallback(hostname, remote, key); err != nil {
+			keyErr = err
+			return err
+		}
+		return nil
+	}
+
+	var (
+		client *ssh.Client
+		err    error
+	)
+	if proxy != nil {
+		client, err = proxy.Dial(addr, &cfg)
+	} else {
+		client, err = ssh.Dial("tcp", addr, &cfg)
+	}
+	if err != nil && keyErr != nil {
+		return nil, keyErr
+	}
+	return client, err
+}
+
+// ScanHostKey 获取主机公钥，proxy 非 nil 时通过跳板机获取（跳板机公钥需已信任）
+func ScanHostKey(addr string, proxy *SSHProxyConfig, timeout time.Duration) (ssh.PublicKey, error) {
+	var hostKey ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User:    "dmgr",
+		Timeout: timeout,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errHostKeyScanned
+		},
+	}
+
+	var err error
+	if proxy != nil {
+		_, err = proxy.Dial(addr, config)
+	} else {
+		_, err = ssh.Dial("tcp", addr, config)
+	}
+	if hostKey != nil {
+		return hostKey, nil
+	}
+	return nil, err
+}
@@ -19,10 +19,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"os/exec"
 	"os/user"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/joomcode/errorx"
@@ -39,6 +42,8 @@ type Local struct {
 	Locale string // the locale used when executing the command
 }
 
+var _ Executor = &Local{}
+
 func NewLocalExecutor(host string, user string, sudo bool) *Local {
 	return &Local{
 		Host:   host,
@@ -49,115 +54,194 @@ func NewLocalExecutor(host string, user string, sudo bool) *Local {
 }
 
 // Execute implements Executor interface.
-func (l *Local) Execute(cmd string, execTimeout int) ([]byte, []byte, error) {
-	// try to acquire root permission
-	if l.Sudo {
-		cmd = fmt.Sprintf("sudo -H -u root bash -c \"cd; %s\"", cmd)
-	} else {
-		cmd = fmt.Sprintf("sudo -H -u %s bash -c \"cd; %s\"", l.User, cmd)
+// 上下文取消或到期以及命令超时时终止命令所在进程组
+func (l *Local) Execute(ctx context.Context, cmd string, sudo bool, execTimeout ...time.Duration) ([]byte, []byte, error) {
+	// 以 root 或执行器用户运行，与当前用户相同时无需 sudo
+	runUser := l.User
+	if l.Sudo || sudo {
+		runUser = "root"
+	}
+	current, err := user.Current()
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// set a basic PATH in case it's empty on login
-	cmd = fmt.Sprintf("PATH=$PATH:/usr/bin:/usr/sbin %s", cmd)
-
+	script := fmt.Sprintf("cd; export PATH=$PATH:/usr/bin:/usr/sbin; %s", cmd)
 	if l.Locale != "" {
-		cmd = fmt.Sprintf("export LANG=%s; %s", l.Locale, cmd)
+		script = fmt.Sprintf("cd; export PATH=$PATH:/usr/bin:/usr/sbin; export LANG=%s; %s", l.Locale, cmd)
 	}
 
-	// run command on remote host
-	// default timeout is 60s
-	if execTimeout == 0 {
-		execTimeout = DefaultExecuteTimeout
+	// 命令作为 bash -c 的独立参数，不经过外层 shell 解析，命令中的引号、$ 以及反引号保持原样
+	args := []string{"bash", "-c", script}
+	if current.Username != runUser {
+		args = append([]string{"sudo", "-H", "-u", runUser}, args...)
 	}
 
-	ctx := context.Background()
-	var cancel context.CancelFunc
-	ctx, cancel = context.WithTimeout(context.Background(), time.Duration(execTimeout)*time.Second)
-	defer cancel()
-
-	command := exec.CommandContext(ctx, "/bin/sh", "-c", cmd)
-
-	stdout := new(bytes.Buffer)
-	stderr := new(bytes.Buffer)
-	command.Stdout = stdout
-	command.Stderr = stderr
+	// default timeout is 60s
+	if len(execTimeout) == 0 {
+		execTimeout = append(execTimeout, time.Duration(DefaultExecuteTimeout)*time.Second)
+	}
 
-	err := command.Run()
+	stdout, stderr, done, err := l.run(ctx, args, execTimeout[0])
 
+	// 日志以及错误中的敏感参数脱敏
+	logCmd, logStdout, logStderr := Redact(ctx, strings.Join(args, " ")), Redact(ctx, stdout), Redact(ctx, stderr)
 	dmgrutil.Logger.Info("LocalCommand",
-		zap.String("cmd", cmd),
+		zap.String("cmd", logCmd),
 		zap.Error(err),
-		zap.String("stdout", stdout.String()),
-		zap.String("stderr", stderr.String()))
+		zap.String("stdout", logStdout),
+		zap.String("stderr", logStderr))
 
 	if err != nil {
-		sshErr := ErrSSHExecuteFailed.
-			Wrap(err, "Failed to execute command locally").
-			WithProperty(ErrPropSSHCommand, cmd).
-			WithProperty(ErrPropSSHStdout, stdout).
-			WithProperty(ErrPropSSHStderr, stderr)
-		if len(stdout.Bytes()) > 0 || len(stderr.Bytes()) > 0 {
-			output := strings.TrimSpace(strings.Join([]string{stdout.String(), stderr.String()}, "\n"))
-			sshErr = sshErr.
-				WithProperty(
-					errorx.RegisterPrintableProperty(
-						fmt.Sprintf("Command output on remote host %s", l.Host)),
-					output)
-		}
-		return stdout.Bytes(), stderr.Bytes(), sshErr
+		return []byte(stdout), []byte(stderr), l.wrapError(ErrSSHExecuteFailed.Wrap(err, "Failed to execute command locally"), logCmd, logStdout, logStderr)
 	}
-
-	return stdout.Bytes(), stderr.Bytes(), err
+	// 上下文取消或到期
+	if !done && ctx.Err() != nil {
+		return []byte(stdout), []byte(stderr), l.wrapError(ErrSSHExecuteCanceled.Wrap(ctx.Err(), "Execute command locally canceled"), logCmd, logStdout, logStderr)
+	}
+	// 执行超时
+	if !done {
+		return []byte(stdout), []byte(stderr), l.wrapError(ErrSSHExecuteTimedout.New("Execute command locally timedout"), logCmd, logStdout, logStderr)
+	}
+	return []byte(stdout), []byte(stderr), nil
 }
 
 // Transfer implements Executer interface.
-func (l *Local) Transfer(src string, dst string, download bool, limit int) error {
+// 本机复制文件或目录（递归），保留文件权限，上传时属主修改为执行器用户
+func (l *Local) Transfer(ctx context.Context, src, dst string, download bool, limit int) error {
 	targetPath := filepath.Dir(dst)
 	if err := dmgrutil.CreateDir(targetPath); err != nil {
 		return err
 	}
 
-	cmd := ""
+	var args []string
 	user, err := user.Current()
 	if err != nil {
 		return err
 	}
-	if download || user.Username == l.User {
-		cmd = fmt.Sprintf("cp %s %s", src, dst)
-	} else {
-		cmd = fmt.Sprintf("sudo -H -u root bash -c \"cp %[1]s %[2]s && chown %[3]s:$(id -g -n %[3]s) %[2]s\"", src, dst, l.User)
+	switch {
+	case download || user.Username == l.User:
+		args = []string{"cp", "-rp", src, dst}
+	case user.Username == "root":
+		args = []string{"bash", "-c", fmt.Sprintf("cp -rp %[1]s %[2]s && chown -R %[3]s:$(id -g -n %[3]s) %[2]s", src, dst, l.User)}
+	default:
+		args = []string{"sudo", "-H", "-u", "root", "bash", "-c", fmt.Sprintf("cp -rp %[1]s %[2]s && chown -R %[3]s:$(id -g -n %[3]s) %[2]s", src, dst, l.User)}
 	}
 
-	command := exec.Command("/bin/sh", "-c", cmd)
-	stdout := new(bytes.Buffer)
-	stderr := new(bytes.Buffer)
-	command.Stdout = stdout
-	command.Stderr = stderr
-
-	err = command.Run()
+	stdout, stderr, done, err := l.run(ctx, args, time.Duration(DefaultExecuteTimeout)*time.Second)
 
+	// 日志以及错误中的敏感参数脱敏
+	logCmd, logStdout, logStderr := Redact(ctx, strings.Join(args, " ")), Redact(ctx, stdout), Redact(ctx, stderr)
 	dmgrutil.Logger.Info("CPCommand",
-		zap.String("cmd", cmd),
+		zap.String("cmd", logCmd),
 		zap.Error(err),
-		zap.String("stdout", stdout.String()),
-		zap.String("stderr", stderr.String()))
+		zap.String("stdout", logStdout),
+		zap.String("stderr", logStderr))
 
 	if err != nil {
-		sshErr := ErrSSHExecuteFailed.
-			Wrap(err, "Failed to transfer file over local cp").
-			WithProperty(ErrPropSSHCommand, cmd).
-			WithProperty(ErrPropSSHStdout, stdout).
-			WithProperty(ErrPropSSHStderr, stderr)
-		if len(stdout.Bytes()) > 0 || len(stderr.Bytes()) > 0 {
-			output := strings.TrimSpace(strings.Join([]string{stdout.String(), stderr.String()}, "\n"))
-			sshErr = sshErr.
-				WithProperty(
-					errorx.RegisterPrintableProperty(
-						fmt.Sprintf("Command output on remote host %s", l.Host)),
-					output)
-		}
-		return sshErr
+		return l.wrapError(ErrSSHExecuteFailed.Wrap(err, "Failed to transfer file over local cp"), logCmd, logStdout, logStderr)
+	}
+	if !done && ctx.Err() != nil {
+		return l.wrapError(ErrSSHExecuteCanceled.Wrap(ctx.Err(), "Transfer file over local cp canceled"), logCmd, logStdout, logStderr)
+	}
+	if !done {
+		return l.wrapError(ErrSSHExecuteTimedout.New("Transfer file over local cp timedout"), logCmd, logStdout, logStderr)
+	}
+	return nil
+}
+
+// 在本机以参数列表运行命令，返回命令是否运行结束
+// 命令超时或者上下文取消时，向命令所在进程组发送 SIGKILL
+func (l *Local) run(ctx context.Context, args []string, timeout time.Duration) (string, string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", "", false, nil
+	}
+
+	command := exec.Command(args[0], args[1:]...)
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Start(); err != nil {
+		return "", "", false, err
 	}
 
+	waitC := make(chan error, 1)
+	go func() {
+		waitC <- command.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-waitC:
+		return stdout.String(), stderr.String(), true, err
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	_ = syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+	<-waitC
+	return stdout.String(), stderr.String(), false, nil
+}
+
+func (l *Local) wrapError(err *errorx.Error, cmd, stdout, stderr string) error {
+	err = err.
+		WithProperty(ErrPropSSHCommand, cmd).
+		WithProperty(ErrPropSSHStdout, stdout).
+		WithProperty(ErrPropSSHStderr, stderr)
+	if len(stdout) > 0 || len(stderr) > 0 {
+		output := strings.TrimSpace(strings.Join([]string{stdout, stderr}, "\n"))
+		err = err.
+			WithProperty(
+				errorx.RegisterPrintableProperty(
+					fmt.Sprintf("Command output on local host %s", l.Host)),
+				output)
+	}
 	return err
 }
+
+// 主机是否为本机的判断结果，按主机缓存，域名解析或获取本机网卡地址失败时不缓存
+var localHosts sync.Map
+
+// IsLocalHost 主机是否为 dmgr 所在的本机
+func IsLocalHost(host string) bool {
+	if local, ok := localHosts.Load(host); ok {
+		return local.(bool)
+	}
+	local, err := isLocalHost(host)
+	if err != nil {
+		return false
+	}
+	localHosts.Store(host, local)
+	return local
+}
+
+func isLocalHost(host string) (bool, error) {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = net.LookupIP(host); err != nil {
+			return false, err
+		}
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false, err
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() {
+			return true, nil
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
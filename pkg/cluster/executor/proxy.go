@@ -0,0 +1,106 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package executor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHProxyConfig SSH 跳板机配置
+type SSHProxyConfig struct {
+	Host        string // 跳板机主机名
+	Port        int    // 跳板机端口，默认 22
+	User        string // 跳板机用户名
+	Password    string // 跳板机用户密码
+	KeyFile     string // 跳板机私有密钥文件，优先使用私钥认证
+	Passphrase  string // 跳板机私有密钥密码
+	Fingerprint string // 跳板机已信任的主机公钥指纹
+}
+
+// Addr 跳板机地址
+func (p *SSHProxyConfig) Addr() string {
+	port := p.Port
+	if port <= 0 {
+		port = 22
+	}
+	return net.JoinHostPort(p.Host, strconv.Itoa(port))
+}
+
+// Dial 通过跳板机建立到目标地址的 SSH 连接，目标连接关闭时关闭跳板机连接
+func (p *SSHProxyConfig) Dial(addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	proxyConfig, err := NewSSHClientConfig(p.User, p.KeyFile, p.Passphrase, p.Password, p.Fingerprint, config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	proxyClient, err := DialSSH(p.Addr(), proxyConfig, nil)
+	if err != nil {
+		return nil, fmt.Errorf("connect to proxy %s@%s failed: %v", p.User, p.Addr(), err)
+	}
+
+	conn, err := proxyClient.Dial("tcp", addr)
+	if err != nil {
+		_ = proxyClient.Close()
+		return nil, fmt.Errorf("dial %s through proxy %s failed: %v", addr, p.Addr(), err)
+	}
+	ncc, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		_ = conn.Close()
+		_ = proxyClient.Close()
+		return nil, err
+	}
+
+	client := ssh.NewClient(ncc, chans, reqs)
+	go func() {
+		_ = client.Wait()
+		_ = proxyClient.Close()
+	}()
+	return client, nil
+}
+
+// NewSSHClientConfig 生成 SSH 客户端配置，有私钥优先使用私钥认证，按已信任的主机公钥指纹校验主机
+func NewSSHClientConfig(user, keyFile, passphrase, password, fingerprint string, timeout time.Duration) (*ssh.ClientConfig, error) {
+	config := &ssh.ClientConfig{
+		User:            user,
+		Timeout:         timeout,
+		HostKeyCallback: HostKeyCallback(fingerprint),
+	}
+
+	if len(keyFile) > 0 {
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read private key: %v", err)
+		}
+		var signer ssh.Signer
+		if len(passphrase) > 0 {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse private key: %v", err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	} else if len(password) > 0 {
+		config.Auth = append(config.Auth, ssh.Password(password))
+	}
+	return config, nil
+}
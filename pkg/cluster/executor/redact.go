@@ -0,0 +1,101 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package executor
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// 敏感参数脱敏后的值
+	redactedValue = "******"
+	// 敏感参数最小长度，过短的敏感参数按子串替换会误替换正常输出
+	minSecretLength = 4
+)
+
+// 命令中的密码参数，如 --password=xxx、password=xxx、IDENTIFIED BY 'xxx'
+var secretArgRegexp = regexp.MustCompile(`(?i)(--?passw(?:or)?d[= ]|\bpassw(?:or)?d=|identified by\s+)('[^']*'|"[^"]*"|[^\s;&|]+)`)
+
+type (
+	secretsKey      struct{}
+	secretSourceKey struct{}
+)
+
+// SecretSource 运行期间可追加的敏感参数集合，如集群操作渲染配置文件、连接跳板机时标记的密码
+type SecretSource struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// Add 追加敏感参数
+func (s *SecretSource) Add(secrets ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, secret := range secrets {
+		if secret != "" {
+			s.secrets = append(s.secrets, secret)
+		}
+	}
+}
+
+func (s *SecretSource) list() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string{}, s.secrets...)
+}
+
+// WithSecretSource 返回关联敏感参数集合的上下文，集合之后追加的敏感参数同样脱敏
+func WithSecretSource(ctx context.Context, source *SecretSource) context.Context {
+	return context.WithValue(ctx, secretSourceKey{}, source)
+}
+
+// WithSecrets 返回标记敏感参数的上下文，可多次标记
+// 使用该上下文执行命令时，命令日志、错误以及命令执行记录中的敏感参数替换为 ******
+func WithSecrets(ctx context.Context, secrets ...string) context.Context {
+	marked := append([]string{}, contextSecrets(ctx)...)
+	for _, s := range secrets {
+		if s != "" {
+			marked = append(marked, s)
+		}
+	}
+	return context.WithValue(ctx, secretsKey{}, marked)
+}
+
+func contextSecrets(ctx context.Context) []string {
+	secrets, _ := ctx.Value(secretsKey{}).([]string)
+	if source, ok := ctx.Value(secretSourceKey{}).(*SecretSource); ok {
+		secrets = append(append([]string{}, secrets...), source.list()...)
+	}
+	return secrets
+}
+
+// Redact 替换上下文标记的敏感参数以及命令中的密码参数，较长的敏感参数优先替换
+// 长度小于 minSecretLength 的敏感参数不做替换
+func Redact(ctx context.Context, s string) string {
+	secrets := append([]string{}, contextSecrets(ctx)...)
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	for _, secret := range secrets {
+		if len(secret) < minSecretLength {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret, redactedValue)
+	}
+	return secretArgRegexp.ReplaceAllString(s, "${1}"+redactedValue)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package executor
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRedactMarkedSecrets(t *testing.T) {
+	ctx := WithSecrets(context.Background(), "Pa55word", "Pa55")
+	source := &SecretSource{}
+	ctx = WithSecretSource(ctx, source)
+	// 上下文创建后追加的敏感参数同样脱敏
+	source.Add("proxy-secret", "")
+
+	got := Redact(ctx, "login Pa55word via proxy-secret, then Pa55")
+	want := "login ****** via ******, then ******"
+	if got != want {
+		t.Fatalf("Redact() = %q, want %q", got, want)
+	}
+}
+
+func TestRedactSkipsShortSecrets(t *testing.T) {
+	ctx := WithSecrets(context.Background(), "1", "abc")
+	in := "listen 127.0.0.1:8261, abcd"
+	if got := Redact(ctx, in); got != in {
+		t.Fatalf("short secrets redacted: %q", got)
+	}
+	// 过短的密码出现在密码参数中时仍按密码参数脱敏
+	if got := Redact(ctx, "mysql --password=abc -h 127.0.0.1"); got != "mysql --password=****** -h 127.0.0.1" {
+		t.Fatalf("password argument not redacted: %q", got)
+	}
+}
+
+func TestRedactPasswordArguments(t *testing.T) {
+	ctx := context.Background()
+	for in, want := range map[string]string{
+		`mysql -uroot --password=secret -e "select 1"`:       `mysql -uroot --password=****** -e "select 1"`,
+		`dmctl --passwd secret operate-source`:               `dmctl --passwd ****** operate-source`,
+		`echo password=secret;ls`:                            `echo password=******;ls`,
+		`CREATE USER 'u'@'%' IDENTIFIED BY 'se cret'`:        `CREATE USER 'u'@'%' IDENTIFIED BY ******`,
+		`alter user u identified by "secret" && echo done`:   `alter user u identified by ****** && echo done`,
+		`grep -r passwords /etc/dm && echo user_password_at`: `grep -r passwords /etc/dm && echo user_password_at`,
+	} {
+		if got := Redact(ctx, in); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
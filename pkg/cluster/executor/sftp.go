@@ -0,0 +1,241 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package executor
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+)
+
+// 默认单次文件传输带宽上限，单位 Kbit/s，与 scp -l 一致，0 表示不限制
+var defaultTransferLimit int
+
+// InitTransferLimit 初始化默认单次文件传输带宽上限
+func InitTransferLimit(cfg *dmgrutil.OperationConfig) {
+	defaultTransferLimit = cfg.TransferLimit
+}
+
+// TransferProgress 文件传输进度，transferred 为已传输字节数，total 为总字节数
+type TransferProgress func(transferred, total int64)
+
+type progressKey struct{}
+
+// WithTransferProgress 返回带文件传输进度回调的上下文
+func WithTransferProgress(ctx context.Context, progress TransferProgress) context.Context {
+	return context.WithValue(ctx, progressKey{}, progress)
+}
+
+// 单次文件传输，多个文件共享带宽上限以及传输进度
+type transfer struct {
+	ctx         context.Context
+	bytesPerSec int64
+	start       time.Time
+	transferred int64
+	total       int64
+	progress    TransferProgress
+}
+
+func newTransfer(ctx context.Context, limit int) *transfer {
+	t := &transfer{ctx: ctx, start: time.Now()}
+	if limit > 0 {
+		t.bytesPerSec = int64(limit) * 1024 / 8
+	}
+	if p, ok := ctx.Value(progressKey{}).(TransferProgress); ok {
+		t.progress = p
+	}
+	return t
+}
+
+// 复制文件内容，按带宽上限限速并上报传输进度
+func (t *transfer) copy(dst io.Writer, src io.Reader) error {
+	bufSize := int64(32 * 1024)
+	if t.bytesPerSec > 0 && t.bytesPerSec < bufSize {
+		bufSize = t.bytesPerSec
+	}
+	buf := make([]byte, bufSize)
+	for {
+		n, rerr := src.Read(buf)
+		if n > 0 {
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+			t.transferred += int64(n)
+			if t.progress != nil {
+				t.progress(t.transferred, t.total)
+			}
+			if err := t.throttle(); err != nil {
+				return err
+			}
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// 传输速度超过带宽上限时等待，上下文取消或到期时返回
+func (t *transfer) throttle() error {
+	if t.bytesPerSec <= 0 {
+		return t.ctx.Err()
+	}
+	expected := time.Duration(float64(t.transferred) / float64(t.bytesPerSec) * float64(time.Second))
+	wait := expected - time.Since(t.start)
+	if wait <= 0 {
+		return t.ctx.Err()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	}
+}
+
+// SFTPUpload 通过 SFTP 上传本地文件或目录（递归）至远程，保留文件权限
+func SFTPUpload(ctx context.Context, client *sftp.Client, src, dst string, limit int) error {
+	t := newTransfer(ctx, limit)
+	if err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			t.total += info.Size()
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join(dst, filepath.ToSlash(rel))
+
+		switch {
+		case info.IsDir():
+			if err := client.MkdirAll(target); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if err := t.uploadFile(client, p, target); err != nil {
+				return err
+			}
+		default:
+			// 忽略软链接等特殊文件
+			return nil
+		}
+		return client.Chmod(target, info.Mode().Perm())
+	})
+}
+
+func (t *transfer) uploadFile(client *sftp.Client, src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := client.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	if err := t.copy(dstFile, srcFile); err != nil {
+		return err
+	}
+	return dstFile.Close()
+}
+
+// SFTPDownload 通过 SFTP 下载远程文件或目录（递归）至本地，保留文件权限
+func SFTPDownload(ctx context.Context, client *sftp.Client, src, dst string, limit int) error {
+	t := newTransfer(ctx, limit)
+	walker := client.Walk(src)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		if info := walker.Stat(); info.Mode().IsRegular() {
+			t.total += info.Size()
+		}
+	}
+
+	walker = client.Walk(src)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		info := walker.Stat()
+		rel, err := filepath.Rel(src, walker.Path())
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			if err := dmgrutil.CreateDir(target); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if err := dmgrutil.CreateDir(filepath.Dir(target)); err != nil {
+				return err
+			}
+			if err := t.downloadFile(client, walker.Path(), target, info.Mode().Perm()); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		if err := os.Chmod(target, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *transfer) downloadFile(client *sftp.Client, src, dst string, mode os.FileMode) error {
+	srcFile, err := client.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	if err := t.copy(dstFile, srcFile); err != nil {
+		return err
+	}
+	return dstFile.Sync()
+}
@@ -16,9 +16,13 @@ limitations under the License.
 package executor
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pingcap/errors"
@@ -30,6 +34,8 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/appleboy/easyssh-proxy"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
 )
 
 const (
@@ -37,6 +43,8 @@ const (
 	DefaultExecuteTimeout = 60
 	// 默认 SSH 连接超时时间，单位：秒
 	DefaultConnectTimeout = 10
+	// 命令执行超时终止后等待远程会话关闭的时间，超时未关闭则关闭连接
+	sessionCloseTimeout = 5 * time.Second
 )
 
 var (
@@ -46,6 +54,7 @@ var (
 	ErrPropSSHStderr      = errorx.RegisterPrintableProperty("ssh_stderr")
 	ErrSSHExecuteFailed   = errNSSSH.NewType("execute_failed")
 	ErrSSHExecuteTimedout = errNSSSH.NewType("execute_timeout")
+	ErrSSHExecuteCanceled = errNSSSH.NewType("execute_canceled")
 )
 
 // EasySSHExecutor 实现 EasySSH Executor 作为 SSH 传输协议层
@@ -54,29 +63,54 @@ type (
 		Config *easyssh.MakeConfig
 		Locale string // 执行命令时使用的语言环境
 		Sudo   bool   // 使用此执行程序运行的所有命令是否使用 sudo
+
+		sudoPassword string // sudo 密码，空表示免密 sudo
+
+		// 配置 sudo 密码时，sudo 是否实际需要密码的探测结果
+		sudoProbe struct {
+			sync.Mutex
+			probed        bool
+			needsPassword bool
+		}
+
+		// 复用的 SSH 连接，所有命令以及文件传输在该连接上创建会话
+		mu     sync.Mutex
+		client *ssh.Client
+		proxy  *SSHProxyConfig // SSH 跳板机，nil 表示直连
 	}
 
 	// SSHConfig 是建立 SSH 连接所需的配置
 	SSHConfig struct {
-		Host           string        // SSH 服务器的主机名
-		Port           int           // SSH 服务器的主机端口
-		User           string        // SSH 服务器的用户名
-		Password       string        // SSH 服务器的用户密码
-		KeyFile        string        // SSH 私有密钥文件
-		Passphrase     string        // SSH 私有密钥密码
-		ConnectTimeout time.Duration // TCP 连接建立的最长时间
-		ExecuteTimeout time.Duration // 命令完成的最长时间
-
+		Host           string          // SSH 服务器的主机名
+		Port           int             // SSH 服务器的主机端口
+		User           string          // SSH 服务器的用户名
+		Password       string          // SSH 服务器的用户密码
+		KeyFile        string          // SSH 私有密钥文件
+		Passphrase     string          // SSH 私有密钥密码
+		ConnectTimeout time.Duration   // TCP 连接建立的最长时间
+		ExecuteTimeout time.Duration   // 命令完成的最长时间
+		Proxy          *SSHProxyConfig // SSH 跳板机，nil 表示直连
+		Fingerprint    string          // 已信任的主机公钥指纹 SHA256，为空拒绝连接
+		SudoPassword   string          // SSH 用户 sudo 密码，空表示免密 sudo
 	}
 )
 
 var _ Executor = &EasySSHExecutor{}
 
 // 通过 SSH 执行运行命令，默认情况下它不调用任何特定的 shell
-func (e *EasySSHExecutor) Execute(cmd string, sudo bool, execTimeout ...time.Duration) ([]byte, []byte, error) {
+func (e *EasySSHExecutor) Execute(ctx context.Context, cmd string, sudo bool, execTimeout ...time.Duration) ([]byte, []byte, error) {
 	// 尝试获取 root 权限
+	// sudo 需要密码时 sudo 密码通过标准输入传递，避免出现在远程主机进程列表以及命令日志中
+	// -k 忽略已缓存的 sudo 凭据，确保 sudo 读取密码，避免密码成为命令的标准输入
+	stdin := ""
 	if e.Sudo || sudo {
-		cmd = fmt.Sprintf("sudo -H bash -c \"%s\"", cmd)
+		if e.sudoPassword != "" && e.sudoNeedsPassword(ctx) {
+			ctx = WithSecrets(ctx, e.sudoPassword)
+			cmd = fmt.Sprintf("sudo -k -S -p '' -H bash -c \"%s\"", cmd)
+			stdin = e.sudoPassword + "\n"
+		} else {
+			cmd = fmt.Sprintf("sudo -H bash -c \"%s\"", cmd)
+		}
 	}
 
 	//设置一个基本的 PATH 以防在登录时为空
@@ -87,27 +121,30 @@ func (e *EasySSHExecutor) Execute(cmd string, sudo bool, execTimeout ...time.Dur
 	}
 
 	// 在远程主机上运行命令
-	// easyssh-proxy 中的默认超时时间为 60 秒
+	// 默认超时时间为 60 秒
 	if len(execTimeout) == 0 {
 		execTimeout = append(execTimeout, time.Duration(DefaultExecuteTimeout)*time.Second)
 	}
 
-	stdout, stderr, done, err := e.Config.Run(cmd, execTimeout...)
+	stdout, stderr, done, err := e.run(ctx, cmd, stdin, execTimeout[0])
+
+	// 日志以及错误中的敏感参数脱敏
+	logCmd, logStdout, logStderr := Redact(ctx, cmd), Redact(ctx, stdout), Redact(ctx, stderr)
 	dmgrutil.Logger.Info("SSHCommand",
 		zap.String("host", e.Config.Server),
 		zap.String("port", e.Config.Port),
-		zap.String("cmd", cmd),
+		zap.String("cmd", logCmd),
 		zap.Error(err),
-		zap.String("stdout", stdout),
-		zap.String("stderr", stderr))
+		zap.String("stdout", logStdout),
+		zap.String("stderr", logStderr))
 	if err != nil {
 		sshErr := ErrSSHExecuteFailed.
 			Wrap(err, "Failed to execute command over SSH for '%s@%s:%s'", e.Config.User, e.Config.Server, e.Config.Port).
-			WithProperty(ErrPropSSHCommand, cmd).
-			WithProperty(ErrPropSSHStdout, stdout).
-			WithProperty(ErrPropSSHStderr, stderr)
+			WithProperty(ErrPropSSHCommand, logCmd).
+			WithProperty(ErrPropSSHStdout, logStdout).
+			WithProperty(ErrPropSSHStderr, logStderr)
 		if len(stdout) > 0 || len(stderr) > 0 {
-			output := strings.TrimSpace(strings.Join([]string{stdout, stderr}, "\n"))
+			output := strings.TrimSpace(strings.Join([]string{logStdout, logStderr}, "\n"))
 			sshErr = sshErr.
 				WithProperty(
 					errorx.RegisterPrintableProperty(
@@ -116,50 +153,248 @@ func (e *EasySSHExecutor) Execute(cmd string, sudo bool, execTimeout ...time.Dur
 		}
 		return []byte(stdout), []byte(stderr), sshErr
 	}
+	// 上下文取消或到期
+	if !done && ctx.Err() != nil {
+		return []byte(stdout), []byte(stderr), ErrSSHExecuteCanceled.
+			Wrap(ctx.Err(), "Execute command over SSH canceled for '%s@%s:%s'", e.Config.User, e.Config.Server, e.Config.Port).
+			WithProperty(ErrPropSSHCommand, logCmd).
+			WithProperty(ErrPropSSHStdout, logStdout).
+			WithProperty(ErrPropSSHStderr, logStderr)
+	}
 	// 执行超时
 	if !done {
 		return []byte(stdout), []byte(stderr), ErrSSHExecuteTimedout.
 			Wrap(err, "Execute command over SSH timedout for '%s@%s:%s'", e.Config.User, e.Config.Server, e.Config.Port).
-			WithProperty(ErrPropSSHCommand, cmd).
-			WithProperty(ErrPropSSHStdout, stdout).
-			WithProperty(ErrPropSSHStderr, stderr)
+			WithProperty(ErrPropSSHCommand, logCmd).
+			WithProperty(ErrPropSSHStdout, logStdout).
+			WithProperty(ErrPropSSHStderr, logStderr)
 	}
 
 	return []byte(stdout), []byte(stderr), nil
 }
 
-// 通过 SCP 传输副本文件
-// 此函数依赖于 `scp`（来自 OpenSSH 或其他 SSH 实现的工具）
-// 该函数基于　easyssh.MakeConfig.Scp()　但支持复制到远程的文件
-func (e *EasySSHExecutor) Transfer(src, dst string, download bool, limit int) error {
-	// Call Scp method with file you want to upload to remote server.
+// 配置 sudo 密码时通过 sudo -n 探测 sudo 是否需要密码，免密 sudo 时不传递密码
+// 仅缓存明确的探测结果，探测未运行结束或失败原因不明确（如 sudo 不存在、requiretty）时按需要密码处理
+func (e *EasySSHExecutor) sudoNeedsPassword(ctx context.Context) bool {
+	e.sudoProbe.Lock()
+	defer e.sudoProbe.Unlock()
+	if e.sudoProbe.probed {
+		return e.sudoProbe.needsPassword
+	}
+
+	_, stderr, done, err := e.run(ctx, "sudo -n true", "", time.Duration(DefaultConnectTimeout)*time.Second)
+	if !done {
+		return true
+	}
+	switch {
+	case err == nil:
+		e.sudoProbe.probed, e.sudoProbe.needsPassword = true, false
+	case sudoPasswordRequired(err, stderr):
+		e.sudoProbe.probed, e.sudoProbe.needsPassword = true, true
+	default:
+		dmgrutil.Logger.Warn("SSHSudoProbe", zap.String("host", e.Config.Server), zap.String("stderr", stderr), zap.Error(err))
+		return true
+	}
+	dmgrutil.Logger.Info("SSHSudoProbe", zap.String("host", e.Config.Server), zap.Bool("needs password", e.sudoProbe.needsPassword))
+	return e.sudoProbe.needsPassword
+}
+
+// sudo -n 因需要密码失败时退出码为 1，标准错误输出 a password is required
+func sudoPasswordRequired(err error, stderr string) bool {
+	exitErr, ok := err.(*ssh.ExitError)
+	return ok && exitErr.ExitStatus() == 1 && strings.Contains(stderr, "a password is required")
+}
+
+// 在远程主机上运行命令，返回命令是否运行结束，stdin 不为空时作为命令的标准输入
+// 1、命令超时时向远程命令发送 SIGKILL 并关闭会话，会话未能关闭时关闭 SSH 连接
+// 2、上下文取消或到期时向远程命令发送 SIGKILL 并关闭 SSH 连接
+func (e *EasySSHExecutor) run(ctx context.Context, cmd, stdin string, timeout time.Duration) (string, string, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return "", "", false, nil
+	}
+
+	var session *ssh.Session
+	client, err := e.open(func(c *ssh.Client) (err error) {
+		session, err = c.NewSession()
+		return err
+	})
+	if err != nil {
+		return "", "", false, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if stdin != "" {
+		session.Stdin = strings.NewReader(stdin)
+	}
+	if err := session.Start(cmd); err != nil {
+		return "", "", false, err
+	}
+
+	waitC := make(chan error, 1)
+	go func() {
+		waitC <- session.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-waitC:
+		return stdout.String(), stderr.String(), true, err
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	// 终止远程命令，关闭会话或连接后等待输出读取结束
+	_ = session.Signal(ssh.SIGKILL)
+	_ = session.Close()
+	if ctx.Err() != nil {
+		e.invalidate(client)
+	} else {
+		grace := time.NewTimer(sessionCloseTimeout)
+		defer grace.Stop()
+		select {
+		case <-waitC:
+			return stdout.String(), stderr.String(), false, nil
+		case <-grace.C:
+			e.invalidate(client)
+		}
+	}
+	<-waitC
+	return stdout.String(), stderr.String(), false, nil
+}
+
+// 通过 SFTP 传输文件或目录，保留文件权限
+// limit 为单次传输带宽上限，单位 Kbit/s，小于等于 0 时使用默认带宽上限
+// 上下文取消或到期时关闭 SSH 连接，中断正在进行的传输
+func (e *EasySSHExecutor) Transfer(ctx context.Context, src, dst string, download bool, limit int) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Annotatef(err, "transfer %s to %s@%s:%s canceled", src, e.Config.User, e.Config.Server, dst)
+	}
+
+	var sftpClient *sftp.Client
+	client, err := e.open(func(c *ssh.Client) (err error) {
+		sftpClient, err = sftp.NewClient(c)
+		return err
+	})
+	if err != nil {
+		return errors.Annotatef(err, "failed to start sftp subsystem on %s@%s", e.Config.User, e.Config.Server)
+	}
+	defer sftpClient.Close()
+
+	stop := e.closeOnDone(ctx, client)
+	defer stop()
+
+	if limit <= 0 {
+		limit = defaultTransferLimit
+	}
 	if !download {
-		err := e.Config.Scp(src, dst)
-		if err != nil {
-			return errors.Annotatef(err, "failed to scp %s to %s@%s:%s", src, e.Config.User, e.Config.Server, dst)
+		err = SFTPUpload(ctx, sftpClient, src, dst, limit)
+	} else {
+		err = SFTPDownload(ctx, sftpClient, src, dst, limit)
+	}
+	if ctx.Err() != nil {
+		return errors.Annotatef(ctx.Err(), "transfer %s to %s@%s:%s canceled", src, e.Config.User, e.Config.Server, dst)
+	}
+	if err != nil {
+		return errors.Annotatef(err, "failed to sftp %s to %s@%s:%s", src, e.Config.User, e.Config.Server, dst)
+	}
+	return nil
+}
+
+// 上下文取消或到期时关闭 SSH 连接，返回停止监听函数
+func (e *EasySSHExecutor) closeOnDone(ctx context.Context, client *ssh.Client) func() {
+	stopC := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			e.invalidate(client)
+		case <-stopC:
 		}
-		return nil
+	}()
+	return func() {
+		close(stopC)
+	}
+}
+
+// 获取复用的 SSH 连接，连接不存在时建立连接并校验主机公钥
+func (e *EasySSHExecutor) connect() (*ssh.Client, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client != nil {
+		return e.client, nil
 	}
 
-	// download file from remote
-	session, client, err := e.Config.Connect()
+	config, err := NewSSHClientConfig(e.Config.User, e.Config.KeyPath, e.Config.Passphrase, e.Config.Password, e.Config.Fingerprint, e.Config.Timeout)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer client.Close()
-	defer session.Close()
+	client, err := DialSSH(net.JoinHostPort(e.Config.Server, e.Config.Port), config, e.proxy)
+	if err != nil {
+		return nil, err
+	}
+	e.client = client
+	return client, nil
+}
+
+// 在复用的 SSH 连接上打开会话，连接已断开时重新建立连接后重试一次
+// 连接仍可用时（如超出 sshd MaxSessions）直接返回错误，不影响该连接上的其他会话
+func (e *EasySSHExecutor) open(fn func(client *ssh.Client) error) (*ssh.Client, error) {
+	client, err := e.connect()
+	if err != nil {
+		return nil, err
+	}
+	if err = fn(client); err == nil || alive(client) {
+		return client, err
+	}
+
+	e.invalidate(client)
+	if client, err = e.connect(); err != nil {
+		return nil, err
+	}
+	return client, fn(client)
+}
+
+// 关闭并丢弃已断开或需要中断的 SSH 连接，下次使用时重新建立连接
+func (e *EasySSHExecutor) invalidate(client *ssh.Client) {
+	e.mu.Lock()
+	if e.client == client {
+		e.client = nil
+	}
+	e.mu.Unlock()
+	_ = client.Close()
+}
 
-	return ScpDownload(session, client, src, dst, limit)
+// Close 关闭复用的 SSH 连接
+func (e *EasySSHExecutor) Close() error {
+	e.mu.Lock()
+	client := e.client
+	e.client = nil
+	e.mu.Unlock()
+	if client == nil {
+		return nil
+	}
+	return client.Close()
 }
 
-//初始化构建并初始化一个 EasySSHExecutor
+// SSH 连接是否可用
+func alive(client *ssh.Client) bool {
+	_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+	return err == nil
+}
+
+// 初始化构建并初始化一个 EasySSHExecutor
 func (e *EasySSHExecutor) initialize(config SSHConfig) {
 	// 创建 easyssh 配置
 	e.Config = &easyssh.MakeConfig{
-		Server:  config.Host,
-		Port:    strconv.Itoa(config.Port),
-		User:    config.User,
-		Timeout: config.ConnectTimeout,
+		Server:      config.Host,
+		Port:        strconv.Itoa(config.Port),
+		User:        config.User,
+		Timeout:     config.ConnectTimeout,
+		Fingerprint: config.Fingerprint,
 	}
 
 	// 有私钥，优先使用私钥认证
@@ -169,4 +404,11 @@ func (e *EasySSHExecutor) initialize(config SSHConfig) {
 	} else if len(config.Password) > 0 {
 		e.Config.Password = config.Password
 	}
+
+	e.sudoPassword = config.SudoPassword
+
+	// 配置跳板机时通过跳板机建立连接
+	if config.Proxy != nil && len(config.Proxy.Host) > 0 {
+		e.proxy = config.Proxy
+	}
 }
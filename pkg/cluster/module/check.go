@@ -0,0 +1,323 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package module
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+)
+
+// 检查结果
+const (
+	CheckStatusPass = "pass"
+	CheckStatusWarn = "warn"
+	CheckStatusFail = "fail"
+)
+
+// 检查项
+const (
+	CheckNameConnect  = "connect"
+	CheckNameOS       = "os"
+	CheckNameSystemd  = "systemd"
+	CheckNameCommand  = "command"
+	CheckNameDisk     = "disk"
+	CheckNamePort     = "port"
+	CheckNameFirewall = "firewall"
+	CheckNameSysctl   = "sysctl"
+	CheckNameTHP      = "thp"
+	CheckNameTimeSync = "timesync"
+)
+
+const (
+	checkSysctlConfFile  = "/etc/sysctl.d/99-dmgr.conf"
+	checkTHPEnabledFile  = "/sys/kernel/mm/transparent_hugepage/enabled"
+	checkTHPDefragFile   = "/sys/kernel/mm/transparent_hugepage/defrag"
+	checkDiskFailBytes   = 1 << 30  // 可用空间小于 1GiB 检查失败
+	checkDiskWarnBytes   = 10 << 30 // 可用空间小于 10GiB 检查警告
+	checkSysctlSomaxconn = 32768
+)
+
+// 部署前环境检查命令，需要 root 权限
+var checkSections = []section{
+	{"ss", `command -v ss`},
+	{"firewalld", `systemctl is-active firewalld 2>/dev/null`},
+	{"firewall_ports", `firewall-cmd --list-ports 2>/dev/null`},
+	{"sysctl", `sysctl vm.swappiness net.core.somaxconn net.ipv4.tcp_syncookies 2>/dev/null`},
+	{"thp", `cat ` + checkTHPEnabledFile + ` 2>/dev/null`},
+}
+
+// 推荐的内核参数
+var checkSysctlParams = []struct {
+	key   string
+	value string
+	check func(v string) bool
+}{
+	{"vm.swappiness", "0", func(v string) bool { return v == "0" }},
+	{"net.core.somaxconn", strconv.Itoa(checkSysctlSomaxconn), func(v string) bool {
+		n, err := strconv.Atoi(v)
+		return err == nil && n >= checkSysctlSomaxconn
+	}},
+	{"net.ipv4.tcp_syncookies", "0", func(v string) bool { return v == "0" }},
+}
+
+// CheckModuleConfig 是用于初始化 CheckModule 的配置
+type CheckModuleConfig struct {
+	Ports []uint64 // 主机待部署实例端口
+	Dirs  []string // 主机待部署实例目录，检查所在文件系统可用空间
+	Apply bool     // 自动修复可修复的检查项
+}
+
+// CheckResult 单个检查项结果
+type CheckResult struct {
+	Name    string `json:"name"`    // 检查项
+	Status  string `json:"status"`  // 检查结果 pass、warn、fail
+	Message string `json:"message"` // 检查说明
+	Fixed   bool   `json:"fixed"`   // 已自动修复
+	fix     string // 自动修复命令，空表示不可自动修复
+}
+
+// CheckModule 用于部署或扩容前检查主机环境
+type CheckModule struct {
+	config CheckModuleConfig
+}
+
+// NewCheckModule 基于给定的配置构建并返回一个 CheckModule 对象
+func NewCheckModule(config CheckModuleConfig) *CheckModule {
+	return &CheckModule{config: config}
+}
+
+// Execute 采集主机信息并检查主机环境，返回主机信息以及检查结果，executor 应该已经初始化了
+// 自动修复时以 root 运行可修复检查项的修复命令，修复成功的检查项结果为 pass
+func (mod *CheckModule) Execute(ctx context.Context, exec executor.Executor) (HostFacts, []CheckResult, error) {
+	facts, err := NewFactsModule().Execute(ctx, exec)
+	if err != nil {
+		return facts, nil, err
+	}
+	stdout, _, err := exec.Execute(ctx, sectionsCommand(checkSections), true)
+	if err != nil {
+		return facts, nil, ErrFactsGatherFailed.Wrap(err, "Failed to check host environment")
+	}
+
+	results := mod.check(facts, parseSections(string(stdout)))
+	if !mod.config.Apply {
+		return facts, results, nil
+	}
+	for i := range results {
+		r := &results[i]
+		if r.Status == CheckStatusPass || r.fix == "" {
+			continue
+		}
+		if _, stderr, err := exec.Execute(ctx, r.fix, true); err != nil {
+			r.Message = fmt.Sprintf("%s, auto fix failed: %v %s", r.Message, err, strings.TrimSpace(string(stderr)))
+			continue
+		}
+		r.Status, r.Fixed = CheckStatusPass, true
+		r.Message = fmt.Sprintf("%s, fixed", r.Message)
+	}
+	return facts, results, nil
+}
+
+func (mod *CheckModule) check(facts HostFacts, sections map[string][]string) []CheckResult {
+	results := []CheckResult{{
+		Name:    CheckNameOS,
+		Status:  CheckStatusPass,
+		Message: fmt.Sprintf("%s, kernel %s, arch %s, %d cpu cores, %d bytes memory", facts.OS, facts.Kernel, facts.Arch, facts.CPUCores, facts.MemoryTotal),
+	}}
+
+	// 组件通过 systemd 管理
+	if facts.SystemdVersion == "" {
+		results = append(results, CheckResult{Name: CheckNameSystemd, Status: CheckStatusFail, Message: "systemd not found, components are managed by systemd"})
+	} else {
+		results = append(results, CheckResult{Name: CheckNameSystemd, Status: CheckStatusPass, Message: "systemd " + facts.SystemdVersion})
+	}
+
+	// 等待组件启动时通过 ss 检查端口
+	if len(sections["ss"]) == 0 {
+		results = append(results, CheckResult{Name: CheckNameCommand, Status: CheckStatusFail, Message: "command ss not found, please install iproute"})
+	} else {
+		results = append(results, CheckResult{Name: CheckNameCommand, Status: CheckStatusPass, Message: "command ss found"})
+	}
+
+	results = append(results, mod.checkDisk(facts)...)
+	results = append(results, mod.checkPort(facts))
+	results = append(results, mod.checkFirewall(sections))
+	results = append(results, checkSysctl(sections)...)
+	results = append(results, checkTHP(sections))
+
+	switch facts.TimeSync {
+	case TimeSyncYes:
+		results = append(results, CheckResult{Name: CheckNameTimeSync, Status: CheckStatusPass, Message: "system clock synchronized"})
+	case TimeSyncNo:
+		results = append(results, CheckResult{Name: CheckNameTimeSync, Status: CheckStatusFail, Message: "system clock not synchronized, please check ntpd or chronyd"})
+	default:
+		results = append(results, CheckResult{Name: CheckNameTimeSync, Status: CheckStatusWarn, Message: "unknown time synchronization status, timedatectl not found"})
+	}
+	return results
+}
+
+// 检查实例目录所在文件系统可用空间，同一文件系统只检查一次
+func (mod *CheckModule) checkDisk(facts HostFacts) []CheckResult {
+	var (
+		results []CheckResult
+		checked = make(map[string]bool)
+	)
+	for _, dir := range mod.config.Dirs {
+		fs, ok := mountOf(facts.Filesystems, dir)
+		if !ok {
+			results = append(results, CheckResult{Name: CheckNameDisk, Status: CheckStatusWarn, Message: fmt.Sprintf("no filesystem found for dir %s", dir)})
+			continue
+		}
+		if checked[fs.Mount] {
+			continue
+		}
+		checked[fs.Mount] = true
+
+		r := CheckResult{Name: CheckNameDisk, Status: CheckStatusPass}
+		switch {
+		case fs.Free < checkDiskFailBytes:
+			r.Status = CheckStatusFail
+		case fs.Free < checkDiskWarnBytes:
+			r.Status = CheckStatusWarn
+		}
+		r.Message = fmt.Sprintf("dir %s on %s (%s), %d of %d bytes free", dir, fs.Mount, fs.FSType, fs.Free, fs.Total)
+		results = append(results, r)
+	}
+	return results
+}
+
+// 目录所在文件系统，按最长挂载点匹配
+func mountOf(filesystems []Filesystem, dir string) (Filesystem, bool) {
+	var (
+		matched Filesystem
+		found   bool
+	)
+	dir = filepath.Clean(dir)
+	for _, fs := range filesystems {
+		if fs.Mount != "/" && dir != fs.Mount && !strings.HasPrefix(dir, fs.Mount+"/") {
+			continue
+		}
+		if !found || len(fs.Mount) > len(matched.Mount) {
+			matched, found = fs, true
+		}
+	}
+	return matched, found
+}
+
+// 检查实例端口是否已被占用
+func (mod *CheckModule) checkPort(facts HostFacts) CheckResult {
+	listen := make(map[uint64]bool)
+	for _, p := range facts.ListenPorts {
+		listen[uint64(p)] = true
+	}
+	var used []string
+	for _, p := range mod.config.Ports {
+		if listen[p] {
+			used = append(used, strconv.FormatUint(p, 10))
+		}
+	}
+	if len(used) > 0 {
+		return CheckResult{Name: CheckNamePort, Status: CheckStatusFail, Message: fmt.Sprintf("port [%s] already in use", strings.Join(used, ","))}
+	}
+	return CheckResult{Name: CheckNamePort, Status: CheckStatusPass, Message: "all instance ports are free"}
+}
+
+// firewalld 运行时检查实例端口是否放行，自动修复时永久放行实例端口
+func (mod *CheckModule) checkFirewall(sections map[string][]string) CheckResult {
+	if len(sections["firewalld"]) == 0 || sections["firewalld"][0] != "active" {
+		return CheckResult{Name: CheckNameFirewall, Status: CheckStatusPass, Message: "firewalld is not running"}
+	}
+	opened := make(map[string]bool)
+	for _, line := range sections["firewall_ports"] {
+		for _, p := range strings.Fields(line) {
+			opened[p] = true
+		}
+	}
+	var closed []string
+	for _, p := range mod.config.Ports {
+		if port := fmt.Sprintf("%d/tcp", p); !opened[port] {
+			closed = append(closed, port)
+		}
+	}
+	sort.Strings(closed)
+	if len(closed) == 0 {
+		return CheckResult{Name: CheckNameFirewall, Status: CheckStatusPass, Message: "all instance ports are opened in firewalld"}
+	}
+
+	var args []string
+	for _, p := range closed {
+		args = append(args, "--add-port="+p)
+	}
+	return CheckResult{
+		Name:    CheckNameFirewall,
+		Status:  CheckStatusWarn,
+		Message: fmt.Sprintf("firewalld is running, port [%s] not opened", strings.Join(closed, ",")),
+		fix:     fmt.Sprintf("firewall-cmd --permanent %s && firewall-cmd --reload", strings.Join(args, " ")),
+	}
+}
+
+// 检查推荐的内核参数，自动修复时修改并持久化至 /etc/sysctl.d/99-dmgr.conf
+func checkSysctl(sections map[string][]string) []CheckResult {
+	// vm.swappiness = 60
+	current := make(map[string]string)
+	for _, line := range sections["sysctl"] {
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+			current[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	var results []CheckResult
+	for _, p := range checkSysctlParams {
+		v, ok := current[p.key]
+		switch {
+		case !ok:
+			results = append(results, CheckResult{Name: CheckNameSysctl, Status: CheckStatusWarn, Message: fmt.Sprintf("kernel parameter %s not found", p.key)})
+		case p.check(v):
+			results = append(results, CheckResult{Name: CheckNameSysctl, Status: CheckStatusPass, Message: fmt.Sprintf("%s = %s", p.key, v)})
+		default:
+			results = append(results, CheckResult{
+				Name:    CheckNameSysctl,
+				Status:  CheckStatusWarn,
+				Message: fmt.Sprintf("%s = %s, recommended %s", p.key, v, p.value),
+				fix: fmt.Sprintf(`touch %[1]s && sed -i '/^%[2]s /d' %[1]s && echo '%[2]s = %[3]s' >> %[1]s && sysctl -w %[2]s=%[3]s`,
+					checkSysctlConfFile, p.key, p.value),
+			})
+		}
+	}
+	return results
+}
+
+// 检查透明大页是否关闭，自动修复时运行时关闭（重启后失效）
+func checkTHP(sections map[string][]string) CheckResult {
+	// always madvise [never]
+	if len(sections["thp"]) == 0 {
+		return CheckResult{Name: CheckNameTHP, Status: CheckStatusPass, Message: "transparent hugepage not supported"}
+	}
+	if strings.Contains(sections["thp"][0], "[never]") {
+		return CheckResult{Name: CheckNameTHP, Status: CheckStatusPass, Message: "transparent hugepage disabled"}
+	}
+	return CheckResult{
+		Name:    CheckNameTHP,
+		Status:  CheckStatusWarn,
+		Message: fmt.Sprintf("transparent hugepage enabled: %s", sections["thp"][0]),
+		fix:     fmt.Sprintf(`echo never > %s && echo never > %s`, checkTHPEnabledFile, checkTHPDefragFile),
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package module
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// funcExecutor 按命令返回输出，模拟目标主机
+type funcExecutor struct {
+	run  func(cmd string, sudo bool) (string, string, error)
+	cmds []string
+}
+
+func (e *funcExecutor) Execute(ctx context.Context, cmd string, sudo bool, timeout ...time.Duration) ([]byte, []byte, error) {
+	e.cmds = append(e.cmds, cmd)
+	stdout, stderr, err := e.run(cmd, sudo)
+	return []byte(stdout), []byte(stderr), err
+}
+
+func (e *funcExecutor) Transfer(ctx context.Context, src, dst string, download bool, limit int) error {
+	return errors.New("transfer not supported")
+}
+
+const checkHostFacts = `==os
+PRETTY_NAME="Rocky Linux 8.6 (Green Obsidian)"
+==kernel
+4.18.0-372.9.1.el8.x86_64
+==arch
+x86_64
+==cpu
+4
+==memory
+MemTotal:        8008420 kB
+==filesystems
+Filesystem     Type     1-blocks       Used   Available Capacity Mounted on
+/dev/vda1      xfs   42938118144 4294967296 38643150848      10% /
+/dev/vdb1      xfs    5368709120 4831838208   536870912      90% /data
+==ports
+State  Recv-Q Send-Q Local Address:Port Peer Address:Port
+LISTEN 0      128          0.0.0.0:22        0.0.0.0:*
+LISTEN 0      128                *:8261            *:*
+==systemd
+systemd 239 (239-58.el8)
+==timesync
+System clock synchronized: yes
+`
+
+const checkHostEnv = `==ss
+/usr/sbin/ss
+==firewalld
+active
+==firewall_ports
+8261/tcp
+==sysctl
+vm.swappiness = 30
+net.core.somaxconn = 32768
+net.ipv4.tcp_syncookies = 1
+==thp
+always madvise [never]
+`
+
+func checkHost(fixErr error) *funcExecutor {
+	return &funcExecutor{run: func(cmd string, sudo bool) (string, string, error) {
+		switch {
+		case strings.Contains(cmd, "==kernel"):
+			return checkHostFacts, "", nil
+		case strings.Contains(cmd, "==firewalld"):
+			if !sudo {
+				return "", "", errors.New("check commands must run as root")
+			}
+			return checkHostEnv, "", nil
+		case strings.Contains(cmd, "tcp_syncookies"):
+			return "", "sysctl: permission denied", fixErr
+		default:
+			return "", "", nil
+		}
+	}}
+}
+
+func resultsOf(results []CheckResult, name string) []CheckResult {
+	var rs []CheckResult
+	for _, r := range results {
+		if r.Name == name {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+func TestCheckHostEnvironment(t *testing.T) {
+	e := checkHost(nil)
+	mod := NewCheckModule(CheckModuleConfig{Ports: []uint64{8261, 8262}, Dirs: []string{"/data/dm-master", "/home/tidb/deploy"}})
+	facts, results, err := mod.Execute(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if facts.OS != "Rocky Linux 8.6 (Green Obsidian)" {
+		t.Fatalf("facts os = %q", facts.OS)
+	}
+	if len(e.cmds) != 2 {
+		t.Fatalf("ran %d commands without auto fix, want 2", len(e.cmds))
+	}
+
+	status := func(name string) []string {
+		var ss []string
+		for _, r := range resultsOf(results, name) {
+			ss = append(ss, r.Status)
+		}
+		return ss
+	}
+	for name, want := range map[string]string{
+		CheckNameSystemd:  CheckStatusPass,
+		CheckNameCommand:  CheckStatusPass,
+		CheckNamePort:     CheckStatusFail,
+		CheckNameFirewall: CheckStatusWarn,
+		CheckNameTHP:      CheckStatusPass,
+		CheckNameTimeSync: CheckStatusPass,
+	} {
+		if got := status(name); len(got) != 1 || got[0] != want {
+			t.Errorf("%s status = %v, want %s", name, got, want)
+		}
+	}
+	// /data 可用空间 512MiB，/ 可用空间充足
+	if got := strings.Join(status(CheckNameDisk), ","); got != "fail,pass" {
+		t.Errorf("disk status = %s, want fail,pass", got)
+	}
+	if got := strings.Join(status(CheckNameSysctl), ","); got != "warn,pass,warn" {
+		t.Errorf("sysctl status = %s, want warn,pass,warn", got)
+	}
+	if r := resultsOf(results, CheckNameFirewall)[0]; !strings.Contains(r.Message, "8262/tcp") || strings.Contains(r.Message, "8261/tcp") {
+		t.Errorf("firewall message = %q, want only 8262/tcp closed", r.Message)
+	}
+}
+
+func TestCheckHostAutoFix(t *testing.T) {
+	e := checkHost(errors.New("exit status 255"))
+	mod := NewCheckModule(CheckModuleConfig{Ports: []uint64{8262}, Dirs: []string{"/home/tidb/deploy"}, Apply: true})
+	_, results, err := mod.Execute(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 防火墙以及 vm.swappiness 修复成功，tcp_syncookies 修复失败
+	fixes := e.cmds[2:]
+	if len(fixes) != 3 || !strings.HasPrefix(fixes[0], "firewall-cmd --permanent --add-port=8262/tcp") {
+		t.Fatalf("fix commands = %q", fixes)
+	}
+	firewall := resultsOf(results, CheckNameFirewall)[0]
+	if firewall.Status != CheckStatusPass || !firewall.Fixed {
+		t.Fatalf("firewall result = %+v, want fixed", firewall)
+	}
+	sysctl := resultsOf(results, CheckNameSysctl)
+	if sysctl[0].Status != CheckStatusPass || !sysctl[0].Fixed {
+		t.Fatalf("vm.swappiness result = %+v, want fixed", sysctl[0])
+	}
+	if r := sysctl[2]; r.Status != CheckStatusWarn || r.Fixed || !strings.Contains(r.Message, "permission denied") {
+		t.Fatalf("tcp_syncookies result = %+v, want auto fix failed", r)
+	}
+	// 不可修复的检查项保持原结果
+	if r := resultsOf(results, CheckNamePort)[0]; r.Status != CheckStatusPass {
+		t.Fatalf("port result = %+v", r)
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package module
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+)
+
+var (
+	// 来自某逻辑区域错误
+	errNSFacts = errNS.NewSubNamespace("facts")
+	// 来自主机信息采集失败错误
+	ErrFactsGatherFailed = errNSFacts.NewType("gather_failed")
+)
+
+// 分段采集命令，每段输出以 ==<name> 开头
+type section struct {
+	name string
+	cmd  string
+}
+
+// 主机信息采集命令，无需 root 权限
+var factsSections = []section{
+	{"os", `grep -m 1 '^PRETTY_NAME=' /etc/os-release 2>/dev/null || head -n 1 /etc/redhat-release 2>/dev/null`},
+	{"kernel", `uname -r`},
+	{"arch", `uname -m`},
+	{"cpu", `nproc 2>/dev/null || grep -c ^processor /proc/cpuinfo`},
+	{"memory", `grep MemTotal /proc/meminfo`},
+	{"filesystems", `df -P -T -B1 -x tmpfs -x devtmpfs -x overlay -x squashfs 2>/dev/null`},
+	{"ports", listenPortsCmd},
+	{"systemd", `systemctl --version 2>/dev/null | head -n 1`},
+	{"timesync", `timedatectl status 2>/dev/null | grep -i synchronized`},
+}
+
+// 已监听 TCP 端口采集命令，未安装 ss 时使用 netstat
+const listenPortsCmd = `ss -ltn 2>/dev/null || netstat -ltn 2>/dev/null`
+
+// 时间同步状态
+const (
+	TimeSyncYes     = "yes"
+	TimeSyncNo      = "no"
+	TimeSyncUnknown = "unknown"
+)
+
+// HostFacts 主机信息
+type HostFacts struct {
+	OS             string       `json:"os"`              // 操作系统发行版
+	Kernel         string       `json:"kernel"`          // 内核版本
+	Arch           string       `json:"arch"`            // CPU 架构
+	CPUCores       int          `json:"cpu_cores"`       // CPU 逻辑核数
+	MemoryTotal    uint64       `json:"memory_total"`    // 内存总量，单位：字节
+	Filesystems    []Filesystem `json:"filesystems"`     // 已挂载文件系统
+	ListenPorts    []int        `json:"listen_ports"`    // 已监听的 TCP 端口
+	SystemdVersion string       `json:"systemd_version"` // systemd 版本
+	TimeSync       string       `json:"time_sync"`       // 时间同步状态 yes、no、unknown
+}
+
+// Filesystem 已挂载文件系统
+type Filesystem struct {
+	Mount  string `json:"mount"`   // 挂载点
+	FSType string `json:"fs_type"` // 文件系统类型
+	Total  uint64 `json:"total"`   // 总空间，单位：字节
+	Free   uint64 `json:"free"`    // 可用空间，单位：字节
+}
+
+// FactsModule 用于采集主机信息
+type FactsModule struct {
+	cmd string
+}
+
+// NewFactsModule 构建并返回一个 FactsModule 对象
+func NewFactsModule() *FactsModule {
+	return &FactsModule{cmd: sectionsCommand(factsSections)}
+}
+
+// 合并分段采集命令，部分命令失败（如未安装 timedatectl）不影响其他分段
+func sectionsCommand(sections []section) string {
+	var cmds []string
+	for _, s := range sections {
+		cmds = append(cmds, "echo =="+s.name, s.cmd)
+	}
+	return strings.Join(cmds, "; ") + "; exit 0"
+}
+
+// 按 ==<name> 拆分分段采集命令输出，忽略空行
+func parseSections(output string) map[string][]string {
+	sections := make(map[string][]string)
+	name := ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "==") {
+			name = strings.TrimPrefix(line, "==")
+			continue
+		}
+		if name != "" && line != "" {
+			sections[name] = append(sections[name], line)
+		}
+	}
+	return sections
+}
+
+// Execute 通过执行器一次采集主机信息，executor 应该已经初始化了
+func (mod *FactsModule) Execute(ctx context.Context, exec executor.Executor) (HostFacts, error) {
+	stdout, _, err := exec.Execute(ctx, mod.cmd, false)
+	if err != nil {
+		return HostFacts{}, ErrFactsGatherFailed.Wrap(err, "Failed to gather host facts")
+	}
+	return parseFacts(string(stdout)), nil
+}
+
+func parseFacts(output string) HostFacts {
+	sections := parseSections(output)
+	first := func(name string) string {
+		if len(sections[name]) == 0 {
+			return ""
+		}
+		return sections[name][0]
+	}
+
+	facts := HostFacts{
+		OS:          strings.Trim(strings.TrimPrefix(first("os"), "PRETTY_NAME="), `"'`),
+		Kernel:      first("kernel"),
+		Arch:        first("arch"),
+		TimeSync:    TimeSyncUnknown,
+		Filesystems: []Filesystem{},
+	}
+	facts.CPUCores, _ = strconv.Atoi(first("cpu"))
+
+	// MemTotal:       16267496 kB
+	if fields := strings.Fields(first("memory")); len(fields) >= 2 {
+		if kb, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			facts.MemoryTotal = kb * 1024
+		}
+	}
+
+	// Filesystem Type 1-blocks Used Available Capacity Mounted on
+	for _, line := range sections["filesystems"] {
+		fields := strings.Fields(line)
+		if len(fields) < 7 {
+			continue
+		}
+		total, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		free, _ := strconv.ParseUint(fields[4], 10, 64)
+		facts.Filesystems = append(facts.Filesystems, Filesystem{
+			Mount:  strings.Join(fields[6:], " "),
+			FSType: fields[1],
+			Total:  total,
+			Free:   free,
+		})
+	}
+
+	facts.ListenPorts = parseListenPorts(sections["ports"])
+
+	// systemd 239 (239-45.el8)
+	if fields := strings.Fields(first("systemd")); len(fields) >= 2 && fields[0] == "systemd" {
+		facts.SystemdVersion = fields[1]
+	}
+
+	// System clock synchronized: yes 或 NTP synchronized: yes
+	if line := first("timesync"); line != "" {
+		switch strings.ToLower(strings.TrimSpace(line[strings.LastIndex(line, ":")+1:])) {
+		case TimeSyncYes:
+			facts.TimeSync = TimeSyncYes
+		case TimeSyncNo:
+			facts.TimeSync = TimeSyncNo
+		}
+	}
+	return facts
+}
+
+// 解析已监听 TCP 端口，去重并排序
+func parseListenPorts(lines []string) []int {
+	// ss：LISTEN 0 128 0.0.0.0:22 0.0.0.0:*
+	// netstat：tcp 0 0 0.0.0.0:22 0.0.0.0:* LISTEN
+	var (
+		listenPorts = []int{}
+		ports       = make(map[int]struct{})
+	)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		addr := fields[3]
+		port, err := strconv.Atoi(addr[strings.LastIndex(addr, ":")+1:])
+		if err != nil {
+			continue
+		}
+		if _, ok := ports[port]; !ok {
+			ports[port] = struct{}{}
+			listenPorts = append(listenPorts, port)
+		}
+	}
+	sort.Ints(listenPorts)
+	return listenPorts
+}
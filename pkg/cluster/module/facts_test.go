@@ -0,0 +1,135 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package module
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"os/user"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"go.uber.org/zap"
+)
+
+// outputExecutor 记录执行的命令并返回固定输出
+type outputExecutor struct {
+	stdout string
+	err    error
+	cmds   []string
+}
+
+func (e *outputExecutor) Execute(ctx context.Context, cmd string, sudo bool, timeout ...time.Duration) ([]byte, []byte, error) {
+	e.cmds = append(e.cmds, cmd)
+	return []byte(e.stdout), nil, e.err
+}
+
+func (e *outputExecutor) Transfer(ctx context.Context, src, dst string, download bool, limit int) error {
+	return errors.New("transfer not supported")
+}
+
+// 通过本机执行器实际运行采集命令
+func TestFactsGatherLocalHost(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+	current, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	kernel, err := exec.Command("uname", "-r").Output()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	facts, err := NewFactsModule().Execute(context.Background(), executor.NewLocalExecutor("127.0.0.1", current.Username, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if facts.Kernel != strings.TrimSpace(string(kernel)) {
+		t.Fatalf("kernel = %q, want %q", facts.Kernel, strings.TrimSpace(string(kernel)))
+	}
+	if facts.Arch == "" || facts.CPUCores < 1 || facts.MemoryTotal == 0 {
+		t.Fatalf("incomplete facts: %+v", facts)
+	}
+	if facts.TimeSync != TimeSyncYes && facts.TimeSync != TimeSyncNo && facts.TimeSync != TimeSyncUnknown {
+		t.Fatalf("time sync = %q", facts.TimeSync)
+	}
+}
+
+// CentOS 7：无 os-release PRETTY_NAME、未安装 ss 和 timedatectl
+func TestFactsGatherFallbacks(t *testing.T) {
+	e := &outputExecutor{stdout: `==os
+CentOS Linux release 7.9.2009 (Core)
+==kernel
+3.10.0-1160.el7.x86_64
+==arch
+x86_64
+==cpu
+8
+==memory
+MemTotal:       16267496 kB
+==filesystems
+Filesystem     Type     1-blocks       Used    Available Capacity Mounted on
+/dev/sda1      xfs   53660876800 5368709120 48292167680      11% /
+/dev/sdb1      ext4 107374182400          0 107374182400       0% /data dm
+==ports
+Active Internet connections (only servers)
+Proto Recv-Q Send-Q Local Address           Foreign Address         State
+tcp        0      0 0.0.0.0:22              0.0.0.0:*               LISTEN
+tcp6       0      0 :::8261                 :::*                    LISTEN
+tcp        0      0 127.0.0.1:22            0.0.0.0:*               LISTEN
+==systemd
+systemd 219
+==timesync
+`}
+	facts, err := NewFactsModule().Execute(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.cmds) != 1 || !strings.HasSuffix(e.cmds[0], "; exit 0") {
+		t.Fatalf("facts gathered with commands %q, want one command", e.cmds)
+	}
+
+	want := HostFacts{
+		OS:          "CentOS Linux release 7.9.2009 (Core)",
+		Kernel:      "3.10.0-1160.el7.x86_64",
+		Arch:        "x86_64",
+		CPUCores:    8,
+		MemoryTotal: 16267496 * 1024,
+		Filesystems: []Filesystem{
+			{Mount: "/", FSType: "xfs", Total: 53660876800, Free: 48292167680},
+			{Mount: "/data dm", FSType: "ext4", Total: 107374182400, Free: 107374182400},
+		},
+		ListenPorts:    []int{22, 8261},
+		SystemdVersion: "219",
+		TimeSync:       TimeSyncUnknown,
+	}
+	if !reflect.DeepEqual(facts, want) {
+		t.Fatalf("facts = %+v\nwant %+v", facts, want)
+	}
+}
+
+func TestFactsGatherFailed(t *testing.T) {
+	e := &outputExecutor{err: executor.ErrSSHExecuteFailed.New("connection refused")}
+	if _, err := NewFactsModule().Execute(context.Background(), e); !errorx.IsOfType(err, ErrFactsGatherFailed) {
+		t.Fatalf("gather error = %v, want gather_failed", err)
+	}
+}
@@ -16,6 +16,7 @@ limitations under the License.
 package module
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/wentaojin/dmgr/pkg/cluster/executor"
@@ -57,6 +58,6 @@ func NewShellModule(config ShellModuleConfig) *ShellModule {
 
 // Execute passes the command to executor and returns its results, the executor
 // should be already initialized.
-func (mod *ShellModule) Execute(exec executor.Executor) ([]byte, []byte, error) {
-	return exec.Execute(mod.cmd, mod.sudo)
+func (mod *ShellModule) Execute(ctx context.Context, exec executor.Executor) ([]byte, []byte, error) {
+	return exec.Execute(ctx, mod.cmd, mod.sudo)
 }
@@ -0,0 +1,104 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package module
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+)
+
+var (
+	// 来自某逻辑区域错误
+	errNSStatus = errNS.NewSubNamespace("status")
+	// 来自实例状态查询失败错误
+	ErrStatusQueryFailed = errNSStatus.NewType("query_failed")
+)
+
+// UnitStatus systemd 服务状态
+type UnitStatus struct {
+	ActiveState string        // 服务状态 active、inactive、failed 等
+	Uptime      time.Duration // 服务运行时长，服务未运行时为 0
+}
+
+// StatusModule 用于查询主机上多个 systemd 服务状态以及已监听端口
+type StatusModule struct {
+	units []string
+	cmd   string
+}
+
+// NewStatusModule 基于给定的 systemd 服务构建并返回一个 StatusModule 对象
+func NewStatusModule(units []string) *StatusModule {
+	sections := []section{
+		{"uptime", `cat /proc/uptime`},
+		{"ports", listenPortsCmd},
+	}
+	for _, unit := range units {
+		sections = append(sections, section{
+			name: "unit:" + unit,
+			cmd:  fmt.Sprintf(`systemctl show -p ActiveState -p ActiveEnterTimestampMonotonic %s`, unit),
+		})
+	}
+	return &StatusModule{units: units, cmd: sectionsCommand(sections)}
+}
+
+// Execute 通过执行器一次查询所有服务状态以及已监听端口，executor 应该已经初始化了
+func (mod *StatusModule) Execute(ctx context.Context, exec executor.Executor) (map[string]UnitStatus, []int, error) {
+	stdout, _, err := exec.Execute(ctx, mod.cmd, false)
+	if err != nil {
+		return nil, nil, ErrStatusQueryFailed.Wrap(err, "Failed to query instance status")
+	}
+	sections := parseSections(string(stdout))
+
+	// 12345.67 23456.78，系统启动时长，单位：秒
+	var bootSeconds float64
+	if fields := sections["uptime"]; len(fields) > 0 {
+		bootSeconds, _ = strconv.ParseFloat(strings.Fields(fields[0])[0], 64)
+	}
+
+	units := make(map[string]UnitStatus, len(mod.units))
+	for _, unit := range mod.units {
+		// ActiveState=active
+		// ActiveEnterTimestampMonotonic=1234567，服务进入 active 时系统启动时长，单位：微秒
+		var (
+			status     UnitStatus
+			enteredMic uint64
+		)
+		for _, line := range sections["unit:"+unit] {
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "ActiveState":
+				status.ActiveState = kv[1]
+			case "ActiveEnterTimestampMonotonic":
+				enteredMic, _ = strconv.ParseUint(kv[1], 10, 64)
+			}
+		}
+		if status.ActiveState == "active" && enteredMic > 0 && bootSeconds > 0 {
+			if uptime := time.Duration(bootSeconds*float64(time.Second)) - time.Duration(enteredMic)*time.Microsecond; uptime > 0 {
+				status.Uptime = uptime.Round(time.Second)
+			}
+		}
+		units[unit] = status
+	}
+	return units, parseListenPorts(sections["ports"]), nil
+}
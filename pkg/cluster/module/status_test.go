@@ -0,0 +1,79 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package module
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+)
+
+func TestStatusQueryUnits(t *testing.T) {
+	units := []string{"dm-master-8261.service", "dm-worker-8262.service", "grafana-3000.service"}
+	e := &outputExecutor{stdout: `==uptime
+7200.40 14000.00
+==ports
+State  Recv-Q Send-Q Local Address:Port Peer Address:Port
+LISTEN 0      128                *:8261            *:*
+LISTEN 0      128                *:8291            *:*
+LISTEN 0      128          0.0.0.0:22        0.0.0.0:*
+==unit:dm-master-8261.service
+ActiveState=active
+ActiveEnterTimestampMonotonic=3600000000
+==unit:dm-worker-8262.service
+ActiveState=failed
+ActiveEnterTimestampMonotonic=1800000000
+==unit:grafana-3000.service
+`}
+	status, ports, err := NewStatusModule(units).Execute(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一主机所有服务一次查询
+	if len(e.cmds) != 1 {
+		t.Fatalf("ran %d commands, want 1", len(e.cmds))
+	}
+	for _, unit := range units {
+		if !strings.Contains(e.cmds[0], "==unit:"+unit) {
+			t.Fatalf("command doesn't query %s", unit)
+		}
+	}
+
+	want := map[string]UnitStatus{
+		// 系统已启动 7200.4s，服务在系统启动 3600s 后进入 active，运行时长按秒取整
+		"dm-master-8261.service": {ActiveState: "active", Uptime: 3600 * time.Second},
+		"dm-worker-8262.service": {ActiveState: "failed"},
+		"grafana-3000.service":   {},
+	}
+	if !reflect.DeepEqual(status, want) {
+		t.Fatalf("status = %+v, want %+v", status, want)
+	}
+	if want := []int{22, 8261, 8291}; !reflect.DeepEqual(ports, want) {
+		t.Fatalf("ports = %v, want %v", ports, want)
+	}
+}
+
+func TestStatusQueryFailed(t *testing.T) {
+	e := &outputExecutor{err: executor.ErrSSHExecuteTimedout.New("timed out")}
+	if _, _, err := NewStatusModule([]string{"dm-master-8261.service"}).Execute(context.Background(), e); !errorx.IsOfType(err, ErrStatusQueryFailed) {
+		t.Fatalf("query error = %v, want query_failed", err)
+	}
+}
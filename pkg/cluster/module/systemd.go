@@ -16,6 +16,7 @@ limitations under the License.
 package module
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -106,6 +107,6 @@ func NewSystemdModule(config SystemdModuleConfig) *SystemdModule {
 
 // Execute passes the command to executor and returns its results, the executor
 // should be already initialized.
-func (mod *SystemdModule) Execute(exec executor.Executor) ([]byte, []byte, error) {
-	return exec.Execute(mod.cmd, mod.sudo, mod.executeTimeout)
+func (mod *SystemdModule) Execute(ctx context.Context, exec executor.Executor) ([]byte, []byte, error) {
+	return exec.Execute(ctx, mod.cmd, mod.sudo, mod.executeTimeout)
 }
@@ -16,6 +16,7 @@ limitations under the License.
 package module
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/wentaojin/dmgr/pkg/cluster/executor"
@@ -128,8 +129,8 @@ func NewUserModule(config UserModuleConfig) *UserModule {
 }
 
 // Execute 将命令传递给 executor 并返回其结果，executor 应该已经初始化了
-func (mod *UserModule) Execute(exec executor.Executor) ([]byte, []byte, error) {
-	a, b, err := exec.Execute(mod.cmd, true)
+func (mod *UserModule) Execute(ctx context.Context, exec executor.Executor) ([]byte, []byte, error) {
+	a, b, err := exec.Execute(ctx, mod.cmd, true)
 	if err != nil {
 		switch mod.config.Action {
 		case UserActionAdd:
@@ -17,6 +17,7 @@ package module
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -28,6 +29,12 @@ import (
 	"github.com/wentaojin/dmgr/pkg/cluster/executor"
 )
 
+var (
+	errNSWaitFor = errNS.NewSubNamespace("wait_for")
+	// ErrWaitForTimeout 等待端口状态超时，例如组件启动较慢
+	ErrWaitForTimeout = errNSWaitFor.NewType("timeout")
+)
+
 // WaitForConfig is the configurations of WaitFor module.
 type WaitForConfig struct {
 	Port  int           // Port number to poll.
@@ -65,16 +72,16 @@ func NewWaitFor(c WaitForConfig) *WaitFor {
 }
 
 // Execute the module return nil if successfully wait for the event.
-func (w *WaitFor) Execute(e executor.Executor) (err error) {
+func (w *WaitFor) Execute(ctx context.Context, e executor.Executor) (err error) {
 	pattern := []byte(fmt.Sprintf(":%d ", w.c.Port))
 
 	retryOpt := dmgrutil.RetryOption{
 		Delay:   w.c.Sleep,
 		Timeout: w.c.Timeout,
 	}
-	if err := dmgrutil.Retry(func() error {
+	if err := dmgrutil.RetryWithContext(ctx, func() error {
 		// only listing TCP ports
-		stdout, _, err := e.Execute("ss -ltn", false)
+		stdout, _, err := e.Execute(ctx, "ss -ltn", false)
 		if err == nil {
 			switch w.c.State {
 			case "started":
@@ -91,7 +98,10 @@ func (w *WaitFor) Execute(e executor.Executor) (err error) {
 		return err
 	}, retryOpt); err != nil {
 		dmgrutil.Logger.Debug("retry error: %s", zap.Error(err))
-		return fmt.Errorf("timed out waiting for port %d to be %s after %s", w.c.Port, w.c.State, w.c.Timeout)
+		if ctx.Err() != nil {
+			return fmt.Errorf("canceled waiting for port %d to be %s: %v", w.c.Port, w.c.State, ctx.Err())
+		}
+		return ErrWaitForTimeout.New("timed out waiting for port %d to be %s after %s", w.c.Port, w.c.State, w.c.Timeout)
 	}
 	return nil
 }
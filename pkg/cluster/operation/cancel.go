@@ -0,0 +1,88 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package operation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// 集群操作不限制运行超时时间时，集群锁默认有效期
+	defaultLockTTL = 24 * time.Hour
+	// 集群锁有效期在运行超时时间基础上预留的余量
+	lockTTLMargin = 10 * time.Minute
+)
+
+var (
+	// 集群操作运行超时时间，0 表示不限制
+	operationTimeout time.Duration
+
+	// 排队中以及运行中集群操作的取消函数
+	cancelMu sync.Mutex
+	cancels  = make(map[uint64]context.CancelFunc)
+)
+
+// Register 创建可取消的集群操作上下文，并登记取消函数
+func Register(operationID uint64) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cancelMu.Lock()
+	cancels[operationID] = cancel
+	cancelMu.Unlock()
+	return ctx
+}
+
+// Unregister 集群操作运行结束，释放上下文并注销取消函数
+func Unregister(operationID uint64) {
+	cancelMu.Lock()
+	cancel, ok := cancels[operationID]
+	delete(cancels, operationID)
+	cancelMu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+// Cancel 取消排队中或运行中的集群操作，集群操作不存在返回 false
+func Cancel(operationID uint64) bool {
+	cancelMu.Lock()
+	cancel, ok := cancels[operationID]
+	cancelMu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// WithDeadline 集群操作开始运行时设置整体运行超时时间
+func WithDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if operationTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, operationTimeout)
+}
+
+// LockTTL 集群锁有效期，集群操作排队时以及开始运行时按此有效期续期
+func LockTTL() time.Duration {
+	if operationTimeout <= 0 {
+		return defaultLockTTL
+	}
+	return operationTimeout + lockTTLMargin
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package operation
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCancelRegisteredOperation(t *testing.T) {
+	ctx := Register(2001)
+	defer Unregister(2001)
+
+	if ctx.Err() != nil {
+		t.Fatal("context canceled right after register")
+	}
+	if !Cancel(2001) {
+		t.Fatal("cancel registered operation returned false")
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not canceled")
+	}
+	if ctx.Err() != context.Canceled {
+		t.Fatalf("context error = %v, want canceled", ctx.Err())
+	}
+}
+
+func TestUnregisterReleasesOperation(t *testing.T) {
+	ctx := Register(2002)
+	Unregister(2002)
+
+	if ctx.Err() == nil {
+		t.Fatal("context not released after unregister")
+	}
+	if Cancel(2002) {
+		t.Fatal("cancel unregistered operation returned true")
+	}
+	// 重复注销不应 panic
+	Unregister(2002)
+}
+
+func TestWithDeadline(t *testing.T) {
+	saved := operationTimeout
+	defer func() { operationTimeout = saved }()
+
+	operationTimeout = 0
+	ctx, cancel := WithDeadline(context.Background())
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("deadline set when timeout is unlimited")
+	}
+	cancel()
+
+	operationTimeout = time.Hour
+	ctx, cancel = WithDeadline(context.Background())
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("deadline not set")
+	}
+	if d := time.Until(deadline); d <= 59*time.Minute || d > time.Hour {
+		t.Fatalf("deadline in %v, want about 1h", d)
+	}
+}
+
+func TestLockTTL(t *testing.T) {
+	saved := operationTimeout
+	defer func() { operationTimeout = saved }()
+
+	operationTimeout = 0
+	if ttl := LockTTL(); ttl != defaultLockTTL {
+		t.Fatalf("lock ttl without timeout = %v, want %v", ttl, defaultLockTTL)
+	}
+	// 集群锁有效期长于运行超时时间，运行中的集群操作不会因锁过期被其他操作获取
+	operationTimeout = 30 * time.Minute
+	if ttl := LockTTL(); ttl != operationTimeout+lockTTLMargin {
+		t.Fatalf("lock ttl = %v, want %v", ttl, operationTimeout+lockTTLMargin)
+	}
+}
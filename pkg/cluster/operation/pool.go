@@ -0,0 +1,112 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package operation
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"go.uber.org/zap"
+)
+
+var (
+	errNS = errorx.NewNamespace("operation")
+
+	ErrPoolNotInit   = errNS.NewType("pool_not_init")
+	ErrPoolQueueFull = errNS.NewType("pool_queue_full")
+)
+
+// 默认后台工作池
+var defaultPool *Pool
+
+// Job 后台运行的集群操作
+type Job func()
+
+// Pool 集群操作后台工作池
+// 固定数量 worker 从队列中获取集群操作依次运行
+type Pool struct {
+	jobs chan Job
+	wg   sync.WaitGroup
+}
+
+// NewPool 创建并启动后台工作池
+func NewPool(workerThreads, queueSize int) *Pool {
+	if workerThreads < 1 {
+		workerThreads = 1
+	}
+	if queueSize < workerThreads {
+		queueSize = workerThreads
+	}
+	p := &Pool{
+		jobs: make(chan Job, queueSize),
+	}
+
+	p.wg.Add(workerThreads)
+	for i := 0; i < workerThreads; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		p.run(job)
+	}
+}
+
+// 单个集群操作 panic 不影响 worker 继续运行
+func (p *Pool) run(job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			dmgrutil.Logger.Error("Operation", zap.String("panic", fmt.Sprintf("%v", r)))
+		}
+	}()
+	job()
+}
+
+// Submit 提交集群操作到工作池，队列已满直接返回错误
+func (p *Pool) Submit(job Job) error {
+	select {
+	case p.jobs <- job:
+		return nil
+	default:
+		return ErrPoolQueueFull.New("operation queue is full, size [%d]", cap(p.jobs))
+	}
+}
+
+// Close 关闭工作池，等待已提交集群操作运行结束
+func (p *Pool) Close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+// InitPool 初始化默认后台工作池以及集群操作运行超时时间
+func InitPool(cfg *dmgrutil.OperationConfig) {
+	defaultPool = NewPool(cfg.WorkerThreads, cfg.QueueSize)
+	operationTimeout = time.Duration(cfg.Timeout) * time.Minute
+}
+
+// Submit 提交集群操作到默认后台工作池
+func Submit(job Job) error {
+	if defaultPool == nil {
+		return ErrPoolNotInit.New("operation pool isn't init")
+	}
+	return defaultPool.Submit(job)
+}
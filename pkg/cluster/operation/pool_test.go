@@ -0,0 +1,72 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package operation
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/joomcode/errorx"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"go.uber.org/zap"
+)
+
+func TestPoolQueueFull(t *testing.T) {
+	p := NewPool(1, 1)
+	block := make(chan struct{})
+	started := make(chan struct{})
+	if err := p.Submit(func() { close(started); <-block }); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	// worker 运行中，队列容量 1
+	if err := p.Submit(func() {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Submit(func() {}); !errorx.IsOfType(err, ErrPoolQueueFull) {
+		t.Fatalf("submit to full queue returned %v, want pool_queue_full", err)
+	}
+	close(block)
+	p.Close()
+}
+
+func TestPoolRecoversPanic(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+
+	p := NewPool(1, 2)
+	var ran int32
+	if err := p.Submit(func() { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Submit(func() { atomic.AddInt32(&ran, 1) }); err != nil {
+		t.Fatal(err)
+	}
+	// Close 等待已提交的集群操作运行结束
+	p.Close()
+	if atomic.LoadInt32(&ran) != 1 {
+		t.Fatal("job after panic didn't run")
+	}
+}
+
+func TestSubmitWithoutPool(t *testing.T) {
+	saved := defaultPool
+	defaultPool = nil
+	defer func() { defaultPool = saved }()
+
+	if err := Submit(func() {}); !errorx.IsOfType(err, ErrPoolNotInit) {
+		t.Fatalf("submit without pool returned %v, want pool_not_init", err)
+	}
+}
@@ -16,12 +16,16 @@ limitations under the License.
 package task
 
 import (
+	"crypto/tls"
+
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
 	"github.com/wentaojin/dmgr/response"
 )
 
 // Builder 任务 build
 type Builder struct {
-	tasks []Task
+	tasks    []Task
+	rollback bool
 }
 
 // NewBuilder 返回一个 *Builder 实例
@@ -33,7 +37,7 @@ func NewBuilder() *Builder {
 func (b *Builder) RootSSH(
 	host string,
 	port uint64,
-	user, password, keyFile, passphrase string,
+	user, password, keyFile, passphrase, sudoPassword string,
 	connectTimeout, executeTimeout uint64) *Builder {
 	b.tasks = append(b.tasks, &RootSSH{
 		host:           host,
@@ -42,6 +46,7 @@ func (b *Builder) RootSSH(
 		password:       password,
 		keyFile:        keyFile,
 		passphrase:     passphrase,
+		sudoPassword:   sudoPassword,
 		connectTimeout: connectTimeout,
 		executeTimeout: executeTimeout,
 	})
@@ -99,6 +104,40 @@ func (b *Builder) StopInstance(
 	return b
 }
 
+// EvictLeader 将 EvictLeader 任务附加到当前任务集合
+func (b *Builder) EvictLeader(masterAddrs []string, tlsConfig *tls.Config, instanceName string) *Builder {
+	b.tasks = append(b.tasks, &EvictLeader{
+		masterAddrs:  masterAddrs,
+		tlsConfig:    tlsConfig,
+		instanceName: instanceName,
+	})
+	return b
+}
+
+// WaitHealthy 将 WaitHealthy 任务附加到当前任务集合
+func (b *Builder) WaitHealthy(masterAddrs []string, tlsConfig *tls.Config, componentName, instanceName string, timeout uint64) *Builder {
+	b.tasks = append(b.tasks, &WaitHealthy{
+		masterAddrs:   masterAddrs,
+		tlsConfig:     tlsConfig,
+		componentName: componentName,
+		instanceName:  instanceName,
+		timeout:       timeout,
+	})
+	return b
+}
+
+// DrainWorker 将 DrainWorker 任务附加到当前任务集合
+func (b *Builder) DrainWorker(masterAddrs []string, tlsConfig *tls.Config, instanceName string, excludes []string, timeout uint64) *Builder {
+	b.tasks = append(b.tasks, &DrainWorker{
+		masterAddrs:  masterAddrs,
+		tlsConfig:    tlsConfig,
+		instanceName: instanceName,
+		excludes:     excludes,
+		timeout:      timeout,
+	})
+	return b
+}
+
 // DestroyInstance 将 DestroyInstance 任务附加到当前任务集合
 func (b *Builder) DestroyInstance(
 	host string,
@@ -158,6 +197,33 @@ func (b *Builder) CopyComponent(clusterName, componentName string,
 	return b
 }
 
+// StageComponent 将 StageComponent 任务附加到当前任务集合
+func (b *Builder) StageComponent(dstHost, srcPath, stagePath string) *Builder {
+	b.tasks = append(b.tasks, &StageComponent{
+		host:      dstHost,
+		srcPath:   srcPath,
+		stagePath: stagePath,
+	})
+	return b
+}
+
+// CopyStagedComponent 将从目标主机暂存文件本地复制的 CopyComponent 任务附加到当前任务集合
+func (b *Builder) CopyStagedComponent(clusterName, componentName string,
+	clusterVersion string,
+	srcPath, stagePath, dstHost, dstPath string,
+) *Builder {
+	b.tasks = append(b.tasks, &CopyComponent{
+		clusterName:    clusterName,
+		componentName:  componentName,
+		clusterVersion: clusterVersion,
+		srcPath:        srcPath,
+		stagePath:      stagePath,
+		host:           dstHost,
+		dstPath:        dstPath,
+	})
+	return b
+}
+
 // CopyFile 将 CopyFile 任务附加到当前任务集合
 func (b *Builder) CopyFile(clusterName, src, dst, fileType, remoteHost string, download bool, limit int) *Builder {
 	b.tasks = append(b.tasks, &CopyFile{
@@ -227,6 +293,15 @@ func (b *Builder) Mkdir(user, host string, dirs ...string) *Builder {
 	return b
 }
 
+// Func 将 Func 任务附加到当前任务集合
+func (b *Builder) Func(name string, fn func(ctx *ctxt.Context) error) *Builder {
+	b.tasks = append(b.tasks, &Func{
+		name: name,
+		fn:   fn,
+	})
+	return b
+}
+
 // Serial 将任务附加到队列的尾部
 func (b *Builder) Serial(prefix string, tasks ...Task) *Builder {
 	if len(tasks) > 0 {
@@ -238,16 +313,30 @@ func (b *Builder) Serial(prefix string, tasks ...Task) *Builder {
 // Parallel 将并行任务附加到当前任务集合
 func (b *Builder) Parallel(prefix string, ignoreError bool, tasks ...Task) *Builder {
 	if len(tasks) > 0 {
-		b.tasks = append(b.tasks, &Parallel{ignoreError: ignoreError, hideDetailDisplay: false, inner: tasks})
+		b.tasks = append(b.tasks, &Parallel{prefix: prefix, ignoreError: ignoreError, hideDetailDisplay: false, inner: tasks})
+	}
+	return b
+}
+
+// WithRetry 为最近附加的任务或任务组设置重试策略
+func (b *Builder) WithRetry(policy RetryPolicy) *Builder {
+	if n := len(b.tasks); n > 0 {
+		b.tasks[n-1] = WithRetry(b.tasks[n-1], policy)
 	}
 	return b
 }
 
+// RollbackOnFailure 任务运行失败时逆序回滚已运行的任务
+func (b *Builder) RollbackOnFailure() *Builder {
+	b.rollback = true
+	return b
+}
+
 // Build 返回一个任务，其中包含由先前操作附加的所有任务
 func (b *Builder) BuildTask() Task {
 	// Serial handles event internally. So the following 3 lines are commented out.
 	// if len(b.tasks) == 1 {
 	//  return b.tasks[0]
 	// }
-	return &Serial{ignoreError: false, hideDetailDisplay: false, inner: b.tasks}
+	return &Serial{ignoreError: false, hideDetailDisplay: false, rollback: b.rollback, inner: b.tasks}
 }
@@ -0,0 +1,84 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package task
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"go.uber.org/zap"
+)
+
+// 首次运行在第二个同名步骤失败，断点续做时只跳过已完成的步骤，从失败步骤继续运行
+func TestSerialResumeFromCheckpoint(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+
+	var (
+		runs []string
+		fail = true
+	)
+	step := func(label string, failing bool) func(ctx *ctxt.Context) error {
+		return func(ctx *ctxt.Context) error {
+			runs = append(runs, label)
+			if failing && fail {
+				return errors.New("restart failed")
+			}
+			return nil
+		}
+	}
+	build := func() Task {
+		return NewBuilder().
+			Func("prepare", step("prepare", false)).
+			Func("restart", step("restart-1", false)).
+			Func("restart", step("restart-2", true)).
+			Func("update", step("update", false)).
+			BuildTask()
+	}
+
+	var done []string
+	record := func(stepKey, stepName string) error {
+		done = append(done, stepKey)
+		return nil
+	}
+
+	ctx := ctxt.NewContext()
+	ctx.SetCheckpoint(nil, record)
+	if err := build().Execute(ctx); err == nil {
+		t.Fatal("first run succeeded, want failure")
+	}
+	if want := []string{"prepare", "restart-1", "restart-2"}; !reflect.DeepEqual(runs, want) {
+		t.Fatalf("first run = %v, want %v", runs, want)
+	}
+	if len(done) != 2 {
+		t.Fatalf("recorded %d steps, want 2", len(done))
+	}
+
+	fail, runs = false, nil
+	resumed := ctxt.NewContext()
+	resumed.SetCheckpoint(append([]string{}, done...), record)
+	if err := build().Execute(resumed); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"restart-2", "update"}; !reflect.DeepEqual(runs, want) {
+		t.Fatalf("resumed run = %v, want %v", runs, want)
+	}
+	if len(done) != 4 {
+		t.Fatalf("recorded %d steps after resume, want 4", len(done))
+	}
+}
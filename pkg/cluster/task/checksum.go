@@ -0,0 +1,104 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package task
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+)
+
+var (
+	errNSChecksum = errNS.NewSubNamespace("checksum")
+	// ErrChecksumMismatch 文件传输后目标文件与源文件 SHA-256 不一致
+	ErrChecksumMismatch = errNSChecksum.NewType("mismatch")
+)
+
+// 组件文件 SHA-256，离线镜像包解压时记录了 SHA-256 的文件校验本地文件是否损坏
+func componentChecksum(src string) (string, error) {
+	actual, err := dmgrutil.SHA256Sum(src)
+	if err != nil {
+		return "", err
+	}
+	recorded, err := dmgrutil.PackageChecksum(src)
+	if err != nil {
+		return "", err
+	}
+	if recorded != "" && recorded != actual {
+		return "", fmt.Errorf("local package file %s is corrupted, expected sha256 %s, got %s, please uncompress the offline package again", src, recorded, actual)
+	}
+	return actual, nil
+}
+
+// 上传后校验远程文件与本地文件 SHA-256 是否一致，目录不校验
+func verifyUpload(ctx *ctxt.Context, exec executor.Executor, host, src, dst string, sudo bool) error {
+	if info, err := os.Stat(src); err != nil || info.IsDir() {
+		return err
+	}
+	expected, err := dmgrutil.SHA256Sum(src)
+	if err != nil {
+		return err
+	}
+	return verifyRemoteChecksum(ctx, exec, host, dst, expected, sudo)
+}
+
+// 下载后校验本地文件与远程文件 SHA-256 是否一致，目录不校验
+func verifyDownload(ctx *ctxt.Context, exec executor.Executor, host, src, dst string, sudo bool) error {
+	if info, err := os.Stat(dst); err != nil || info.IsDir() {
+		return err
+	}
+	expected, err := remoteChecksum(ctx, exec, host, src, sudo)
+	if err != nil {
+		return err
+	}
+	actual, err := dmgrutil.SHA256Sum(dst)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return ErrChecksumMismatch.New("checksum mismatch between %s:%s and local file %s, expected sha256 %s, got %s", host, src, dst, expected, actual)
+	}
+	return nil
+}
+
+// 校验远程文件 SHA-256
+func verifyRemoteChecksum(ctx *ctxt.Context, exec executor.Executor, host, path, expected string, sudo bool) error {
+	actual, err := remoteChecksum(ctx, exec, host, path, sudo)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return ErrChecksumMismatch.New("checksum mismatch for %s:%s, expected sha256 %s, got %s", host, path, expected, actual)
+	}
+	return nil
+}
+
+func remoteChecksum(ctx *ctxt.Context, exec executor.Executor, host, path string, sudo bool) (string, error) {
+	stdout, stderr, err := exec.Execute(ctx, fmt.Sprintf(`sha256sum %s`, path), sudo)
+	if err != nil {
+		return "", errors.Annotatef(err, "failed to checksum %s:%s, stderr: %s", host, path, string(stderr))
+	}
+	fields := strings.Fields(string(stdout))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("failed to checksum %s:%s, empty sha256sum output", host, path)
+	}
+	return fields[0], nil
+}
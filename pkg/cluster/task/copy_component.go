@@ -19,12 +19,15 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
 
 	"github.com/wentaojin/dmgr/pkg/dmgrutil"
 
 	"github.com/pingcap/errors"
+	"go.uber.org/zap"
 )
 
 // CopyComponent 用于复制一个组件特定版本相关的所有文件到 path 的目标目录
@@ -35,6 +38,19 @@ type CopyComponent struct {
 	host           string
 	srcPath        string
 	dstPath        string
+	stagePath      string // 目标主机暂存文件，不为空时从暂存文件本地复制，无需上传
+
+	// 回滚使用，记录本任务实际创建以及覆盖的文件
+	exec      executor.Executor
+	created   bool           // 组件文件原先不存在
+	backups   []remoteBackup // 被覆盖的组件文件以及 grafana 解压覆盖的目录或文件
+	extracted []string       // grafana 解压新创建的目录或文件
+}
+
+// 远程备份，集群操作结束时删除
+type remoteBackup struct {
+	path   string
+	backup string
 }
 
 // Execute implements the Task interface
@@ -43,23 +59,76 @@ func (c *CopyComponent) Execute(ctx *ctxt.Context) error {
 	if !found {
 		return ErrNoExecutor
 	}
+	c.exec = exec
+
+	exist, err := remotePathExist(ctx, exec, c.dstPath)
+	if err != nil {
+		return errors.Annotatef(err, "failed to check %s:%s", c.host, c.dstPath)
+	}
+	// 重试运行时保留首次运行记录的变更
+	if !exist {
+		c.created = true
+	} else if !c.created {
+		if err := c.backup(ctx, c.dstPath); err != nil {
+			return errors.Annotatef(err, "failed to backup %s:%s", c.host, c.dstPath)
+		}
+	}
 
-	err := exec.Transfer(c.srcPath, c.dstPath, false, 0)
+	checksum, err := componentChecksum(c.srcPath)
 	if err != nil {
-		return errors.Annotatef(err, "failed to scp %s to %s:%s", c.srcPath, c.host, c.dstPath)
+		return errors.Annotatef(err, "failed to checksum %s", c.srcPath)
+	}
+
+	if c.stagePath != "" {
+		_, stderr, err := exec.Execute(ctx, fmt.Sprintf(`cp -p %s %s`, c.stagePath, c.dstPath), false)
+		if err != nil {
+			return errors.Annotatef(err, "failed to copy %s:%s to %s, stderr: %s", c.host, c.stagePath, c.dstPath, string(stderr))
+		}
+	} else {
+		err = exec.Transfer(ctx, c.srcPath, c.dstPath, false, 0)
+		if err != nil {
+			return errors.Annotatef(err, "failed to scp %s to %s:%s", c.srcPath, c.host, c.dstPath)
+		}
+	}
+	// 校验远程文件，不一致时按重试策略重新复制
+	if err := verifyRemoteChecksum(ctx, exec, c.host, c.dstPath, checksum, false); err != nil {
+		return err
 	}
 
 	if strings.ToLower(c.componentName) == dmgrutil.ComponentGrafana {
 		baseDirArr := strings.Split(c.dstPath, "/")
 		baseDir := strings.Join(baseDirArr[:len(baseDirArr)-1], "/")
 
+		// 记录解压前已存在的目录或文件
+		stdout, _, err := exec.Execute(ctx, fmt.Sprintf(`ls -A %s`, baseDir), false)
+		if err != nil {
+			return errors.Annotatef(err, "failed to list %s:%s", c.host, baseDir)
+		}
+		existEntries := dmgrutil.NewStringSet(strings.Fields(string(stdout))...)
+
+		// 备份解压将覆盖的已存在目录或文件，本任务解压创建的除外
+		stdout, _, err = exec.Execute(ctx, fmt.Sprintf(`tar -tzf %s`, c.dstPath), false)
+		if err != nil {
+			return errors.Annotatef(err, "failed to list %s:%s", c.host, c.dstPath)
+		}
+		for _, entry := range tarTopEntries(stdout) {
+			path := filepath.Join(baseDir, entry)
+			if !existEntries.Exist(entry) || dmgrutil.NewStringSet(c.extracted...).Exist(path) {
+				continue
+			}
+			if err := c.backup(ctx, path); err != nil {
+				return errors.Annotatef(err, "failed to backup %s:%s", c.host, path)
+			}
+		}
+
 		// 解压并清理压缩包
 		cmd := fmt.Sprintf(`tar --no-same-owner -zxvf %s -C %s && rm %s`,
 			c.dstPath,
 			baseDir,
 			c.dstPath)
 
-		_, stderr, err := exec.Execute(cmd, false)
+		stdout, stderr, err := exec.Execute(ctx, cmd, false)
+		c.recordExtracted(baseDir, existEntries, stdout)
 		if err != nil || len(stderr) != 0 {
 			return errors.Annotatef(err, "stderr: %s", string(stderr))
 		}
@@ -77,7 +146,7 @@ func (c *CopyComponent) Execute(ctx *ctxt.Context) error {
 			`find %s -type f -exec sed -i "s/Test-Cluster/%s/g" {} \;`,
 		} {
 			cmd := fmt.Sprintf(cmd, filepath.Join(baseDir, "dashboards"), c.clusterName)
-			_, stderr, err := exec.Execute(cmd, false)
+			_, stderr, err := exec.Execute(ctx, cmd, false)
 			if err != nil || len(stderr) > 0 {
 				return errors.Annotatef(err, "stderr: %s", string(stderr))
 			}
@@ -87,7 +156,7 @@ func (c *CopyComponent) Execute(ctx *ctxt.Context) error {
 
 	if strings.ToLower(c.componentName) != dmgrutil.ComponentGrafana {
 		cmd := fmt.Sprintf(`chmod +x %s`, c.dstPath)
-		_, stderr, err := exec.Execute(cmd, false)
+		_, stderr, err := exec.Execute(ctx, cmd, false)
 		if err != nil || len(stderr) != 0 {
 			return errors.Annotatef(err, "stderr: %s", string(stderr))
 		}
@@ -95,13 +164,113 @@ func (c *CopyComponent) Execute(ctx *ctxt.Context) error {
 	return nil
 }
 
+// 根据 tar -v 输出记录解压新创建的顶层目录或文件
+func (c *CopyComponent) recordExtracted(baseDir string, existEntries dmgrutil.StringSet, stdout []byte) {
+	for _, entry := range tarTopEntries(stdout) {
+		if existEntries.Exist(entry) {
+			continue
+		}
+		existEntries.Insert(entry)
+		c.extracted = append(c.extracted, filepath.Join(baseDir, entry))
+	}
+}
+
+// 远程备份已存在的文件或目录（cp -a 保留权限），同一路径只备份一次，原先内容不经过命令输出
+func (c *CopyComponent) backup(ctx *ctxt.Context, path string) error {
+	for _, b := range c.backups {
+		if b.path == path {
+			return nil
+		}
+	}
+	backup := fmt.Sprintf("%s.dmgr-bak-%d", path, time.Now().UnixNano())
+	cmd := fmt.Sprintf(`if [ -e %[1]s ]; then cp -a %[1]s %[2]s && echo existed; fi`, path, backup)
+	stdout, _, err := c.exec.Execute(ctx, cmd, false)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(stdout)) != "existed" {
+		return nil
+	}
+	c.backups = append(c.backups, remoteBackup{path: path, backup: backup})
+	exec, host := c.exec, c.host
+	ctx.AddCleanup(func(ctx *ctxt.Context) {
+		if _, _, err := exec.Execute(ctx, fmt.Sprintf(`rm -rf %s`, backup), true); err != nil {
+			dmgrutil.Logger.Warn("CopyComponent", zap.String("host", host), zap.String("msg", fmt.Sprintf("remove backup %s failed", backup)), zap.Error(err))
+		}
+	})
+	return nil
+}
+
+// 解压包内顶层目录或文件，按 tar -t/-v 输出顺序去重
+func tarTopEntries(stdout []byte) []string {
+	var entries []string
+	seen := dmgrutil.NewStringSet()
+	for _, line := range strings.Split(string(stdout), "\n") {
+		entry := strings.Split(strings.TrimPrefix(strings.TrimSpace(line), "./"), "/")[0]
+		if entry == "" || entry == "." || seen.Exist(entry) {
+			continue
+		}
+		seen.Insert(entry)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
 // Rollback implements the Task interface
+// 删除本任务新创建的组件文件以及 grafana 解压文件，使用远程备份还原被覆盖的组件文件以及 grafana 目录或文件
 func (c *CopyComponent) Rollback(ctx *ctxt.Context) error {
-	return ErrUnsupportedRollback
+	if c.exec == nil {
+		return nil
+	}
+	for len(c.extracted) > 0 {
+		path := c.extracted[len(c.extracted)-1]
+		if _, _, err := c.exec.Execute(ctx, fmt.Sprintf(`rm -rf %s`, path), true); err != nil {
+			return errors.Annotatef(err, "failed to remove %s:%s", c.host, path)
+		}
+		c.extracted = c.extracted[:len(c.extracted)-1]
+	}
+	for len(c.backups) > 0 {
+		b := c.backups[len(c.backups)-1]
+		if _, _, err := c.exec.Execute(ctx, fmt.Sprintf(`rm -rf %[1]s && mv -f %[2]s %[1]s`, b.path, b.backup), true); err != nil {
+			return errors.Annotatef(err, "failed to restore %s:%s", c.host, b.path)
+		}
+		c.backups = c.backups[:len(c.backups)-1]
+	}
+	if !c.created {
+		return nil
+	}
+	if _, _, err := c.exec.Execute(ctx, fmt.Sprintf(`rm -f %s`, c.dstPath), true); err != nil {
+		return errors.Annotatef(err, "failed to remove %s:%s", c.host, c.dstPath)
+	}
+	c.created = false
+	return nil
 }
 
 // String implements the fmt.Stringer interface
 func (c *CopyComponent) String() string {
+	if c.stagePath != "" {
+		return fmt.Sprintf("CopyComponent: component=%s, version=%s, remote=%s:%s, stage=%s",
+			c.componentName, c.clusterVersion, c.host, c.dstPath, c.stagePath)
+	}
 	return fmt.Sprintf("CopyComponent: component=%s, version=%s, src=%s, remote=%s:%s",
 		c.componentName, c.clusterVersion, c.srcPath, c.host, c.dstPath)
 }
+
+// Describe implements the Task interface
+func (c *CopyComponent) Describe() Plan {
+	action, src := "upload", c.srcPath
+	if c.stagePath != "" {
+		action, src = "copy", c.stagePath
+	}
+	if strings.ToLower(c.componentName) == dmgrutil.ComponentGrafana {
+		action += " and extract"
+	}
+	return Plan{
+		Task:   "CopyComponent",
+		Host:   c.host,
+		Action: action,
+		Src:    src,
+		Dst:    c.dstPath,
+		Params: map[string]string{"component": c.componentName, "version": c.clusterVersion},
+	}
+}
@@ -17,12 +17,18 @@ package task
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/wentaojin/dmgr/pkg/dmgrutil"
 
 	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
 
 	"github.com/pingcap/errors"
+	"go.uber.org/zap"
 )
 
 // CopyFile will copy a local file to the target host
@@ -34,6 +40,12 @@ type CopyFile struct {
 	remoteHost  string
 	download    bool
 	limit       int
+
+	// 回滚使用，记录目标文件原先状态
+	exec     executor.Executor
+	backedUp bool   // 已记录目标文件原先状态
+	existed  bool   // 目标文件原先存在
+	backup   string // 目标文件原先存在时远程备份文件，集群操作结束时删除
 }
 
 // Execute implements the Task interface
@@ -42,18 +54,35 @@ func (c *CopyFile) Execute(ctx *ctxt.Context) error {
 	if !ok {
 		return ErrNoExecutor
 	}
+	c.exec = e
 
-	err := e.Transfer(c.src, c.dst, c.download, c.limit)
+	// 重试运行时保留首次运行记录的目标文件原先状态
+	if !c.backedUp {
+		if err := c.backupTarget(ctx); err != nil {
+			return errors.Annotate(err, "failed to backup file")
+		}
+	}
+
+	err := e.Transfer(ctx, c.src, c.dst, c.download, c.limit)
 	if err != nil {
 		return errors.Annotate(err, "failed to transfer file")
 	}
+	// 校验传输后的文件，不一致时按重试策略重新复制
+	if c.download {
+		err = verifyDownload(ctx, e, c.remoteHost, c.src, c.dst, true)
+	} else {
+		err = verifyUpload(ctx, e, c.remoteHost, c.src, c.dst, true)
+	}
+	if err != nil {
+		return err
+	}
 
 	if c.fileType == dmgrutil.FileTypeSystemd {
 		cmd := fmt.Sprintf(`cp %s %s && rm %s`,
 			c.dst,
 			dmgrutil.AbsClusterSystemdDir(),
 			c.dst)
-		_, stderr, err := e.Execute(cmd, true)
+		_, stderr, err := e.Execute(ctx, cmd, true)
 		if err != nil || len(stderr) != 0 {
 			return errors.Annotatef(err, "stderr: %s", string(stderr))
 		}
@@ -61,7 +90,7 @@ func (c *CopyFile) Execute(ctx *ctxt.Context) error {
 
 	if c.fileType == dmgrutil.FileTypeScript {
 		cmd := fmt.Sprintf(`chmod +x %s`, c.dst)
-		_, stderr, err := e.Execute(cmd, true)
+		_, stderr, err := e.Execute(ctx, cmd, true)
 		if err != nil || len(stderr) != 0 {
 			return errors.Annotatef(err, "stderr: %s", string(stderr))
 		}
@@ -69,7 +98,7 @@ func (c *CopyFile) Execute(ctx *ctxt.Context) error {
 
 	if c.fileType == dmgrutil.FileTypeRule {
 		cmd := fmt.Sprintf(`sed -i -e "s/ENV_LABELS_ENV/%[1]s/g" %[2]s`, c.clusterName, c.dst)
-		_, stderr, err := e.Execute(cmd, true)
+		_, stderr, err := e.Execute(ctx, cmd, true)
 		if err != nil || len(stderr) != 0 {
 			return errors.Annotatef(err, "stderr: %s", string(stderr))
 		}
@@ -78,9 +107,76 @@ func (c *CopyFile) Execute(ctx *ctxt.Context) error {
 	return nil
 }
 
+// 最终目标文件，systemd 文件复制后移动至 systemd 目录
+func (c *CopyFile) target() string {
+	if c.fileType == dmgrutil.FileTypeSystemd {
+		return filepath.Join(dmgrutil.AbsClusterSystemdDir(), filepath.Base(c.dst))
+	}
+	return c.dst
+}
+
+// 记录目标文件原先状态，原先存在时在远程备份（cp -p 保留权限），原先内容不经过命令输出
+func (c *CopyFile) backupTarget(ctx *ctxt.Context) error {
+	if c.download {
+		_, err := os.Stat(c.dst)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.existed, c.backedUp = err == nil, true
+		return nil
+	}
+
+	// 同一集群操作可能多次复制同一目标文件，备份文件名唯一，确保逆序回滚逐个还原
+	backup := fmt.Sprintf("%s.dmgr-bak-%d", c.target(), time.Now().UnixNano())
+	cmd := fmt.Sprintf(`if [ -f %[1]s ]; then cp -p %[1]s %[2]s && echo existed; fi`, c.target(), backup)
+	stdout, _, err := c.exec.Execute(ctx, cmd, true)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(stdout)) == "existed" {
+		c.existed, c.backup = true, backup
+		exec, remoteHost := c.exec, c.remoteHost
+		ctx.AddCleanup(func(ctx *ctxt.Context) {
+			if _, _, err := exec.Execute(ctx, fmt.Sprintf(`rm -f %s`, backup), true); err != nil {
+				dmgrutil.Logger.Warn("CopyFile", zap.String("host", remoteHost), zap.String("msg", fmt.Sprintf("remove backup file %s failed", backup)), zap.Error(err))
+			}
+		})
+	}
+	c.backedUp = true
+	return nil
+}
+
 // Rollback implements the Task interface
+// 目标文件原先不存在则删除，原先存在则使用远程备份还原原先内容以及权限
 func (c *CopyFile) Rollback(ctx *ctxt.Context) error {
-	return ErrUnsupportedRollback
+	if !c.backedUp {
+		return nil
+	}
+
+	if c.download {
+		if c.existed {
+			dmgrutil.Logger.Warn("Rollback", zap.String("msg", fmt.Sprintf("local file %s existed before, keep it", c.dst)))
+			return nil
+		}
+		if err := os.Remove(c.dst); err != nil && !os.IsNotExist(err) {
+			return errors.Annotatef(err, "failed to remove local file %s", c.dst)
+		}
+		c.backedUp = false
+		return nil
+	}
+
+	cmd := fmt.Sprintf(`rm -f %s`, c.target())
+	if c.existed {
+		cmd = fmt.Sprintf(`mv -f %s %s`, c.backup, c.target())
+	}
+	if c.fileType == dmgrutil.FileTypeSystemd {
+		cmd = fmt.Sprintf(`rm -f %s; %s && systemctl daemon-reload`, c.dst, cmd)
+	}
+	if _, _, err := c.exec.Execute(ctx, cmd, true); err != nil {
+		return errors.Annotatef(err, "failed to rollback file %s:%s", c.remoteHost, c.target())
+	}
+	c.backedUp = false
+	return nil
 }
 
 // String implements the fmt.Stringer interface
@@ -90,3 +186,19 @@ func (c *CopyFile) String() string {
 	}
 	return fmt.Sprintf("CopyFile: local=%s, remote=%s:%s", c.src, c.remoteHost, c.dst)
 }
+
+// Describe implements the Task interface
+func (c *CopyFile) Describe() Plan {
+	action := "upload"
+	if c.download {
+		action = "download"
+	}
+	return Plan{
+		Task:   "CopyFile",
+		Host:   c.remoteHost,
+		Action: action,
+		Src:    c.src,
+		Dst:    c.target(),
+		Params: map[string]string{"file_type": c.fileType},
+	}
+}
@@ -50,29 +50,23 @@ func (s *DestroyInstance) Execute(ctx *ctxt.Context) error {
 		return ErrNoExecutor
 	}
 
-	// would save parent dir
-	delPaths := dmgrutil.NewStringSet()
-	delPaths.Insert(fmt.Sprintf(`rm -rf %s`, filepath.Join(s.deployDir, s.instanceName)))
-	delPaths.Insert(fmt.Sprintf(`rm -rf %s`, filepath.Join(s.dataDir, s.instanceName)))
-	delPaths.Insert(fmt.Sprintf(`rm -rf %s`, filepath.Join(s.logDir, s.instanceName)))
-	delPaths.Insert(fmt.Sprintf("/etc/systemd/system/%s-%d.service", s.componentName, s.servicePort))
 	c := module.ShellModuleConfig{
-		Command:  fmt.Sprintf("rm -rf %s;", strings.Join(delPaths.Slice(), " ")),
+		Command:  fmt.Sprintf("rm -rf %s;", strings.Join(s.removePaths(), " ")),
 		Sudo:     true, // the .service files are in a directory owned by root
 		Chdir:    "",
 		UseShell: false,
 	}
 	shell := module.NewShellModule(c)
-	_, stderr, err := shell.Execute(exec)
+	_, stderr, err := shell.Execute(ctx, exec)
 
 	if len(stderr) > 0 {
 		dmgrutil.Logger.Error("Destroying component instance failed", zap.String("component", s.componentName), zap.String("instance", s.instanceName), zap.String("error", string(stderr)))
-		return errors.Annotatef(err, "failed to destroy component instance: %s", zap.String("component", s.componentName), zap.String("instance", s.instanceName))
+		return errors.Annotatef(err, "failed to destroy component [%s] instance: %s", s.componentName, s.instanceName)
 	}
 
 	if err != nil {
 		dmgrutil.Logger.Error("Destroying component instance failed", zap.String("component", s.componentName), zap.String("instance", s.instanceName), zap.Error(err))
-		return errors.Annotatef(err, "failed to destroy component instance: %s", zap.String("component", s.componentName), zap.String("instance", s.instanceName))
+		return errors.Annotatef(err, "failed to destroy component [%s] instance: %s", s.componentName, s.instanceName)
 	}
 
 	dmgrutil.Logger.Info("Destroying component instance success", zap.String("component", s.componentName), zap.String("instance", s.instanceName))
@@ -89,3 +83,37 @@ func (s *DestroyInstance) Rollback(ctx *ctxt.Context) error {
 func (s *DestroyInstance) String() string {
 	return fmt.Sprintf("DestroyInstance: host=%s, instanceName=%s", s.host, s.instanceName)
 }
+
+// Describe implements the Task interface
+func (s *DestroyInstance) Describe() Plan {
+	return Plan{
+		Task:   "DestroyInstance",
+		Host:   s.host,
+		Action: "rm -rf",
+		Unit:   s.serviceName(),
+		Dirs:   s.removePaths(),
+		Params: map[string]string{"component": s.componentName, "instance": s.instanceName},
+	}
+}
+
+func (s *DestroyInstance) serviceName() string {
+	return fmt.Sprintf("%s-%d.service", s.componentName, s.servicePort)
+}
+
+// 清理的目录以及 systemd 服务文件，保留父目录
+func (s *DestroyInstance) removePaths() []string {
+	var paths []string
+	delPaths := dmgrutil.NewStringSet()
+	for _, p := range []string{
+		filepath.Join(s.deployDir, s.instanceName),
+		filepath.Join(s.dataDir, s.instanceName),
+		filepath.Join(s.logDir, s.instanceName),
+		filepath.Join(dmgrutil.AbsClusterSystemdDir(), s.serviceName()),
+	} {
+		if !delPaths.Exist(p) {
+			delPaths.Insert(p)
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
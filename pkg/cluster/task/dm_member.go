@@ -0,0 +1,271 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package task
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/wentaojin/dmgr/pkg/cluster/api"
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"go.uber.org/zap"
+)
+
+// 健康检查间隔
+const healthCheckInterval = 2 * time.Second
+
+// EvictLeader 重启 dm-master 前，若该实例为 leader 则通过 OperateLeader 接口驱逐并等待新 leader 选出
+// 集群只有一个 dm-master 时无法驱逐，跳过
+type EvictLeader struct {
+	masterAddrs  []string
+	tlsConfig    *tls.Config // 集群开启 TLS 时访问 dm-master 的客户端配置，未开启为 nil
+	instanceName string
+	evicted      bool // 已发起驱逐，回滚时取消驱逐
+}
+
+// Execute implements the Task interface
+func (e *EvictLeader) Execute(ctx *ctxt.Context) error {
+	if len(e.masterAddrs) < 2 {
+		return nil
+	}
+	dmMasterClient := api.NewDMMasterClient(e.masterAddrs, api.DmMasterApiTimeout, e.tlsConfig)
+	leader, _, err := dmMasterClient.GetLeader(api.DefaultRetryOpt)
+	if err != nil {
+		return errors.Annotatef(err, "failed to get dm-master leader before restarting %s", e.instanceName)
+	}
+	if leader != e.instanceName {
+		return nil
+	}
+	// 驱逐请求可能已生效但等待新 leader 失败，发起前记录
+	e.evicted = true
+	return dmMasterClient.EvictDMMasterLeader(api.DefaultRetryOpt)
+}
+
+// Rollback implements the Task interface
+// 已驱逐时取消驱逐，避免重启失败未重启的原 leader 一直不参与选举
+func (e *EvictLeader) Rollback(ctx *ctxt.Context) error {
+	if !e.evicted {
+		return nil
+	}
+	dmMasterClient := api.NewDMMasterClient(e.masterAddrs, api.DmMasterApiTimeout, e.tlsConfig)
+	if err := dmMasterClient.CancelEvictDMMasterLeader(api.DefaultRetryOpt); err != nil {
+		return errors.Annotatef(err, "failed to cancel evicting dm-master leader %s", e.instanceName)
+	}
+	e.evicted = false
+	return nil
+}
+
+// String implements the fmt.Stringer interface
+func (e *EvictLeader) String() string {
+	return fmt.Sprintf("EvictLeader: instance=%s, masters=%s", e.instanceName, strings.Join(e.masterAddrs, ","))
+}
+
+// Describe implements the Task interface
+func (e *EvictLeader) Describe() Plan {
+	return Plan{
+		Task:   "EvictLeader",
+		Action: "evict dm-master leader",
+		Params: map[string]string{"instance": e.instanceName, "masters": strings.Join(e.masterAddrs, ",")},
+	}
+}
+
+// WaitHealthy 实例重启后等待 dm-master 存活且集群存在 leader，或 dm-worker 注册上线，通过后才继续操作下一个实例
+type WaitHealthy struct {
+	masterAddrs   []string
+	tlsConfig     *tls.Config
+	componentName string
+	instanceName  string
+	timeout       uint64 // 等待超时（以秒为单位）
+}
+
+// Execute implements the Task interface
+func (w *WaitHealthy) Execute(ctx *ctxt.Context) error {
+	dmMasterClient := api.NewDMMasterClient(w.masterAddrs, api.DmMasterApiTimeout, w.tlsConfig)
+	check := dmMasterClient.CheckWorkerHealthy
+	if w.componentName == dmgrutil.ComponentDmMaster {
+		check = dmMasterClient.CheckMasterHealthy
+	}
+
+	var lastErr error
+	if err := dmgrutil.RetryWithContext(ctx, func() error {
+		lastErr = check(w.instanceName)
+		return lastErr
+	}, dmgrutil.RetryOption{
+		Delay:   healthCheckInterval,
+		Timeout: time.Duration(w.timeout) * time.Second,
+	}); err != nil {
+		if lastErr != nil {
+			err = lastErr
+		}
+		return errors.Annotatef(err, "%s %s is not healthy after restart", w.componentName, w.instanceName)
+	}
+	return nil
+}
+
+// Rollback implements the Task interface
+func (w *WaitHealthy) Rollback(ctx *ctxt.Context) error {
+	return nil
+}
+
+// String implements the fmt.Stringer interface
+func (w *WaitHealthy) String() string {
+	return fmt.Sprintf("WaitHealthy: component=%s, instance=%s", w.componentName, w.instanceName)
+}
+
+// Describe implements the Task interface
+func (w *WaitHealthy) Describe() Plan {
+	return Plan{
+		Task:   "WaitHealthy",
+		Action: "wait healthy",
+		Params: map[string]string{"component": w.componentName, "instance": w.instanceName, "timeout": fmt.Sprint(w.timeout)},
+	}
+}
+
+// DrainWorker 停止 dm-worker 前，将其绑定的数据源迁移至空闲 dm-worker，并等待数据源在该 dm-worker 上运行
+// excludes 为同一操作中将被停止的 dm-worker，不作为迁移目标；无法获取绑定关系或没有空闲 dm-worker 时跳过，由 dm-master 停止后重新调度
+type DrainWorker struct {
+	masterAddrs  []string
+	tlsConfig    *tls.Config
+	instanceName string
+	excludes     []string
+	timeout      uint64 // 等待超时（以秒为单位）
+}
+
+// Execute implements the Task interface
+func (d *DrainWorker) Execute(ctx *ctxt.Context) error {
+	dmMasterClient := api.NewDMMasterClient(d.masterAddrs, api.DmMasterApiTimeout, d.tlsConfig)
+	workers, err := dmMasterClient.GetWorkers()
+	if err != nil {
+		dmgrutil.Logger.Warn("DrainWorker", zap.String("instance", d.instanceName), zap.String("msg", "get dm-worker bound source failed, skip drain"), zap.Error(err))
+		return nil
+	}
+
+	var (
+		source   string
+		free     []string
+		excludes = dmgrutil.NewStringSet(d.excludes...)
+	)
+	for _, w := range workers {
+		switch {
+		case w.GetName() == d.instanceName:
+			if strings.EqualFold(w.GetStage(), "bound") {
+				source = w.GetSource()
+			}
+		case strings.EqualFold(w.GetStage(), "free") && !excludes.Exist(w.GetName()):
+			free = append(free, w.GetName())
+		}
+	}
+	if source == "" {
+		return nil
+	}
+	if len(free) == 0 {
+		dmgrutil.Logger.Warn("DrainWorker", zap.String("instance", d.instanceName), zap.String("source", source), zap.String("msg", "no free dm-worker, skip drain"))
+		return nil
+	}
+	target := free[0]
+
+	_, leaderAddr, err := dmMasterClient.GetLeader(api.DefaultRetryOpt)
+	if err != nil {
+		return errors.Annotatef(err, "failed to get dm-master leader before draining %s", d.instanceName)
+	}
+	dmMasterUrl := dmMasterClient.GetURL(leaderAddr)
+
+	body, err := json.Marshal(api.NewWorkerNameBody(target))
+	if err != nil {
+		return err
+	}
+	if _, err := api.TransferSource(dmMasterUrl, source, bytes.NewReader(body), d.tlsConfig); err != nil {
+		return errors.Annotatef(err, "failed to transfer source %s from dm-worker %s to %s", source, d.instanceName, target)
+	}
+
+	var lastErr error
+	if err := dmgrutil.RetryWithContext(ctx, func() error {
+		lastErr = sourceRunningOn(dmMasterClient, d.tlsConfig, dmMasterUrl, source, target)
+		return lastErr
+	}, dmgrutil.RetryOption{
+		Delay:   healthCheckInterval,
+		Timeout: time.Duration(d.timeout) * time.Second,
+	}); err != nil {
+		if lastErr != nil {
+			err = lastErr
+		}
+		return errors.Annotatef(err, "source %s is not running on dm-worker %s after transfer", source, target)
+	}
+	dmgrutil.Logger.Info("DrainWorker", zap.String("instance", d.instanceName), zap.String("source", source), zap.String("target", target))
+	return nil
+}
+
+// 数据源已绑定至 dm-worker 且运行无错误
+func sourceRunningOn(dmMasterClient *api.DMMasterClient, tlsConfig *tls.Config, dmMasterUrl, source, worker string) error {
+	workers, err := dmMasterClient.GetWorkers()
+	if err != nil {
+		return err
+	}
+	bound := false
+	for _, w := range workers {
+		if w.GetName() == worker && strings.EqualFold(w.GetStage(), "bound") && w.GetSource() == source {
+			bound = true
+		}
+	}
+	if !bound {
+		return fmt.Errorf("source %s is not bound to dm-worker %s", source, worker)
+	}
+
+	resp, err := api.GetSourceStatusBySourceName(dmMasterUrl, source, tlsConfig)
+	if err != nil {
+		return err
+	}
+	var status api.SourceStatusListStruct
+	if err := json.Unmarshal(resp, &status); err != nil {
+		return err
+	}
+	for _, st := range status.Data {
+		if st.WorkerName != worker {
+			continue
+		}
+		if st.ErrorMsg != "" {
+			return fmt.Errorf("source %s on dm-worker %s error: %s", source, worker, st.ErrorMsg)
+		}
+		return nil
+	}
+	return fmt.Errorf("source %s status on dm-worker %s not found", source, worker)
+}
+
+// Rollback implements the Task interface
+// 数据源已迁移至其他 dm-worker，无需回滚
+func (d *DrainWorker) Rollback(ctx *ctxt.Context) error {
+	return nil
+}
+
+// String implements the fmt.Stringer interface
+func (d *DrainWorker) String() string {
+	return fmt.Sprintf("DrainWorker: instance=%s, masters=%s", d.instanceName, strings.Join(d.masterAddrs, ","))
+}
+
+// Describe implements the Task interface
+func (d *DrainWorker) Describe() Plan {
+	return Plan{
+		Task:   "DrainWorker",
+		Action: "transfer bound source to free dm-worker",
+		Params: map[string]string{"instance": d.instanceName, "excludes": strings.Join(d.excludes, ",")},
+	}
+}
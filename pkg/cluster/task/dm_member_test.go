@@ -0,0 +1,256 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package task
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/wentaojin/dmgr/pkg/cluster/api"
+	"github.com/wentaojin/dmgr/pkg/cluster/api/dmpb"
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"go.uber.org/zap"
+)
+
+const (
+	dmMembersPath = "apis/v1alpha1/members"
+	dmLeaderPath  = "apis/v1alpha1/leader"
+	dmSourcePath  = "api/v1/sources"
+)
+
+// fakeDMMaster 模拟 dm-master members/leader/sources 接口，驱逐后由 next 成为 leader，迁移后数据源绑定至目标 dm-worker
+type fakeDMMaster struct {
+	mu      sync.Mutex
+	leader  string
+	next    string
+	masters map[string]bool // dm-master 名称 -> 是否存活
+	workers []*dmpb.WorkerInfo
+	ops     []dmpb.LeaderOp
+	targets []string // 数据源迁移目标 dm-worker
+}
+
+func (f *fakeDMMaster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimLeft(r.URL.Path, "/")
+	switch {
+	case path == dmMembersPath:
+		resp := &dmpb.ListMemberResponse{Result: true}
+		if f.leader != "" {
+			resp.Members = append(resp.Members, &dmpb.Members{Member: &dmpb.Members_Leader{Leader: &dmpb.ListLeaderMember{Name: f.leader, Addr: r.Host}}})
+		}
+		masters := &dmpb.ListMasterMember{}
+		for name, alive := range f.masters {
+			masters.Masters = append(masters.Masters, &dmpb.MasterInfo{Name: name, Alive: alive})
+		}
+		resp.Members = append(resp.Members, &dmpb.Members{Member: &dmpb.Members_Master{Master: masters}})
+		resp.Members = append(resp.Members, &dmpb.Members{Member: &dmpb.Members_Worker{Worker: &dmpb.ListWorkerMember{Workers: f.workers}}})
+		_ = (&jsonpb.Marshaler{}).Marshal(w, resp)
+	case strings.HasPrefix(path, dmLeaderPath+"/") && r.Method == http.MethodPut:
+		op, _ := strconv.Atoi(strings.TrimPrefix(path, dmLeaderPath+"/"))
+		f.ops = append(f.ops, dmpb.LeaderOp(op))
+		if dmpb.LeaderOp(op) == dmpb.LeaderOp_EvictLeaderOp {
+			f.leader = f.next
+		}
+		_ = (&jsonpb.Marshaler{}).Marshal(w, &dmpb.OperateLeaderResponse{Result: true})
+	case strings.HasPrefix(path, dmSourcePath+"/") && strings.HasSuffix(path, "/transfer"):
+		source := strings.TrimSuffix(strings.TrimPrefix(path, dmSourcePath+"/"), "/transfer")
+		var body api.WorkerNameBodyStruct
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.targets = append(f.targets, body.WorkerName)
+		for _, wk := range f.workers {
+			switch {
+			case wk.Source == source:
+				wk.Stage, wk.Source = "free", ""
+			case wk.Name == body.WorkerName:
+				wk.Stage, wk.Source = "bound", source
+			}
+		}
+		_, _ = w.Write([]byte("{}"))
+	case strings.HasPrefix(path, dmSourcePath+"/") && strings.HasSuffix(path, "/status"):
+		source := strings.TrimSuffix(strings.TrimPrefix(path, dmSourcePath+"/"), "/status")
+		status := api.SourceStatusListStruct{}
+		for _, wk := range f.workers {
+			if wk.Source == source {
+				status.Data = append(status.Data, api.SourceStatusStruct{WorkerName: wk.Name})
+			}
+		}
+		status.Total = len(status.Data)
+		_ = json.NewEncoder(w).Encode(status)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeDMMaster) leaderOps() []dmpb.LeaderOp {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]dmpb.LeaderOp(nil), f.ops...)
+}
+
+// 启动 n 个共享同一集群状态的 dm-master，返回其地址
+func startFakeDMMaster(t *testing.T, f *fakeDMMaster, n int) []string {
+	var addrs []string
+	for i := 0; i < n; i++ {
+		srv := httptest.NewServer(f)
+		t.Cleanup(srv.Close)
+		addrs = append(addrs, strings.TrimPrefix(srv.URL, "http://"))
+	}
+	return addrs
+}
+
+func TestEvictLeaderEvictsCurrentLeader(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+	f := &fakeDMMaster{leader: "master1", next: "master2", masters: map[string]bool{"master1": true, "master2": true}}
+	e := &EvictLeader{masterAddrs: startFakeDMMaster(t, f, 2), instanceName: "master1"}
+
+	if err := e.Execute(ctxt.NewContext()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if !e.evicted || f.leader != "master2" {
+		t.Fatalf("evicted = %v, leader = %s, want leader moved to master2", e.evicted, f.leader)
+	}
+	if err := e.Rollback(ctxt.NewContext()); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	// 驱逐一次，回滚时在每个 dm-master 上取消驱逐
+	want := []dmpb.LeaderOp{dmpb.LeaderOp_EvictLeaderOp, dmpb.LeaderOp_CancelEvictLeaderOp, dmpb.LeaderOp_CancelEvictLeaderOp}
+	if ops := f.leaderOps(); len(ops) != len(want) || ops[0] != want[0] || ops[1] != want[1] || ops[2] != want[2] {
+		t.Fatalf("leader ops = %v, want %v", ops, want)
+	}
+}
+
+func TestEvictLeaderSkipsFollower(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+	f := &fakeDMMaster{leader: "master1", masters: map[string]bool{"master1": true, "master2": true}}
+	e := &EvictLeader{masterAddrs: startFakeDMMaster(t, f, 2), instanceName: "master2"}
+
+	if err := e.Execute(ctxt.NewContext()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if err := e.Rollback(ctxt.NewContext()); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if e.evicted || len(f.leaderOps()) != 0 {
+		t.Fatalf("evicted = %v, leader ops = %v, want no eviction", e.evicted, f.leaderOps())
+	}
+}
+
+func TestEvictLeaderSkipsSingleMaster(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+	f := &fakeDMMaster{leader: "master1", masters: map[string]bool{"master1": true}}
+	e := &EvictLeader{masterAddrs: startFakeDMMaster(t, f, 1), instanceName: "master1"}
+
+	if err := e.Execute(ctxt.NewContext()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if e.evicted || len(f.leaderOps()) != 0 {
+		t.Fatalf("evicted = %v, leader ops = %v, want no eviction", e.evicted, f.leaderOps())
+	}
+}
+
+func TestWaitHealthy(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+	f := &fakeDMMaster{
+		leader:  "master1",
+		masters: map[string]bool{"master1": true, "master2": true, "master3": false},
+		workers: []*dmpb.WorkerInfo{{Name: "worker1", Stage: "free"}, {Name: "worker2", Stage: "offline"}},
+	}
+	addrs := startFakeDMMaster(t, f, 1)
+
+	cases := []struct {
+		component string
+		instance  string
+		healthy   bool
+	}{
+		{dmgrutil.ComponentDmMaster, "master2", true},
+		{dmgrutil.ComponentDmMaster, "master3", false},
+		{dmgrutil.ComponentDmWorker, "worker1", true},
+		{dmgrutil.ComponentDmWorker, "worker2", false},
+		{dmgrutil.ComponentDmWorker, "worker3", false},
+	}
+	for _, c := range cases {
+		w := &WaitHealthy{masterAddrs: addrs, componentName: c.component, instanceName: c.instance, timeout: 1}
+		err := w.Execute(ctxt.NewContext())
+		if healthy := err == nil; healthy != c.healthy {
+			t.Errorf("%s %s healthy = %v (%v), want %v", c.component, c.instance, healthy, err, c.healthy)
+		}
+	}
+}
+
+func TestDrainWorkerSkipsExcludedWorkers(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+	f := &fakeDMMaster{
+		leader:  "master1",
+		masters: map[string]bool{"master1": true},
+		workers: []*dmpb.WorkerInfo{
+			{Name: "worker1", Stage: "bound", Source: "mysql-01"},
+			{Name: "worker2", Stage: "free"},
+			{Name: "worker3", Stage: "free"},
+		},
+	}
+	d := &DrainWorker{masterAddrs: startFakeDMMaster(t, f, 1), instanceName: "worker1", excludes: []string{"worker1", "worker2"}, timeout: 1}
+
+	if err := d.Execute(ctxt.NewContext()); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	// worker2 同样将被停止，数据源应迁移至 worker3
+	if len(f.targets) != 1 || f.targets[0] != "worker3" {
+		t.Fatalf("transfer targets = %v, want [worker3]", f.targets)
+	}
+	if f.workers[2].Source != "mysql-01" {
+		t.Fatalf("worker3 source = %q, want mysql-01", f.workers[2].Source)
+	}
+}
+
+func TestDrainWorkerWithoutTarget(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+	cases := []struct {
+		name    string
+		workers []*dmpb.WorkerInfo
+	}{
+		{"only excluded free worker", []*dmpb.WorkerInfo{
+			{Name: "worker1", Stage: "bound", Source: "mysql-01"},
+			{Name: "worker2", Stage: "free"},
+		}},
+		{"instance not bound", []*dmpb.WorkerInfo{
+			{Name: "worker1", Stage: "free"},
+			{Name: "worker3", Stage: "free"},
+		}},
+	}
+	for _, c := range cases {
+		f := &fakeDMMaster{leader: "master1", masters: map[string]bool{"master1": true}, workers: c.workers}
+		d := &DrainWorker{masterAddrs: startFakeDMMaster(t, f, 1), instanceName: "worker1", excludes: []string{"worker1", "worker2"}, timeout: 1}
+
+		if err := d.Execute(ctxt.NewContext()); err != nil {
+			t.Errorf("%s: execute: %v", c.name, err)
+		}
+		if len(f.targets) != 0 {
+			t.Errorf("%s: transfer targets = %v, want none", c.name, f.targets)
+		}
+	}
+}
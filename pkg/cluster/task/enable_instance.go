@@ -19,6 +19,7 @@ import (
 	"fmt"
 
 	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
 
 	"github.com/wentaojin/dmgr/pkg/dmgrutil"
 	"go.uber.org/zap"
@@ -35,6 +36,8 @@ type EnableInstance struct {
 	serviceName    string // 服务名
 	executeTimeout uint64 // 通过 SSH 连接时超时（以秒为单位）
 	isEnable       bool
+
+	exec executor.Executor // 回滚使用，非空表示已运行
 }
 
 // Execute implements the Task interface
@@ -43,11 +46,12 @@ func (e *EnableInstance) Execute(ctx *ctxt.Context) error {
 	if !found {
 		return ErrNoExecutor
 	}
+	e.exec = exec
 	action := module.OperatorDisable
 	if e.isEnable {
 		action = module.OperatorEnable
 	}
-	if err := systemctl(exec, e.serviceName, action, e.executeTimeout); err != nil {
+	if err := systemctl(ctx, exec, e.serviceName, action, e.executeTimeout); err != nil {
 		return toFailedActionError(err, action, e.host, e.instanceName, e.serviceName, e.logDir)
 	}
 	dmgrutil.Logger.Info("Enable/Disable instance success",
@@ -56,8 +60,19 @@ func (e *EnableInstance) Execute(ctx *ctxt.Context) error {
 }
 
 // Rollback implements the Task interface
+// 执行相反的 enable/disable 操作
 func (e *EnableInstance) Rollback(ctx *ctxt.Context) error {
-	ctx.SetExecutor(e.host, nil)
+	if e.exec == nil {
+		return nil
+	}
+	action := module.OperatorEnable
+	if e.isEnable {
+		action = module.OperatorDisable
+	}
+	if err := systemctl(ctx, e.exec, e.serviceName, action, e.executeTimeout); err != nil {
+		return toFailedActionError(err, action, e.host, e.instanceName, e.serviceName, e.logDir)
+	}
+	e.exec = nil
 	return nil
 }
 
@@ -65,3 +80,18 @@ func (e *EnableInstance) Rollback(ctx *ctxt.Context) error {
 func (e *EnableInstance) String() string {
 	return fmt.Sprintf("EnableInstance: host=%s, serviceName=%s, isEnable=%v", e.host, e.serviceName, e.isEnable)
 }
+
+// Describe implements the Task interface
+func (s *EnableInstance) Describe() Plan {
+	action := "systemctl disable"
+	if s.isEnable {
+		action = "systemctl enable"
+	}
+	return Plan{
+		Task:   "EnableInstance",
+		Host:   s.host,
+		Action: action,
+		Unit:   s.serviceName,
+		Params: map[string]string{"instance": s.instanceName},
+	}
+}
@@ -42,6 +42,12 @@ type EnvInit struct {
 	clusterUser    string
 	userGroup      string
 	skipCreateUser bool
+
+	// 回滚使用，记录本任务实际的变更
+	exec        executor.Executor
+	userCreated bool   // 集群用户由本任务创建
+	keyAdded    string // 写入授权文件的公钥
+	keysFile    string // 授权文件路径
 }
 
 // Execute implements the Task interface
@@ -54,8 +60,15 @@ func (e *EnvInit) Execute(ctx *ctxt.Context) error {
 	if !found {
 		return wrapError(ErrNoExecutor)
 	}
+	e.exec = exec
 
 	if !e.skipCreateUser {
+		stdout, _, err := exec.Execute(ctx, fmt.Sprintf(`id -u %s > /dev/null 2>&1 && echo exist || echo absent`, e.clusterUser), true)
+		if err != nil {
+			return wrapError(err)
+		}
+		userExist := strings.TrimSpace(string(stdout)) == "exist"
+
 		um := module.NewUserModule(module.UserModuleConfig{
 			Action: module.UserActionAdd,
 			Name:   e.clusterUser,
@@ -63,10 +76,14 @@ func (e *EnvInit) Execute(ctx *ctxt.Context) error {
 			Sudoer: true,
 		})
 
-		_, _, errx := um.Execute(exec)
+		_, _, errx := um.Execute(ctx, exec)
 		if errx != nil {
 			return wrapError(errx)
 		}
+		// 重试运行时保留首次运行记录的变更
+		if !userExist {
+			e.userCreated = true
+		}
 	}
 	pubKey, err := ioutil.ReadFile(ctx.PublicKeyPath)
 	if err != nil {
@@ -75,17 +92,17 @@ func (e *EnvInit) Execute(ctx *ctxt.Context) error {
 
 	// clusterUser Authorize(PublicKeyPath)
 	cmd := fmt.Sprintf(`su - %[1]s -c 'mkdir -p ~/.ssh && chmod 700 ~/.ssh'`, e.clusterUser)
-	_, stderr, err := exec.Execute(cmd, true)
+	_, stderr, err := exec.Execute(ctx, cmd, true)
 	if err != nil || len(stderr) > 0 {
 		return wrapError(errEnvInitSubCommandFailed.
 			Wrap(fmt.Errorf("error: %v, stderr: %v", err, string(stderr)), "Failed to create '~/.ssh' directory for user '%s'", e.clusterUser))
 	}
 
 	pk := strings.Fields(string(pubKey))
-	sshAuthorizedKeys := executor.FindSSHAuthorizedKeysFile(exec)
+	sshAuthorizedKeys := executor.FindSSHAuthorizedKeysFile(ctx, exec)
 	cmd = fmt.Sprintf(`su - %[1]s -c 'grep %[2]s %[3]s | wc -l'`,
 		e.clusterUser, pk[1], sshAuthorizedKeys)
-	stdout, stderr, err := exec.Execute(cmd, true)
+	stdout, stderr, err := exec.Execute(ctx, cmd, true)
 	// 忽略 sshAuthorizedKeys 文件不存在错误
 	if err != nil {
 		return wrapError(errEnvInitSubCommandFailed.
@@ -95,22 +112,58 @@ func (e *EnvInit) Execute(ctx *ctxt.Context) error {
 	if strings.Replace(string(stdout), "\n", "", -1) == "0" {
 		cmd = fmt.Sprintf(`su - %[1]s -c 'echo %[2]s >> %[3]s && chmod 600 %[3]s'`,
 			e.clusterUser, strings.Replace(string(pubKey), "\n", "", -1), sshAuthorizedKeys)
-		_, stderr, err = exec.Execute(cmd, true)
+		_, stderr, err = exec.Execute(ctx, cmd, true)
 		if err != nil || len(stderr) > 0 {
 			return wrapError(errEnvInitSubCommandFailed.
 				Wrap(fmt.Errorf("error: %v, stderr: %v", err, string(stderr)), "Failed to write public keys to '%s' for user '%s'", sshAuthorizedKeys, e.clusterUser))
 		}
+		e.keyAdded, e.keysFile = pk[1], sshAuthorizedKeys
 	}
 
 	return nil
 }
 
 // Rollback implements the Task interface
+// 1、集群用户由本任务创建，删除集群用户
+// 2、集群用户原先存在，删除本任务写入的公钥
 func (e *EnvInit) Rollback(ctx *ctxt.Context) error {
-	return ErrUnsupportedRollback
+	if e.userCreated {
+		um := module.NewUserModule(module.UserModuleConfig{
+			Action: module.UserActionDel,
+			Name:   e.clusterUser,
+		})
+		if _, _, err := um.Execute(ctx, e.exec); err != nil {
+			return ErrEnvInitFailed.Wrap(err, "Failed to delete user '%s' on remote host '%s'", e.clusterUser, e.host)
+		}
+		if _, _, err := e.exec.Execute(ctx, fmt.Sprintf(`rm -f /etc/sudoers.d/%s`, e.clusterUser), true); err != nil {
+			return ErrEnvInitFailed.Wrap(err, "Failed to delete sudoers of user '%s' on remote host '%s'", e.clusterUser, e.host)
+		}
+		e.userCreated, e.keyAdded = false, ""
+		return nil
+	}
+
+	if e.keyAdded != "" {
+		cmd := fmt.Sprintf(`su - %[1]s -c 'grep -vF %[2]s %[3]s > %[3]s.tmp; cat %[3]s.tmp > %[3]s && rm -f %[3]s.tmp'`,
+			e.clusterUser, e.keyAdded, e.keysFile)
+		if _, _, err := e.exec.Execute(ctx, cmd, true); err != nil {
+			return ErrEnvInitFailed.Wrap(err, "Failed to delete public key from '%s' for user '%s' on remote host '%s'", e.keysFile, e.clusterUser, e.host)
+		}
+		e.keyAdded = ""
+	}
+	return nil
 }
 
 // String implements the fmt.Stringer interface
 func (e *EnvInit) String() string {
 	return fmt.Sprintf("EnvInit: user=%s, host=%s", e.clusterUser, e.host)
 }
+
+// Describe implements the Task interface
+func (e *EnvInit) Describe() Plan {
+	return Plan{
+		Task:   "EnvInit",
+		Host:   e.host,
+		Action: "init user",
+		Params: map[string]string{"user": e.clusterUser, "group": e.userGroup, "skip_create_user": fmt.Sprint(e.skipCreateUser)},
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package task
+
+import (
+	"fmt"
+
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+)
+
+// Func 用于将本地运行等函数包装为任务，纳入步骤检查点
+type Func struct {
+	name string
+	fn   func(ctx *ctxt.Context) error
+}
+
+// Execute implements the Task interface
+func (f *Func) Execute(ctx *ctxt.Context) error {
+	return f.fn(ctx)
+}
+
+// Rollback implements the Task interface
+func (f *Func) Rollback(ctx *ctxt.Context) error {
+	return ErrUnsupportedRollback
+}
+
+// String implements the fmt.Stringer interface
+func (f *Func) String() string {
+	return fmt.Sprintf("Func: %s", f.name)
+}
+
+// Describe implements the Task interface
+func (f *Func) Describe() Plan {
+	return Plan{Task: "Func", Action: f.name}
+}
@@ -17,6 +17,7 @@ package task
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -35,25 +36,25 @@ import (
 )
 
 // PortStarted wait until a port is being listened
-func PortStarted(e executor.Executor, port uint64, timeout uint64) error {
+func PortStarted(ctx context.Context, e executor.Executor, port uint64, timeout uint64) error {
 	c := module.WaitForConfig{
 		Port:    int(port),
 		State:   "started",
 		Timeout: time.Duration(timeout) * time.Second,
 	}
 	w := module.NewWaitFor(c)
-	return w.Execute(e)
+	return w.Execute(ctx, e)
 }
 
 // PortStopped wait until a port is being released
-func PortStopped(e executor.Executor, port uint64, timeout uint64) error {
+func PortStopped(ctx context.Context, e executor.Executor, port uint64, timeout uint64) error {
 	c := module.WaitForConfig{
 		Port:    int(port),
 		State:   "stopped",
 		Timeout: time.Duration(timeout) * time.Second,
 	}
 	w := module.NewWaitFor(c)
-	return w.Execute(e)
+	return w.Execute(ctx, e)
 }
 
 // DeletePublicKey deletes the SSH public key from host
@@ -71,7 +72,7 @@ func DeletePublicKey(ctx *ctxt.Context, host string) error {
 
 	pubKey := string(bytes.TrimSpace(publicKey))
 	pubKey = strings.ReplaceAll(pubKey, "/", "\\/")
-	pubKeysFile := executor.FindSSHAuthorizedKeysFile(e)
+	pubKeysFile := executor.FindSSHAuthorizedKeysFile(ctx, e)
 
 	// delete the public key with Linux `sed` toolkit
 	c := module.ShellModuleConfig{
@@ -79,14 +80,14 @@ func DeletePublicKey(ctx *ctxt.Context, host string) error {
 		UseShell: false,
 	}
 	shell := module.NewShellModule(c)
-	stdout, stderr, err := shell.Execute(e)
+	stdout, stderr, err := shell.Execute(ctx, e)
 
 	if len(stdout) > 0 {
 		dmgrutil.Logger.Info(string(stdout))
 	}
 	if len(stderr) > 0 {
 		dmgrutil.Logger.Error("Delete public key failed", zap.String("host", host), zap.String("error", string(stderr)))
-		return errors.Annotatef(err, "failed to delete public key", zap.String("host", host))
+		return errors.Annotatef(err, "failed to delete public key on: %s", host)
 	}
 
 	if err != nil {
@@ -98,7 +99,7 @@ func DeletePublicKey(ctx *ctxt.Context, host string) error {
 }
 
 // 服务启动
-func systemctl(executor executor.Executor, service string, action string, timeout uint64) error {
+func systemctl(ctx context.Context, executor executor.Executor, service string, action string, timeout uint64) error {
 	c := module.SystemdModuleConfig{
 		Unit:           service,
 		ReloadDaemon:   true,
@@ -106,7 +107,7 @@ func systemctl(executor executor.Executor, service string, action string, timeou
 		ExecuteTimeout: time.Duration(timeout) * time.Second,
 	}
 	systemd := module.NewSystemdModule(c)
-	stdout, stderr, err := systemd.Execute(executor)
+	stdout, stderr, err := systemd.Execute(ctx, executor)
 
 	if len(stdout) > 0 {
 		dmgrutil.Logger.Warn("Systemctl", zap.String("Stdout", string(stdout)))
@@ -129,6 +130,15 @@ func systemctl(executor executor.Executor, service string, action string, timeou
 	return err
 }
 
+// 远程主机文件或目录是否存在
+func remotePathExist(ctx context.Context, e executor.Executor, path string) (bool, error) {
+	stdout, _, err := e.Execute(ctx, fmt.Sprintf(`test -e %s && echo exist || echo absent`, path), true)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(stdout)) == "exist", nil
+}
+
 // toFailedActionError formats the errror msg for failed action
 func toFailedActionError(err error, action string, host, instance, service, logDir string) error {
 	return errors.Annotatef(err,
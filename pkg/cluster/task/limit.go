@@ -0,0 +1,125 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package task
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+)
+
+// 并行任务并发限制，所有集群操作共享
+// 1、全局并发限制，避免打满 dmgr 主机带宽
+// 2、单主机并发限制，避免超出目标主机 sshd MaxStartups
+var limiter = struct {
+	sync.Mutex
+	global  chan struct{}            // nil 表示不限制
+	perHost int                      // 0 表示不限制
+	hosts   map[string]chan struct{} // 单主机并发令牌
+}{hosts: make(map[string]chan struct{})}
+
+// InitConcurrency 初始化并行任务全局以及单主机并发限制，0 表示不限制
+func InitConcurrency(cfg *dmgrutil.OperationConfig) {
+	limiter.Lock()
+	defer limiter.Unlock()
+	limiter.global = nil
+	if cfg.TaskConcurrency > 0 {
+		limiter.global = make(chan struct{}, cfg.TaskConcurrency)
+	}
+	limiter.perHost = cfg.HostConcurrency
+	limiter.hosts = make(map[string]chan struct{})
+}
+
+func hostSlot(host string) chan struct{} {
+	limiter.Lock()
+	defer limiter.Unlock()
+	if limiter.perHost <= 0 {
+		return nil
+	}
+	ch, ok := limiter.hosts[host]
+	if !ok {
+		ch = make(chan struct{}, limiter.perHost)
+		limiter.hosts[host] = ch
+	}
+	return ch
+}
+
+// 并行任务运行前获取全局以及涉及主机的并发令牌，返回释放函数
+// 1、包含嵌套 Parallel 的任务由内层 Parallel 获取令牌，避免外层占满令牌导致死锁
+// 2、按全局、主机名顺序获取令牌，避免相互等待
+func acquireSlots(ctx *ctxt.Context, t Task) (func(), error) {
+	plan := t.Describe()
+	if hasParallel(plan.Steps) {
+		return func() {}, nil
+	}
+
+	limiter.Lock()
+	slots := []chan struct{}{limiter.global}
+	limiter.Unlock()
+	for _, host := range planHosts(plan) {
+		slots = append(slots, hostSlot(host))
+	}
+
+	var acquired []chan struct{}
+	release := func() {
+		for _, ch := range acquired {
+			<-ch
+		}
+	}
+	for _, ch := range slots {
+		if ch == nil {
+			continue
+		}
+		select {
+		case ch <- struct{}{}:
+			acquired = append(acquired, ch)
+		case <-ctx.Done():
+			release()
+			return nil, fmt.Errorf("stop running tasks: %w", ctx.Err())
+		}
+	}
+	return release, nil
+}
+
+func hasParallel(plans []Plan) bool {
+	for _, p := range plans {
+		if p.Task == "Parallel" || hasParallel(p.Steps) {
+			return true
+		}
+	}
+	return false
+}
+
+// 任务涉及的目标主机，按主机名排序
+func planHosts(plan Plan) []string {
+	hosts := dmgrutil.NewStringSet()
+	var walk func(p Plan)
+	walk = func(p Plan) {
+		if p.Host != "" {
+			hosts.Insert(p.Host)
+		}
+		for _, s := range p.Steps {
+			walk(s)
+		}
+	}
+	walk(plan)
+	res := hosts.Slice()
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,125 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package task
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+)
+
+// planTask 只提供运行计划，用于并发令牌测试
+type planTask struct {
+	plan Plan
+}
+
+func (p *planTask) Execute(ctx *ctxt.Context) error  { return nil }
+func (p *planTask) Rollback(ctx *ctxt.Context) error { return ErrUnsupportedRollback }
+func (p *planTask) String() string                   { return "planTask" }
+func (p *planTask) Describe() Plan                   { return p.plan }
+
+func hostsTask(hosts ...string) Task {
+	plan := Plan{Task: "Serial"}
+	for _, h := range hosts {
+		plan.Steps = append(plan.Steps, Plan{Task: "CopyFile", Host: h})
+	}
+	return &planTask{plan: plan}
+}
+
+func TestAcquireSlotsHostOrder(t *testing.T) {
+	InitConcurrency(&dmgrutil.OperationConfig{HostConcurrency: 1})
+	defer InitConcurrency(&dmgrutil.OperationConfig{})
+
+	// 涉及主机相同但顺序相反的任务并发获取令牌，按主机名顺序获取时不会相互等待
+	tasks := []Task{hostsTask("h2", "h1"), hostsTask("h1", "h2")}
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task Task) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				release, err := acquireSlots(ctxt.NewContext(), task)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				release()
+			}
+		}(task)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquire host slots deadlocked")
+	}
+}
+
+func TestAcquireSlotsWaitsForGlobalSlot(t *testing.T) {
+	InitConcurrency(&dmgrutil.OperationConfig{TaskConcurrency: 1})
+	defer InitConcurrency(&dmgrutil.OperationConfig{})
+
+	release, err := acquireSlots(ctxt.NewContext(), hostsTask("h1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 令牌已被占用，上下文到期时返回错误
+	c, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := acquireSlots(ctxt.NewContextWith(c), hostsTask("h2")); err == nil {
+		t.Fatal("acquired global slot while it was held")
+	}
+
+	release()
+	release, err = acquireSlots(ctxt.NewContext(), hostsTask("h2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestAcquireSlotsSkipsNestedParallel(t *testing.T) {
+	InitConcurrency(&dmgrutil.OperationConfig{TaskConcurrency: 1, HostConcurrency: 1})
+	defer InitConcurrency(&dmgrutil.OperationConfig{})
+
+	release, err := acquireSlots(ctxt.NewContext(), hostsTask("h1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// 包含嵌套 Parallel 的任务由内层 Parallel 获取令牌，外层不占用令牌
+	nested := &planTask{plan: Plan{Task: "Serial", Steps: []Plan{
+		{Task: "Serial", Steps: []Plan{{Task: "Parallel", Steps: []Plan{{Task: "CopyFile", Host: "h1"}}}}},
+	}}}
+	c, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	noop, err := acquireSlots(ctxt.NewContextWith(c), nested)
+	if err != nil {
+		t.Fatalf("task with nested parallel waited for slots: %v", err)
+	}
+	noop()
+}
@@ -20,15 +20,23 @@ import (
 	"strings"
 
 	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
 
 	"github.com/pingcap/errors"
 )
 
+// 目录创建标识
+const mkdirCreatedFlag = "created"
+
 // Mkdir 用于在目标主机上创建目录
 type Mkdir struct {
 	user string
 	host string
 	dirs []string
+
+	// 回滚使用，记录本任务实际创建的目录
+	exec    executor.Executor
+	created []string
 }
 
 // Execute implements the Task interface
@@ -37,6 +45,7 @@ func (m *Mkdir) Execute(ctx *ctxt.Context) error {
 	if !found {
 		return ErrNoExecutor
 	}
+	m.exec = exec
 	for _, dir := range m.dirs {
 		if !strings.HasPrefix(dir, "/") {
 			return fmt.Errorf("dir is a relative path: %s", dir)
@@ -52,19 +61,25 @@ func (m *Mkdir) Execute(ctx *ctxt.Context) error {
 		// 		test -d /a || (mkdir /a && chown tidb:tidb /a)
 		//		test -d /a/b || (mkdir /a/b && chown tidb:tidb /a/b)
 		//		test -d /a/b/c || (mkdir /a/b/c && chown tidb:tidb /a/b/c)
+		// 新创建的目录输出 created 标识，用于回滚
 		for i := 0; i < len(xs); i++ {
 			if xs[i] == "" {
 				continue
 			}
+			path := strings.Join(xs[:i+1], "/")
 			cmd := fmt.Sprintf(
-				`test -d %[1]s || (mkdir -p %[1]s && chown %[2]s:$(id -g -n %[2]s) %[1]s)`,
-				strings.Join(xs[:i+1], "/"),
+				`test -d %[1]s || (mkdir -p %[1]s && chown %[2]s:$(id -g -n %[2]s) %[1]s && echo %[3]s)`,
+				path,
 				m.user,
+				mkdirCreatedFlag,
 			)
-			_, _, err := exec.Execute(cmd, true) // use root to create the dir
+			stdout, _, err := exec.Execute(ctx, cmd, true) // use root to create the dir
 			if err != nil {
 				return errors.Trace(err)
 			}
+			if strings.Contains(string(stdout), mkdirCreatedFlag) {
+				m.created = append(m.created, path)
+			}
 		}
 	}
 
@@ -72,11 +87,30 @@ func (m *Mkdir) Execute(ctx *ctxt.Context) error {
 }
 
 // Rollback implements the Task interface
+// 逆序删除本任务创建的目录，已存在的目录保持不变
 func (m *Mkdir) Rollback(ctx *ctxt.Context) error {
-	return ErrUnsupportedRollback
+	for i := len(m.created) - 1; i >= 0; i-- {
+		cmd := fmt.Sprintf(`rm -rf %s`, m.created[i])
+		if _, _, err := m.exec.Execute(ctx, cmd, true); err != nil {
+			return errors.Annotatef(err, "failed to remove dir %s on %s", m.created[i], m.host)
+		}
+		m.created = m.created[:i]
+	}
+	return nil
 }
 
 // String implements the fmt.Stringer interface
 func (m *Mkdir) String() string {
 	return fmt.Sprintf("Mkdir: host=%s, directories='%s'", m.host, strings.Join(m.dirs, "','"))
 }
+
+// Describe implements the Task interface
+func (m *Mkdir) Describe() Plan {
+	return Plan{
+		Task:   "Mkdir",
+		Host:   m.host,
+		Action: "mkdir -p",
+		Dirs:   m.dirs,
+		Params: map[string]string{"owner": m.user},
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package task
+
+import (
+	"context"
+	"sync"
+
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+)
+
+// Plan 任务运行计划，描述任务将在哪台主机执行什么操作
+type Plan struct {
+	Task   string            `json:"task"`             // 任务类型
+	Name   string            `json:"name,omitempty"`   // 任务组名称
+	Host   string            `json:"host,omitempty"`   // 目标主机，空表示本机
+	Action string            `json:"action,omitempty"` // 操作
+	Unit   string            `json:"unit,omitempty"`   // systemd 服务
+	Src    string            `json:"src,omitempty"`    // 源文件
+	Dst    string            `json:"dst,omitempty"`    // 目标文件
+	Dirs   []string          `json:"dirs,omitempty"`   // 创建或删除的目录、文件
+	Params map[string]string `json:"params,omitempty"` // 其他参数
+	Steps  []Plan            `json:"steps,omitempty"`  // 任务组内部任务
+}
+
+// Planner 收集 dry run 运行计划
+type Planner struct {
+	mu    sync.Mutex
+	plans []Plan
+}
+
+type plannerKey struct{}
+
+// NewDryRunContext 返回 dry run 上下文，任务只记录运行计划，不实际运行
+func NewDryRunContext() (*ctxt.Context, *Planner) {
+	p := &Planner{}
+	return ctxt.NewContextWith(context.WithValue(context.Background(), plannerKey{}, p)), p
+}
+
+// Plans 已收集的运行计划
+func (p *Planner) Plans() []Plan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	plans := make([]Plan, len(p.plans))
+	copy(plans, p.plans)
+	return plans
+}
+
+func (p *Planner) add(plan Plan) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.plans = append(p.plans, plan)
+}
+
+// dry run 时记录任务运行计划并返回 true
+func planned(ctx *ctxt.Context, t Task) bool {
+	p, ok := ctx.Value(plannerKey{}).(*Planner)
+	if !ok {
+		return false
+	}
+	p.add(t.Describe())
+	return true
+}
+
+// 任务组内部任务运行计划
+func describeTasks(tasks []Task) []Plan {
+	var plans []Plan
+	for _, t := range tasks {
+		plans = append(plans, t.Describe())
+	}
+	return plans
+}
@@ -0,0 +1,175 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package task
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joomcode/errorx"
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/cluster/event"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+	"github.com/wentaojin/dmgr/pkg/cluster/module"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"go.uber.org/zap"
+)
+
+// TransientErrors SSH 执行失败、超时、文件传输校验不一致以及等待组件启动超时等临时错误
+var TransientErrors = []*errorx.Type{
+	executor.ErrSSHExecuteFailed,
+	executor.ErrSSHExecuteTimedout,
+	ErrChecksumMismatch,
+	module.ErrWaitForTimeout,
+}
+
+// RetryPolicy 任务重试策略
+type RetryPolicy struct {
+	Attempts  int            // 最大运行次数，包含首次运行
+	Delay     time.Duration  // 首次重试前等待时间
+	Backoff   float64        // 每次重试等待时间倍数，小于等于 1 表示固定等待时间
+	MaxDelay  time.Duration  // 最大等待时间，0 表示不限制
+	Retryable []*errorx.Type // 可重试的错误类型，空表示所有错误均可重试
+}
+
+// DefaultRetryPolicy 临时错误重试 3 次，等待时间 2s、4s
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:  3,
+		Delay:     2 * time.Second,
+		Backoff:   2,
+		MaxDelay:  30 * time.Second,
+		Retryable: TransientErrors,
+	}
+}
+
+// 错误是否可重试，取消或到期以及主机公钥校验失败的错误不重试
+func (p RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, ErrNoExecutor) || matchErrorType(err, []*errorx.Type{
+		executor.ErrSSHExecuteCanceled,
+		executor.ErrSSHHostKeyUntrusted,
+		executor.ErrSSHHostKeyMismatch,
+	}) {
+		return false
+	}
+	if len(p.Retryable) == 0 {
+		return true
+	}
+	return matchErrorType(err, p.Retryable)
+}
+
+// 第 attempt 次运行失败后的等待时间
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Delay
+	for i := 1; i < attempt && p.Backoff > 1; i++ {
+		d = time.Duration(float64(d) * p.Backoff)
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+// 沿错误链匹配 errorx 错误类型，兼容 pingcap/errors Annotate 包装的错误
+func matchErrorType(err error, types []*errorx.Type) bool {
+	for err != nil {
+		if e := errorx.Cast(err); e != nil {
+			for _, t := range types {
+				if e.IsOfType(t) {
+					return true
+				}
+			}
+		}
+		switch v := err.(type) {
+		case interface{ Unwrap() error }:
+			err = v.Unwrap()
+		case interface{ Cause() error }:
+			err = v.Cause()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// Retry 按重试策略运行任务或任务组
+type Retry struct {
+	inner  Task
+	policy RetryPolicy
+}
+
+// WithRetry 为任务或任务组设置重试策略
+func WithRetry(t Task, policy RetryPolicy) Task {
+	return &Retry{inner: t, policy: policy}
+}
+
+// Execute implements the Task interface
+// 任务组重试时，已完成的步骤根据步骤检查点跳过
+func (r *Retry) Execute(ctx *ctxt.Context) error {
+	mark := ctx.StepMark()
+	for attempt := 1; ; attempt++ {
+		err := r.inner.Execute(ctx)
+		if err == nil || attempt >= r.policy.Attempts || !r.policy.retryable(err) {
+			return err
+		}
+		if errCanceled := checkCanceled(ctx); errCanceled != nil {
+			return err
+		}
+
+		delay := r.policy.delay(attempt)
+		msg := fmt.Sprintf("step [%s] attempt %d/%d failed, retry after %s: %v", r.inner.String(), attempt, r.policy.Attempts, delay, err)
+		dmgrutil.Logger.Warn("Retry", zap.String("msg", msg))
+		ctx.Emit(event.Event{Type: event.Retry, Step: r.inner.String(), Status: fmt.Sprintf("%d/%d", attempt, r.policy.Attempts), Error: err.Error()})
+		if errRecord := ctx.RecordRetry(msg); errRecord != nil {
+			dmgrutil.Logger.Error("Retry", zap.Error(errRecord))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		if isTaskGroup(r.inner) {
+			ctx.RewindSteps(mark)
+		}
+	}
+}
+
+// Rollback implements the Task interface
+func (r *Retry) Rollback(ctx *ctxt.Context) error {
+	return r.inner.Rollback(ctx)
+}
+
+// String implements the fmt.Stringer interface
+func (r *Retry) String() string {
+	return r.inner.String()
+}
+
+// Describe implements the Task interface
+func (r *Retry) Describe() Plan {
+	plan := r.inner.Describe()
+	if plan.Params == nil {
+		plan.Params = make(map[string]string)
+	}
+	plan.Params["retry_attempts"] = fmt.Sprint(r.policy.Attempts)
+	return plan
+}
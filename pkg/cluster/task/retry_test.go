@@ -0,0 +1,140 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package task
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joomcode/errorx"
+	perrors "github.com/pingcap/errors"
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"go.uber.org/zap"
+)
+
+func fastRetry(attempts int, retryable ...*errorx.Type) RetryPolicy {
+	return RetryPolicy{Attempts: attempts, Delay: time.Millisecond, Retryable: retryable}
+}
+
+// 任务组重试时回退步骤出现次序，首次运行已完成的步骤根据检查点跳过，只重新运行失败的步骤
+func TestRetryGroupSkipsFinishedSteps(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+
+	var runs []string
+	failures := 1
+	group := NewBuilder().
+		Func("upload", func(ctx *ctxt.Context) error {
+			runs = append(runs, "upload")
+			return nil
+		}).
+		Func("start", func(ctx *ctxt.Context) error {
+			runs = append(runs, "start")
+			if failures > 0 {
+				failures--
+				return perrors.Annotate(executor.ErrSSHExecuteFailed.New("connection reset"), "failed to start")
+			}
+			return nil
+		}).
+		BuildTask()
+
+	var recorded, retries []string
+	ctx := ctxt.NewContext()
+	ctx.SetCheckpoint(nil, func(stepKey, stepName string) error {
+		recorded = append(recorded, stepName)
+		return nil
+	})
+	ctx.SetRetryRecord(func(msg string) error {
+		retries = append(retries, msg)
+		return nil
+	})
+
+	if err := WithRetry(group, fastRetry(3, TransientErrors...)).Execute(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"upload", "start", "start"}; !reflect.DeepEqual(runs, want) {
+		t.Fatalf("runs = %v, want %v", runs, want)
+	}
+	if want := []string{"Func: upload", "Func: start"}; !reflect.DeepEqual(recorded, want) {
+		t.Fatalf("recorded steps = %v, want %v", recorded, want)
+	}
+	if len(retries) != 1 {
+		t.Fatalf("recorded %d retries, want 1", len(retries))
+	}
+
+	// 重试后的步骤标识与未重试时一致，后续同名步骤不会被误判为已完成
+	if key := ctx.StepKey("Func: start"); ctx.StepDone(key) {
+		t.Fatal("next occurrence of retried step reported done")
+	}
+}
+
+func TestRetryStopsOnNonRetryableError(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+
+	attempts := 0
+	task := &Func{name: "check", fn: func(ctx *ctxt.Context) error {
+		attempts++
+		return errors.New("config invalid")
+	}}
+	if err := WithRetry(task, fastRetry(3, TransientErrors...)).Execute(ctxt.NewContext()); err == nil {
+		t.Fatal("retry returned nil error")
+	}
+	if attempts != 1 {
+		t.Fatalf("non retryable error ran %d attempts, want 1", attempts)
+	}
+
+	attempts = 0
+	if err := WithRetry(task, fastRetry(3)).Execute(ctxt.NewContext()); err == nil {
+		t.Fatal("retry returned nil error")
+	}
+	if attempts != 3 {
+		t.Fatalf("retry without error types ran %d attempts, want 3", attempts)
+	}
+}
+
+func TestRetryStopsWhenCanceled(t *testing.T) {
+	dmgrutil.Logger = zap.NewNop()
+
+	c, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	task := &Func{name: "start", fn: func(ctx *ctxt.Context) error {
+		attempts++
+		cancel()
+		return executor.ErrSSHExecuteTimedout.New("timed out")
+	}}
+	if err := WithRetry(task, fastRetry(3)).Execute(ctxt.NewContextWith(c)); err == nil {
+		t.Fatal("retry returned nil error")
+	}
+	if attempts != 1 {
+		t.Fatalf("canceled operation ran %d attempts, want 1", attempts)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Delay: 2 * time.Second, Backoff: 2, MaxDelay: 5 * time.Second}
+	var got []time.Duration
+	for attempt := 1; attempt <= 4; attempt++ {
+		got = append(got, p.delay(attempt))
+	}
+	want := []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("delays = %v, want %v", got, want)
+	}
+}
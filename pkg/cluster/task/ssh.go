@@ -32,12 +32,19 @@ type RootSSH struct {
 	password       string // SSH 服务器的登录用户密码
 	keyFile        string // 私钥文件的路径
 	passphrase     string // 私钥文件的密码
+	sudoPassword   string // 登录用户 sudo 密码，空表示免密 sudo
 	connectTimeout uint64 // 通过 SSH 连接时超时（以秒为单位）
 	executeTimeout uint64 // 以秒为单位的超时等待命令完成
 }
 
 // Execute implements the Task interface
+// dmgr 所在本机使用本地执行器，无需 SSH
 func (s *RootSSH) Execute(ctx *ctxt.Context) error {
+	if executor.IsLocalHost(s.host) {
+		ctx.SetExecutor(s.host, executor.NewLocalExecutor(s.host, s.user, true))
+		return nil
+	}
+
 	sc := executor.SSHConfig{
 		Host:           s.host,
 		Port:           int(s.port),
@@ -47,6 +54,9 @@ func (s *RootSSH) Execute(ctx *ctxt.Context) error {
 		Passphrase:     s.passphrase,
 		ConnectTimeout: time.Duration(s.connectTimeout) * time.Second,
 		ExecuteTimeout: time.Duration(s.executeTimeout) * time.Second,
+		Proxy:          ctx.SSHProxy(s.host),
+		Fingerprint:    ctx.SSHHostKey(s.host, s.port),
+		SudoPassword:   s.sudoPassword,
 	}
 
 	e, err := executor.NewSSHExecutor(s.user != "root", sc)
@@ -84,7 +94,13 @@ type UserSSH struct {
 }
 
 // Execute implements the Task interface
+// dmgr 所在本机使用本地执行器，以集群用户运行命令
 func (s *UserSSH) Execute(ctx *ctxt.Context) error {
+	if executor.IsLocalHost(s.host) {
+		ctx.SetExecutor(s.host, executor.NewLocalExecutor(s.host, s.clusterUser, false))
+		return nil
+	}
+
 	sc := executor.SSHConfig{
 		Host:           s.host,
 		Port:           int(s.port),
@@ -92,6 +108,8 @@ func (s *UserSSH) Execute(ctx *ctxt.Context) error {
 		ConnectTimeout: time.Duration(s.connectTimeout) * time.Second,
 		ExecuteTimeout: time.Duration(s.executeTimeout) * time.Second,
 		KeyFile:        ctx.PrivateKeyPath,
+		Proxy:          ctx.SSHProxy(s.host),
+		Fingerprint:    ctx.SSHHostKey(s.host, s.port),
 	}
 
 	e, err := executor.NewSSHExecutor(false, sc)
@@ -115,3 +133,30 @@ func (s *UserSSH) Rollback(ctx *ctxt.Context) error {
 func (s *UserSSH) String() string {
 	return fmt.Sprintf("UserSSH: user=%s, host=%s", s.clusterUser, s.host)
 }
+
+// Describe implements the Task interface
+func (s *RootSSH) Describe() Plan {
+	return Plan{
+		Task:   "RootSSH",
+		Host:   s.host,
+		Action: connectAction(s.host),
+		Params: map[string]string{"user": s.user, "port": fmt.Sprint(s.port)},
+	}
+}
+
+// Describe implements the Task interface
+func (s *UserSSH) Describe() Plan {
+	return Plan{
+		Task:   "UserSSH",
+		Host:   s.host,
+		Action: connectAction(s.host),
+		Params: map[string]string{"user": s.clusterUser, "port": fmt.Sprint(s.port)},
+	}
+}
+
+func connectAction(host string) string {
+	if executor.IsLocalHost(host) {
+		return "local"
+	}
+	return "connect"
+}
@@ -17,8 +17,8 @@ package task
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/mitchellh/go-homedir"
 
@@ -58,9 +58,12 @@ func (s *SSHKeyCopy) Execute(ctx *ctxt.Context) error {
 		return err
 	}
 
-	// SSH 认证文件分发
+	// SSH 认证文件分发，dmgr 所在本机使用本地执行器，无需分发
 	wp := workpool.New(s.workerThreads)
 	for _, host := range s.hosts {
+		if executor.IsLocalHost(host.SshHost) {
+			continue
+		}
 		server := host
 		edFile := expandedHomePath
 		timeout := s.executeTimeout
@@ -90,7 +93,7 @@ func (s *SSHKeyCopy) Execute(ctx *ctxt.Context) error {
 
 	// 本机 COPY 认证文件到集群管理目录
 	currentUser, currentIP, err := dmgrutil.GetClientOutBoundIP()
-	_, stdErr, err := executor.NewLocalExecutor(currentIP, currentUser, currentUser == "root").Execute(fmt.Sprintf("cp %v %v;cp %v %v", expandedHomePath, edSshPath, expandedHomePubPath, edSshPubPath), executor.DefaultExecuteTimeout)
+	_, stdErr, err := executor.NewLocalExecutor(currentIP, currentUser, currentUser == "root").Execute(ctx, fmt.Sprintf("cp %v %v;cp %v %v", expandedHomePath, edSshPath, expandedHomePubPath, edSshPubPath), false)
 	if err != nil || len(stdErr) != 0 {
 		return fmt.Errorf("local copy err: [%v], stderr: [%v]", err, string(stdErr))
 	}
@@ -102,10 +105,26 @@ func (s *SSHKeyCopy) Execute(ctx *ctxt.Context) error {
 
 // Rollback implements the Task interface
 func (s *SSHKeyCopy) Rollback(ctx *ctxt.Context) error {
-	return os.Remove(s.clusterSshDir)
+	// 集群 SSH 密钥可能已被集群使用（扩容），不回滚
+	return ErrUnsupportedRollback
 }
 
 // String implements the fmt.Stringer interface
 func (s *SSHKeyCopy) String() string {
 	return fmt.Sprintf("SSHKeyCopy: homePath=%s, clusterPath=%s", s.homeSshDir, s.clusterSshDir)
 }
+
+// Describe implements the Task interface
+func (s *SSHKeyCopy) Describe() Plan {
+	var hosts []string
+	for _, h := range s.hosts {
+		hosts = append(hosts, h.SshHost)
+	}
+	return Plan{
+		Task:   "SSHKeyCopy",
+		Action: "ssh-copy-id",
+		Src:    filepath.Join(s.homeSshDir, "id_ed25519"),
+		Dst:    filepath.Join(s.clusterSshDir, "id_ed25519"),
+		Params: map[string]string{"hosts": strings.Join(hosts, ",")},
+	}
+}
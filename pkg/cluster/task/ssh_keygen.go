@@ -88,10 +88,20 @@ func (s *SSHKeyGen) Execute(ctx *ctxt.Context) error {
 
 // Rollback implements the Task interface
 func (s *SSHKeyGen) Rollback(ctx *ctxt.Context) error {
-	return ErrNoExecutor
+	// 家目录 SSH 密钥被其他集群共享使用，不回滚
+	return ErrUnsupportedRollback
 }
 
 // String implements the fmt.Stringer interface
 func (s *SSHKeyGen) String() string {
 	return fmt.Sprintf("SSHKeyGen: homePath=%s", s.homeSshDir)
 }
+
+// Describe implements the Task interface
+func (s *SSHKeyGen) Describe() Plan {
+	return Plan{
+		Task:   "SSHKeyGen",
+		Action: "ssh-keygen",
+		Dst:    filepath.Join(s.homeSshDir, "id_ed25519"),
+	}
+}
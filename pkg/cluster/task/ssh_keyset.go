@@ -45,3 +45,12 @@ func (s *SSHKeySet) Rollback(ctx *ctxt.Context) error {
 func (s *SSHKeySet) String() string {
 	return fmt.Sprintf("SSHKeySet: privateKey=%s, publicKey=%s", s.privateKeyPath, s.publicKeyPath)
 }
+
+// Describe implements the Task interface
+func (s *SSHKeySet) Describe() Plan {
+	return Plan{
+		Task:   "SSHKeySet",
+		Action: "use ssh key",
+		Params: map[string]string{"private_key": s.privateKeyPath, "public_key": s.publicKeyPath},
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package task
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+)
+
+// StageComponent 上传组件文件至目标主机暂存目录，同一主机的多个实例从暂存目录本地复制，组件文件只上传一次
+type StageComponent struct {
+	host      string
+	srcPath   string
+	stagePath string
+
+	// 回滚使用
+	exec     executor.Executor
+	uploaded bool
+}
+
+// Execute implements the Task interface
+// 暂存文件已存在且校验一致时（如重试运行）跳过上传
+func (s *StageComponent) Execute(ctx *ctxt.Context) error {
+	exec, found := ctx.GetExecutor(s.host)
+	if !found {
+		return ErrNoExecutor
+	}
+	s.exec = exec
+
+	checksum, err := componentChecksum(s.srcPath)
+	if err != nil {
+		return errors.Annotatef(err, "failed to checksum %s", s.srcPath)
+	}
+	stdout, _, err := exec.Execute(ctx, fmt.Sprintf(`if [ -f %[1]s ]; then sha256sum %[1]s; fi`, s.stagePath), false)
+	if err != nil {
+		return errors.Annotatef(err, "failed to check %s:%s", s.host, s.stagePath)
+	}
+	if fields := strings.Fields(string(stdout)); len(fields) > 0 && fields[0] == checksum {
+		return nil
+	}
+
+	s.uploaded = true
+	if err := exec.Transfer(ctx, s.srcPath, s.stagePath, false, 0); err != nil {
+		return errors.Annotatef(err, "failed to scp %s to %s:%s", s.srcPath, s.host, s.stagePath)
+	}
+	// 校验暂存文件，不一致时按重试策略重新上传
+	return verifyRemoteChecksum(ctx, exec, s.host, s.stagePath, checksum, false)
+}
+
+// Rollback implements the Task interface
+func (s *StageComponent) Rollback(ctx *ctxt.Context) error {
+	if s.exec == nil || !s.uploaded {
+		return nil
+	}
+	if _, _, err := s.exec.Execute(ctx, fmt.Sprintf(`rm -f %s`, s.stagePath), false); err != nil {
+		return errors.Annotatef(err, "failed to remove %s:%s", s.host, s.stagePath)
+	}
+	s.uploaded = false
+	return nil
+}
+
+// String implements the fmt.Stringer interface
+func (s *StageComponent) String() string {
+	return fmt.Sprintf("StageComponent: src=%s, remote=%s:%s", s.srcPath, s.host, s.stagePath)
+}
+
+// Describe implements the Task interface
+func (s *StageComponent) Describe() Plan {
+	return Plan{
+		Task:   "StageComponent",
+		Host:   s.host,
+		Action: "upload",
+		Src:    s.srcPath,
+		Dst:    s.stagePath,
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 
 	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
 
 	"go.uber.org/zap"
 
@@ -35,6 +36,8 @@ type StartInstance struct {
 	logDir         string
 	serviceName    string // 服务名
 	executeTimeout uint64 // 通过 SSH 连接时超时（以秒为单位）
+
+	exec executor.Executor // 回滚使用，非空表示已运行
 }
 
 // Execute implements the Task interface
@@ -43,12 +46,13 @@ func (s *StartInstance) Execute(ctx *ctxt.Context) error {
 	if !found {
 		return ErrNoExecutor
 	}
-	if err := systemctl(exec, s.serviceName, module.OperatorStart, s.executeTimeout); err != nil {
+	s.exec = exec
+	if err := systemctl(ctx, exec, s.serviceName, module.OperatorStart, s.executeTimeout); err != nil {
 		return toFailedActionError(err, module.OperatorStart, s.host, s.instanceName, s.serviceName, s.logDir)
 	}
 
 	// Check ready.
-	if err := PortStarted(exec, s.servicePort, s.executeTimeout); err != nil {
+	if err := PortStarted(ctx, exec, s.servicePort, s.executeTimeout); err != nil {
 		return toFailedActionError(err, module.OperatorStart, s.host, s.instanceName, s.serviceName, s.logDir)
 	}
 	dmgrutil.Logger.Info("Start host instance success",
@@ -59,8 +63,18 @@ func (s *StartInstance) Execute(ctx *ctxt.Context) error {
 }
 
 // Rollback implements the Task interface
+// 停止已启动的组件实例
 func (s *StartInstance) Rollback(ctx *ctxt.Context) error {
-	ctx.SetExecutor(s.host, nil)
+	if s.exec == nil {
+		return nil
+	}
+	if err := systemctl(ctx, s.exec, s.serviceName, module.OperatorStop, s.executeTimeout); err != nil {
+		return toFailedActionError(err, module.OperatorStop, s.host, s.instanceName, s.serviceName, s.logDir)
+	}
+	if err := PortStopped(ctx, s.exec, s.servicePort, s.executeTimeout); err != nil {
+		return toFailedActionError(err, module.OperatorStop, s.host, s.instanceName, s.serviceName, s.logDir)
+	}
+	s.exec = nil
 	return nil
 }
 
@@ -68,3 +82,14 @@ func (s *StartInstance) Rollback(ctx *ctxt.Context) error {
 func (s *StartInstance) String() string {
 	return fmt.Sprintf("StartInstance: host=%s, serviceName=%s", s.host, s.serviceName)
 }
+
+// Describe implements the Task interface
+func (s *StartInstance) Describe() Plan {
+	return Plan{
+		Task:   "StartInstance",
+		Host:   s.host,
+		Action: "systemctl start",
+		Unit:   s.serviceName,
+		Params: map[string]string{"instance": s.instanceName, "port": fmt.Sprint(s.servicePort)},
+	}
+}
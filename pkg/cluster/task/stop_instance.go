@@ -41,11 +41,11 @@ func (s *StopInstance) Execute(ctx *ctxt.Context) error {
 	if !found {
 		return ErrNoExecutor
 	}
-	if err := systemctl(exec, s.serviceName, module.OperatorStop, s.executeTimeout); err != nil {
+	if err := systemctl(ctx, exec, s.serviceName, module.OperatorStop, s.executeTimeout); err != nil {
 		return toFailedActionError(err, module.OperatorStop, s.host, s.instanceName, s.serviceName, s.logDir)
 	}
 	// Check stop.
-	if err := PortStopped(exec, s.servicePort, s.executeTimeout); err != nil {
+	if err := PortStopped(ctx, exec, s.servicePort, s.executeTimeout); err != nil {
 		return toFailedActionError(err, module.OperatorStart, s.host, s.instanceName, s.serviceName, s.logDir)
 	}
 	dmgrutil.Logger.Info("Stop instance success", zap.String("instance", s.instanceName))
@@ -62,3 +62,14 @@ func (s *StopInstance) Rollback(ctx *ctxt.Context) error {
 func (s *StopInstance) String() string {
 	return fmt.Sprintf("StopInstance: host=%s, serviceName=%s", s.host, s.serviceName)
 }
+
+// Describe implements the Task interface
+func (s *StopInstance) Describe() Plan {
+	return Plan{
+		Task:   "StopInstance",
+		Host:   s.host,
+		Action: "systemctl stop",
+		Unit:   s.serviceName,
+		Params: map[string]string{"instance": s.instanceName, "port": fmt.Sprint(s.servicePort)},
+	}
+}
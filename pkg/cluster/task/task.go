@@ -22,6 +22,7 @@ import (
 	"sync"
 
 	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/cluster/event"
 
 	"github.com/wentaojin/dmgr/pkg/dmgrutil"
 	"go.uber.org/zap"
@@ -47,17 +48,21 @@ type (
 		fmt.Stringer
 		Execute(ctx *ctxt.Context) error
 		Rollback(ctx *ctxt.Context) error
+		// Describe 返回任务运行计划，用于 dry run
+		Describe() Plan
 	}
 
 	// Serial 会以序列化的方式执行一组任务
 	Serial struct {
 		ignoreError       bool
 		hideDetailDisplay bool
+		rollback          bool // 运行失败时逆序回滚已运行的任务
 		inner             []Task
 	}
 
-	// Parallel 会以并行方式执行一组任务
+	// Parallel 会以并行方式执行一组任务，受全局以及单主机并发限制
 	Parallel struct {
+		prefix            string
 		ignoreError       bool
 		hideDetailDisplay bool
 		inner             []Task
@@ -66,27 +71,65 @@ type (
 
 // Execute implements the Task interface
 func (s *Serial) Execute(ctx *ctxt.Context) error {
-	for _, t := range s.inner {
+	if planned(ctx, s) {
+		return nil
+	}
+	for i, t := range s.inner {
+		if err := checkCanceled(ctx); err != nil {
+			return err
+		}
 		if !s.hideDetailDisplay {
 			dmgrutil.Logger.Info("Serial", zap.String("msg", t.String()))
 		}
-		err := t.Execute(ctx)
+		err := executeStep(ctx, t)
 		if err != nil && !s.ignoreError {
+			if s.rollback {
+				return s.rollbackExecuted(ctx, i, err)
+			}
 			return err
 		}
 	}
 	return nil
 }
 
+// 逆序回滚已运行的任务（包含运行失败的任务），回滚结果包含在返回错误中
+// 回滚使用不受取消或到期影响的上下文，确保集群操作取消后仍可清理
+func (s *Serial) rollbackExecuted(ctx *ctxt.Context, failed int, cause error) error {
+	dmgrutil.Logger.Warn("Rollback", zap.Error(cause))
+
+	rctx := ctx.Detach()
+	var errs []string
+	for i := failed; i >= 0; i-- {
+		if err := s.inner[i].Rollback(rctx); err != nil && !errors.Is(err, ErrUnsupportedRollback) {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	ev := event.Event{Type: event.Rollback, Status: "succeeded"}
+	if len(errs) > 0 {
+		ev.Status, ev.Error = "failed", strings.Join(errs, "; ")
+		dmgrutil.Logger.Error("Rollback", zap.String("status", ev.Status), zap.String("error", ev.Error))
+		ctx.Emit(ev)
+		return fmt.Errorf("%w; rollback failed: %s", cause, ev.Error)
+	}
+	dmgrutil.Logger.Info("Rollback", zap.String("status", ev.Status))
+	ctx.Emit(ev)
+	return fmt.Errorf("%w; rollback succeeded", cause)
+}
+
 // Rollback implements the Task interface
+// 逆序回滚全部任务，不支持回滚的任务忽略，回滚失败继续回滚其他任务
 func (s *Serial) Rollback(ctx *ctxt.Context) error {
-	// Rollback in reverse order
+	var errs []string
 	for i := len(s.inner) - 1; i >= 0; i-- {
 		err := s.inner[i].Rollback(ctx)
-		if err != nil {
-			return err
+		if err != nil && !errors.Is(err, ErrUnsupportedRollback) {
+			errs = append(errs, err.Error())
 		}
 	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
 	return nil
 }
 
@@ -99,8 +142,20 @@ func (s *Serial) String() string {
 	return strings.Join(ss, "\n")
 }
 
+// Describe implements the Task interface
+func (s *Serial) Describe() Plan {
+	return Plan{Task: "Serial", Steps: describeTasks(s.inner)}
+}
+
 // Execute implements the Task interface
 func (p *Parallel) Execute(ctx *ctxt.Context) error {
+	if planned(ctx, p) {
+		return nil
+	}
+	if p.prefix != "" {
+		ctx.Emit(event.Event{Type: event.GroupStart, Step: p.prefix})
+	}
+
 	var firstError error
 	var mu sync.Mutex
 	wg := sync.WaitGroup{}
@@ -109,10 +164,29 @@ func (p *Parallel) Execute(ctx *ctxt.Context) error {
 		go func(t Task, logger *zap.Logger) {
 			defer wg.Done()
 
+			if err := checkCanceled(ctx); err != nil {
+				mu.Lock()
+				if firstError == nil {
+					firstError = err
+				}
+				mu.Unlock()
+				return
+			}
+			release, err := acquireSlots(ctx, t)
+			if err != nil {
+				mu.Lock()
+				if firstError == nil {
+					firstError = err
+				}
+				mu.Unlock()
+				return
+			}
+			defer release()
+
 			if !p.hideDetailDisplay {
 				logger.Info("Parallel", zap.String("msg", t.String()))
 			}
-			err := t.Execute(ctx)
+			err = executeStep(ctx, t)
 			if err != nil {
 				mu.Lock()
 				if firstError == nil {
@@ -123,6 +197,17 @@ func (p *Parallel) Execute(ctx *ctxt.Context) error {
 		}(t, dmgrutil.Logger)
 	}
 	wg.Wait()
+	if p.prefix != "" {
+		ev := event.Event{Type: event.GroupFinish, Step: p.prefix}
+		if firstError != nil {
+			ev.Error = firstError.Error()
+		}
+		ctx.Emit(ev)
+	}
+	// 取消或到期不受 ignoreError 影响
+	if err := checkCanceled(ctx); err != nil {
+		return err
+	}
 	if p.ignoreError {
 		return nil
 	}
@@ -139,7 +224,7 @@ func (p *Parallel) Rollback(ctx *ctxt.Context) error {
 		go func(t Task) {
 			defer wg.Done()
 			err := t.Rollback(ctx)
-			if err != nil {
+			if err != nil && !errors.Is(err, ErrUnsupportedRollback) {
 				mu.Lock()
 				if firstError == nil {
 					firstError = err
@@ -160,3 +245,79 @@ func (p *Parallel) String() string {
 	}
 	return strings.Join(ss, "\n")
 }
+
+// Describe implements the Task interface
+func (p *Parallel) Describe() Plan {
+	return Plan{Task: "Parallel", Name: p.prefix, Steps: describeTasks(p.inner)}
+}
+
+// 上下文取消或到期时不再运行新的任务
+func checkCanceled(ctx *ctxt.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("stop running tasks: %w", err)
+	}
+	return nil
+}
+
+// 运行单个步骤
+// 1、已完成的步骤（断点续做）直接跳过
+// 2、运行成功记录步骤检查点，建立连接、设置密钥等上下文任务每次均需运行，不记录
+func executeStep(ctx *ctxt.Context, t Task) error {
+	var stepKey string
+	if !isTaskGroup(t) && !isContextTask(t) {
+		stepKey = ctx.StepKey(t.String())
+	}
+	if ctx.StepDone(stepKey) {
+		dmgrutil.Logger.Info("Skip finished step", zap.String("msg", t.String()))
+		ctx.Emit(event.Event{Type: event.StepFinish, Step: t.String(), Status: "skipped"})
+		return nil
+	}
+
+	emitStepStart(ctx, t)
+	err := t.Execute(ctx)
+	emitStepFinish(ctx, t, err)
+	if err != nil {
+		return err
+	}
+	return ctx.RecordStep(stepKey, t.String())
+}
+
+// 上下文任务只设置运行上下文，不变更远程主机
+func isContextTask(t Task) bool {
+	switch v := t.(type) {
+	case *Retry:
+		return isContextTask(v.inner)
+	case *RootSSH, *UserSSH, *SSHKeySet, *SSHKeyCopy:
+		return true
+	}
+	return false
+}
+
+// 任务组 Serial、Parallel 由内部任务推送步骤事件
+func isTaskGroup(t Task) bool {
+	switch v := t.(type) {
+	case *Retry:
+		return isTaskGroup(v.inner)
+	case *Serial, *Parallel:
+		return true
+	}
+	return false
+}
+
+func emitStepStart(ctx *ctxt.Context, t Task) {
+	if isTaskGroup(t) {
+		return
+	}
+	ctx.Emit(event.Event{Type: event.StepStart, Step: t.String()})
+}
+
+func emitStepFinish(ctx *ctxt.Context, t Task, err error) {
+	if isTaskGroup(t) {
+		return
+	}
+	ev := event.Event{Type: event.StepFinish, Step: t.String()}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	ctx.Emit(ev)
+}
@@ -23,12 +23,13 @@ import (
 
 // DMWorkerScript represent the data to generate TiDB config
 type DMWorkerScript struct {
-	Name      string
-	IP        string
-	Port      uint64
-	DeployDir string
-	LogDir    string
-	Endpoints []*DMMasterScript
+	Name       string
+	IP         string
+	Port       uint64
+	DeployDir  string
+	LogDir     string
+	TLSEnabled bool
+	Endpoints  []*DMMasterScript
 }
 
 // NewDMWorkerScript returns a DMWorkerScript with given arguments
@@ -48,6 +49,12 @@ func (c *DMWorkerScript) WithPort(port uint64) *DMWorkerScript {
 	return c
 }
 
+// WithTLS set TLSEnabled field of DMWorkerScript
+func (c *DMWorkerScript) WithTLS(enableTLS bool) *DMWorkerScript {
+	c.TLSEnabled = enableTLS
+	return c
+}
+
 // AppendEndpoints add new PDScript to Endpoints field
 func (c *DMWorkerScript) AppendEndpoints(ends ...*DMMasterScript) *DMWorkerScript {
 	c.Endpoints = append(c.Endpoints, ends...)
@@ -57,7 +57,7 @@ func GetClusterFile(topo []response.ClusterTopologyRespStruct) ClusterOperatorSt
 			cos.DmMasterAddrs = append(cos.DmMasterAddrs, fmt.Sprintf("%s:%v", cluster.MachineHost, cluster.ServicePort))
 			cos.DmMasterScripts = append(cos.DmMasterScripts, &script.DMMasterScript{
 				Name:      cluster.InstanceName,
-				Scheme:    "http",
+				Scheme:    cluster.Scheme(),
 				IP:        cluster.MachineHost,
 				Port:      cluster.ServicePort,
 				PeerPort:  cluster.PeerPort,
@@ -76,7 +76,7 @@ func GetClusterFile(topo []response.ClusterTopologyRespStruct) ClusterOperatorSt
 				DeployDir:   dmgrutil.AbsClusterDeployDir(cluster.DeployDir, cluster.InstanceName),
 				DataDir:     dmgrutil.AbsClusterDataDir(cluster.DeployDir, cluster.DataDir, cluster.InstanceName),
 				LogDir:      dmgrutil.AbsClusterLogDir(cluster.DeployDir, cluster.LogDir, cluster.InstanceName),
-				TLSEnabled:  false,
+				TLSEnabled:  cluster.IsTLSEnabled(),
 			})
 		case dmgrutil.ComponentPrometheus:
 			cos.PrometheusAddr = fmt.Sprintf("%s:%v", cluster.MachineHost, cluster.ServicePort)
@@ -105,7 +105,7 @@ func GenerateClusterFileWithStage(
 					AppendEndpoints(cos.DmMasterScripts...).
 					WithPort(t.ServicePort).
 					WithPeerPort(t.PeerPort).
-					WithScheme("http").
+					WithScheme(t.Scheme()).
 					ConfigToFile(
 						filepath.Join(
 							dmgrutil.AbsClusterUntarDir(t.ClusterPath, t.ClusterName),
@@ -125,7 +125,7 @@ func GenerateClusterFileWithStage(
 					WithPort(t.ServicePort).
 					AppendEndpoints(cos.DmMasterScripts...).
 					WithPeerPort(t.PeerPort).
-					WithScheme("http").
+					WithScheme(t.Scheme()).
 					ConfigToFile(
 						filepath.Join(
 							dmgrutil.AbsClusterUntarDir(t.ClusterPath, t.ClusterName),
@@ -152,7 +152,7 @@ func GenerateClusterFileWithStage(
 			if err := script.NewDMWorkerScript(t.InstanceName, t.MachineHost,
 				dmgrutil.AbsClusterDeployDir(t.DeployDir, t.InstanceName),
 				dmgrutil.AbsClusterLogDir(t.DeployDir, t.LogDir, t.InstanceName)).
-				WithPort(t.ServicePort).AppendEndpoints(cos.DmMasterScripts...).ConfigToFile(
+				WithPort(t.ServicePort).WithTLS(t.IsTLSEnabled()).AppendEndpoints(cos.DmMasterScripts...).ConfigToFile(
 				filepath.Join(
 					dmgrutil.AbsClusterUntarDir(t.ClusterPath, t.ClusterName),
 					t.ClusterVersion,
@@ -255,7 +255,7 @@ func GenerateClusterFileWithStage(
 				return err
 			}
 		case dmgrutil.ComponentPrometheus:
-			if err := config.NewPrometheusConfig(t.ClusterName, t.ClusterVersion, false).
+			if err := config.NewPrometheusConfig(t.ClusterName, t.ClusterVersion, t.IsTLSEnabled()).
 				AddAlertmanager(cos.AlertmanagerAddrs).
 				AddDMMaster(cos.DmMasterAddrs).
 				AddDMWorker(cos.DmWorkerAddrs).
@@ -305,7 +305,7 @@ func GenerateClusterFileWithStage(
 			if err := script.NewAlertManagerScript(t.MachineHost,
 				dmgrutil.AbsClusterDeployDir(t.DeployDir, t.InstanceName),
 				dmgrutil.AbsClusterDataDir(t.DeployDir, t.DataDir, t.InstanceName),
-				dmgrutil.AbsClusterLogDir(t.DeployDir, t.LogDir, t.InstanceName), false).
+				dmgrutil.AbsClusterLogDir(t.DeployDir, t.LogDir, t.InstanceName), t.IsTLSEnabled()).
 				AppendEndpoints(cos.AlertmanagerScripts).WithClusterPort(t.ClusterPort).WithWebPort(t.ServicePort).
 				ConfigToFile(
 					filepath.Join(
@@ -0,0 +1,187 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package dmgrutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// 集群 CA 以及 dmgr 客户端证书名
+	CertCAName     = "ca"
+	CertClientName = "client"
+
+	// 证书有效期
+	certValidity = 10 * 365 * 24 * time.Hour
+)
+
+// 证书文件 {cert_dir}/{name}.crt
+func CertFile(certDir, name string) string {
+	return filepath.Join(certDir, name+".crt")
+}
+
+// 证书私钥文件 {cert_dir}/{name}.key
+func CertKeyFile(certDir, name string) string {
+	return filepath.Join(certDir, name+".key")
+}
+
+// 生成集群 CA 以及 dmgr 客户端证书，已存在时保持不变（如扩容阶段复用集群 CA）
+func GenerateClusterCA(certDir, clusterName string) error {
+	if err := os.MkdirAll(certDir, 0750); err != nil {
+		return err
+	}
+
+	if exist, _ := PathExists(CertFile(certDir, CertCAName)); !exist {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		serial, err := certSerialNumber()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		tmpl := &x509.Certificate{
+			SerialNumber:          serial,
+			Subject:               pkix.Name{CommonName: fmt.Sprintf("%s-ca", clusterName)},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(certValidity),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			return fmt.Errorf("create cluster [%s] ca failed: %v", clusterName, err)
+		}
+		if err := writeCertAndKey(certDir, CertCAName, der, key); err != nil {
+			return err
+		}
+	}
+
+	if exist, _ := PathExists(CertFile(certDir, CertClientName)); !exist {
+		return GenerateCert(certDir, CertClientName, "dmgr", nil)
+	}
+	return nil
+}
+
+// 生成集群 CA 签发的证书，用于组件服务端以及组件间、dmgr 访问组件的客户端认证
+// hosts 为证书 SAN，默认包含 localhost、127.0.0.1，已存在同名证书时覆盖
+func GenerateCert(certDir, name, commonName string, hosts []string) error {
+	caCert, caKey, err := loadCA(certDir)
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := certSerialNumber()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return fmt.Errorf("create cert [%s] failed: %v", name, err)
+	}
+	return writeCertAndKey(certDir, name, der, key)
+}
+
+// 加载 dmgr 访问集群组件的客户端 TLS 配置
+func LoadClientTLSConfig(certDir string) (*tls.Config, error) {
+	caPEM, err := os.ReadFile(CertFile(certDir, CertCAName))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("parse ca file [%s] failed", CertFile(certDir, CertCAName))
+	}
+	cert, err := tls.LoadX509KeyPair(CertFile(certDir, CertClientName), CertKeyFile(certDir, CertClientName))
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+func loadCA(certDir string) (*x509.Certificate, crypto.Signer, error) {
+	pair, err := tls.LoadX509KeyPair(CertFile(certDir, CertCAName), CertKeyFile(certDir, CertCAName))
+	if err != nil {
+		return nil, nil, fmt.Errorf("load ca from [%s] failed: %v", certDir, err)
+	}
+	caCert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	caKey, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("ca key [%s] isn't a signer", CertKeyFile(certDir, CertCAName))
+	}
+	return caCert, caKey, nil
+}
+
+func certSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// 先写入私钥再写入证书，证书文件存在即表示生成完成，私钥仅属主可读
+func writeCertAndKey(certDir, name string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(CertKeyFile(certDir, name), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(CertFile(certDir, name), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
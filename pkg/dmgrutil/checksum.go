@@ -0,0 +1,109 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package dmgrutil
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SHA256Sum 计算文件 SHA-256
+func SHA256Sum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// GenerateChecksumFile 计算离线镜像包解压目录下所有文件的 SHA-256 并写入校验文件
+// 校验文件格式与 sha256sum 输出一致，文件路径为相对解压目录的路径
+func GenerateChecksumFile(dir string) error {
+	var lines []string
+	if err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || p == filepath.Join(dir, ChecksumFile) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		sum, err := SHA256Sum(p)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s", sum, filepath.ToSlash(rel)))
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, ChecksumFile), []byte(strings.Join(lines, "\n")+"\n"), 0640)
+}
+
+// PackageChecksum 查找文件所在离线镜像包解压目录的校验文件，返回解压时记录的文件 SHA-256
+// 未找到校验文件或文件未记录时返回空
+func PackageChecksum(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		sumFile := filepath.Join(dir, ChecksumFile)
+		if IsExist(sumFile) {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return "", err
+			}
+			return lookupChecksum(sumFile, filepath.ToSlash(rel))
+		}
+		if dir == filepath.Dir(dir) {
+			return "", nil
+		}
+	}
+}
+
+func lookupChecksum(sumFile, name string) (string, error) {
+	f, err := os.Open(sumFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "  ", 2)
+		if len(fields) == 2 && fields[1] == name {
+			return fields[0], nil
+		}
+	}
+	return "", scanner.Err()
+}
@@ -0,0 +1,95 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package dmgrutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackageChecksum(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "bin", "dm-master"), "master")
+	writeFile(t, filepath.Join(dir, "conf", "dm master.toml"), "name = 'x'")
+	if err := GenerateChecksumFile(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, ChecksumFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), ChecksumFile) {
+		t.Fatal("checksum file records itself")
+	}
+
+	// 从文件所在目录逐级向上查找校验文件，文件名包含空格
+	for _, rel := range []string{"bin/dm-master", "conf/dm master.toml"} {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		want, err := SHA256Sum(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := PackageChecksum(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("checksum of %s = %q, want %q", rel, got, want)
+		}
+	}
+
+	// 解压后新增的文件未记录
+	writeFile(t, filepath.Join(dir, "patch", "dm-worker"), "worker")
+	if got, err := PackageChecksum(filepath.Join(dir, "patch", "dm-worker")); err != nil || got != "" {
+		t.Fatalf("checksum of unrecorded file = %q, %v, want empty", got, err)
+	}
+}
+
+func TestPackageChecksumWithoutChecksumFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bin", "dm-master")
+	writeFile(t, path, "master")
+
+	got, err := PackageChecksum(path)
+	if err != nil || got != "" {
+		t.Fatalf("checksum without checksum file = %q, %v, want empty", got, err)
+	}
+}
+
+func TestLookupChecksum(t *testing.T) {
+	sumFile := filepath.Join(t.TempDir(), ChecksumFile)
+	writeFile(t, sumFile, "aaa  bin/dm-master\nbbb  bin/dm-master.bak\nmalformed line\n")
+
+	if got, err := lookupChecksum(sumFile, "bin/dm-master"); err != nil || got != "aaa" {
+		t.Fatalf("lookup = %q, %v, want aaa", got, err)
+	}
+	if got, err := lookupChecksum(sumFile, "bin/dm"); err != nil || got != "" {
+		t.Fatalf("lookup prefix = %q, %v, want empty", got, err)
+	}
+}
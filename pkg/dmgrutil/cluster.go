@@ -54,6 +54,12 @@ func AbsClusterDeployDir(deployDir, instanceName string) string {
 	return filepath.Join(deployDir, instanceName)
 }
 
+// 集群组件主机暂存目录，同一主机多个实例共用的组件文件只上传一次
+// {deploy_dir}/.stage/{cluster_version}，deploy_dir 为主机第一个实例的部署目录，暂存文件复制至其他实例时不要求位于同一文件系统
+func AbsClusterStageDir(deployDir, clusterVersion string) string {
+	return filepath.Join(deployDir, DirStage, clusterVersion)
+}
+
 // 集群部署 Bin 目录
 func AbsClusterBinDir(deployDir, instanceName string) string {
 	return filepath.Join(deployDir, instanceName, DirBin)
@@ -114,6 +120,17 @@ func AbsClusterSSHDir(clusterPath, clusterName string) string {
 	return filepath.Join(clusterPath, DirCluster, clusterName, DirSSH)
 }
 
+// 集群 TLS 证书存放目录，存放 CA、实例证书以及 dmgr 客户端证书
+// {cluster_path}/cluster/{cluster_name}/tls
+func AbsClusterCertDir(clusterPath, clusterName string) string {
+	return filepath.Join(clusterPath, DirCluster, clusterName, DirTLS)
+}
+
+// 集群部署 TLS 证书目录
+func AbsClusterTLSDir(deployDir, instanceName string) string {
+	return filepath.Join(deployDir, instanceName, DirTLS)
+}
+
 // 集群压缩包文件位置
 func AbsUntarConfDir(clusterPath, clusterName, clusterVersion, fileName string) string {
 	return filepath.Join(clusterPath, DirCluster, clusterName, clusterVersion, fileName)
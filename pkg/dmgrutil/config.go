@@ -27,6 +27,7 @@ type Config struct {
 	DbConfig         DbConfig         `toml:"db" json:"db"`
 	LogConfig        LogConfig        `toml:"log" json:"log"`
 	MiddlewareConfig MiddlewareConfig `toml:"middleware"`
+	OperationConfig  OperationConfig  `toml:"operation" json:"operation"`
 }
 
 type DbConfig struct {
@@ -53,6 +54,15 @@ type MiddlewareConfig struct {
 	JwtMaxRefresh  int    `toml:"jwt-max-refresh" json:"jwt-max-refresh"`
 }
 
+type OperationConfig struct {
+	WorkerThreads   int `toml:"worker-threads" json:"worker-threads"`
+	QueueSize       int `toml:"queue-size" json:"queue-size"`
+	Timeout         int `toml:"timeout" json:"timeout"`
+	TaskConcurrency int `toml:"task-concurrency" json:"task-concurrency"`
+	HostConcurrency int `toml:"host-concurrency" json:"host-concurrency"`
+	TransferLimit   int `toml:"transfer-limit" json:"transfer-limit"`
+}
+
 // 配置文件读取
 func ReadConfigFile(file string) (*Config, error) {
 	cfg := &Config{}
@@ -44,8 +44,14 @@ const (
 	DirPatch = "patch"
 	// 缓存目录
 	DirCache = "cache"
+	// 组件主机暂存目录
+	DirStage = ".stage"
+	// 离线镜像包解压目录 SHA-256 校验文件
+	ChecksumFile = "sha256sum.txt"
 	// SSH 存放目录
 	DirSSH = "ssh"
+	// TLS 证书存放目录
+	DirTLS = "tls"
 	// grafana dashboard 目录
 	DirGrafanaDashboard = "provisioning/dashboards"
 	// grafana datasource 目录
@@ -85,6 +91,13 @@ const (
 	ClusterUpStatus      = "Up"
 	ClusterOfflineStatus = "Offline"
 
+	// 实例实时状态
+	InstanceUpStatus        = "Up"
+	InstanceLeaderStatus    = "Up|L"
+	InstanceDownStatus      = "Down"
+	InstanceUnhealthyStatus = "Unhealthy"
+	InstanceUnknownStatus   = "Unknown"
+
 	// HOME SSH
 	HomeSshDir = "~/.ssh"
 
@@ -96,6 +109,7 @@ const (
 	FileTypeScript    = "script"
 	FileTypeSystemd   = "systemd"
 	FileTypeRule      = "rule"
+	FileTypeTLS       = "tls"
 
 	// 用于指定组件 reload 滚更
 	ReloadAlertmanagerFile = "alertmanager.yml"
@@ -107,6 +121,32 @@ const (
 	ReloadComponent  = "Reload"  // 存在配置变更（可能打过补丁）
 	PatchedComponent = "Patched" //存在补丁状态（可能配置变更过）
 
+	// 集群操作类型
+	OperationDeploy   = "deploy"
+	OperationStart    = "start"
+	OperationStop     = "stop"
+	OperationRestart  = "restart"
+	OperationScaleOut = "scale-out"
+	OperationScaleIn  = "scale-in"
+	OperationReload   = "reload"
+	OperationUpgrade  = "upgrade"
+	OperationPatch    = "patch"
+	OperationDestroy  = "destroy"
+
+	// 同步运行的任务变更类型，用于集群锁
+	OperationTaskSourceDelete = "task-source-delete"
+	OperationTaskSourceUpdate = "task-source-update"
+	OperationTaskTargetDelete = "task-target-delete"
+	OperationTaskTargetUpdate = "task-target-update"
+	OperationTaskCreate       = "task-create"
+
+	// 集群操作状态
+	OperationQueuedStatus    = "queued"
+	OperationRunningStatus   = "running"
+	OperationSucceededStatus = "succeeded"
+	OperationFailedStatus    = "failed"
+	OperationCanceledStatus  = "canceled"
+
 	// 任务 source name 分隔符
 	TaskSourceDelimiter = ";"
 )
@@ -16,6 +16,7 @@ limitations under the License.
 package dmgrutil
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -37,6 +38,12 @@ var (
 // Retry retries the func until it returns no error or reaches attempts limit or
 // timed out, either one is earlier
 func Retry(doFunc func() error, opts ...RetryOption) error {
+	return RetryWithContext(context.Background(), doFunc, opts...)
+}
+
+// RetryWithContext is same as Retry, but stops retrying once the context is
+// canceled or its deadline exceeded
+func RetryWithContext(ctx context.Context, doFunc func() error, opts ...RetryOption) error {
 	var cfg RetryOption
 	if len(opts) > 0 {
 		cfg = opts[0]
@@ -73,8 +80,9 @@ func Retry(doFunc func() error, opts ...RetryOption) error {
 		select {
 		case <-timeoutChan:
 			return fmt.Errorf("operation timed out after %s", cfg.Timeout)
-		default:
-			time.Sleep(cfg.Delay)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(cfg.Delay):
 		}
 	}
 
@@ -35,6 +35,33 @@ type MachineReqStruct struct {
 	SshUser     string `json:"ssh_user" form:"ssh_user" binding:"required"`
 	SshPassword string `json:"ssh_password" form:"ssh_password" binding:"required"`
 	SshPort     uint64 `json:"ssh_port" form:"ssh_port" binding:"required"`
+
+	// SSH 用户 sudo 密码，可选，SSH 用户非免密 sudo 时需要
+	SudoPassword string `json:"sudo_password" form:"sudo_password"`
+
+	// SSH 跳板机，可选
+	ProxyHost     string `json:"proxy_host" form:"proxy_host"`
+	ProxyPort     uint64 `json:"proxy_port" form:"proxy_port"`
+	ProxyUser     string `json:"proxy_user" form:"proxy_user" binding:"required_with=ProxyHost"`
+	ProxyPassword string `json:"proxy_password" form:"proxy_password"`
+	ProxyKeyFile  string `json:"proxy_key_file" form:"proxy_key_file"`
+}
+
+// 机器主机信息刷新请求
+type MachineFactsRefreshReqStruct struct {
+	SshHost string `json:"ssh_host" form:"ssh_host" binding:"required"`
+	SshPort uint64 `json:"ssh_port" form:"ssh_port" binding:"required"`
+}
+
+// 机器主机信息查询请求，SshHost 为空查询所有机器
+type MachineFactsReqStruct struct {
+	SshHost string `json:"ssh_host" form:"ssh_host"`
+}
+
+// 重新信任主机公钥请求，主机重装后使用
+type HostKeyTrustReqStruct struct {
+	SshHost string `json:"ssh_host" form:"ssh_host" binding:"required"`
+	SshPort uint64 `json:"ssh_port" form:"ssh_port" binding:"required"`
 }
 
 // 离线镜像包新增请求
@@ -49,6 +76,13 @@ type PackageReqStruct struct {
 type ClusterDeployReqStruct struct {
 	ClusterMetaReqStruct
 	ClusterTopology []TopologyReqStruct `json:"cluster_topology" form:"cluster_topology" binding:"required"`
+	DryRun          bool                `json:"dry_run" form:"dry_run"` // 只返回运行计划，不实际运行
+}
+
+// 集群部署或扩容前环境检查请求
+type ClusterCheckReqStruct struct {
+	ClusterTopology []TopologyReqStruct `json:"cluster_topology" form:"cluster_topology" binding:"required"`
+	Apply           bool                `json:"apply" form:"apply"` // 自动修复可修复的检查项
 }
 
 // 集群元数据请求
@@ -60,6 +94,7 @@ type ClusterMetaReqStruct struct {
 	AdminUser      string `json:"admin_user" form:"admin_user" binding:"required" db:"admin_user"`
 	AdminPassword  string `json:"admin_password" form:"admin_password" binding:"required" db:"admin_password"`
 	SkipCreateUser string `json:"skip_create_user" form:"skip_create_user" binding:"validIsSkip" db:"skip_create_user"`
+	TLSEnabled     string `json:"tls_enabled" form:"tls_enabled" binding:"omitempty,validIsSkip" db:"tls_enabled"` // 集群组件间是否开启 TLS，默认 false
 }
 
 type TopologyReqStruct struct {
@@ -80,11 +115,17 @@ type ClusterStatusReqStruct struct {
 	ClusterStatus string `json:"cluster_status" form:"cluster_status"`
 }
 
+// 集群实例实时状态请求
+type ClusterDisplayReqStruct struct {
+	ClusterName string `json:"cluster_name" form:"cluster_name" binding:"required"`
+}
+
 // 集群启动、停止或销毁请求
 type ClusterOperatorReqStruct struct {
 	ClusterName   string   `json:"cluster_name" form:"cluster_name" binding:"required"`
 	ComponentName []string `json:"component_name" form:"component_name;default=[]"`
 	InstanceName  []string `json:"instance_name" form:"instance_name;default=[]"`
+	DryRun        bool     `json:"dry_run" form:"dry_run"` // 只返回运行计划，不实际运行
 }
 
 // 集群扩容请求
@@ -93,12 +134,14 @@ type CLusterScaleOutReqStruct struct {
 	SkipCreateUser string `json:"skip_create_user" form:"skip_create_user" binding:"validIsSkip"`
 	AdminUser      string `json:"admin_user" form:"admin_user" `        // 扩容 grafana 才需使用
 	AdminPassword  string `json:"admin_password" form:"admin_password"` // 扩容 grafana 才需使用
+	DryRun         bool   `json:"dry_run" form:"dry_run"`               // 只返回运行计划，不实际运行
 }
 
 // 集群升级请求
 type ClusterUpgradeReqStruct struct {
 	ClusterName    string `json:"cluster_name" form:"cluster_name" binding:"required"`
 	ClusterVersion string `json:"cluster_version" form:"cluster_version" binding:"required"`
+	DryRun         bool   `json:"dry_run" form:"dry_run"` // 只返回运行计划，不实际运行
 }
 
 // 集群滚更、补丁请求
@@ -108,4 +151,27 @@ type ClusterPatchReqStruct struct {
 	InstanceName  []string              `json:"instance_name" form:"instance_name;default=[]"`
 	Overwrite     string                `json:"overwrite" form:"overwrite" binding:"validIsSkip"`
 	File          *multipart.FileHeader `json:"file" form:"file" binding:"required"`
+	DryRun        bool                  `json:"dry_run" form:"dry_run"` // 只返回运行计划，不实际运行
+}
+
+// 集群操作状态请求
+type OperationReqStruct struct {
+	OperationID uint64 `json:"operation_id" form:"operation_id" binding:"required"`
+}
+
+// 集群操作列表请求
+type OperationListReqStruct struct {
+	ClusterName     string `json:"cluster_name" form:"cluster_name"`
+	OperationStatus string `json:"operation_status" form:"operation_status"`
+}
+
+// 集群操作命令执行记录请求，可按主机过滤
+type OperationCommandReqStruct struct {
+	OperationID uint64 `json:"operation_id" form:"operation_id" binding:"required"`
+	Host        string `json:"host" form:"host"`
+}
+
+// 集群锁强制释放请求
+type ClusterLockReqStruct struct {
+	ClusterName string `json:"cluster_name" form:"cluster_name" binding:"required"`
 }
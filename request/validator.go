@@ -78,6 +78,9 @@ func ValidDeployReqStructField(clusterTopo ClusterDeployReqStruct) (ClusterDeplo
 	if clusterTopo.AdminPassword == "" {
 		clusterTopo.AdminPassword = dmgrutil.DefaultGrafanaPassword
 	}
+	if clusterTopo.TLSEnabled == "" {
+		clusterTopo.TLSEnabled = dmgrutil.BoolFalse
+	}
 
 	clusterTopo.ClusterTopology = clusterTopos
 	uniqueHosts := dmgrutil.NewStringSet(machineHosts...)
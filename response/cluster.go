@@ -17,6 +17,9 @@ package response
 
 import (
 	"time"
+
+	"github.com/wentaojin/dmgr/pkg/cluster/module"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
 )
 
 // 用户登陆响应
@@ -38,6 +41,47 @@ type MachineRespStruct struct {
 	SshPort     uint64 `json:"ssh_port" db:"ssh_port"`
 	SshUser     string `json:"ssh_user" db:"ssh_user"`
 	SshPassword string `json:"ssh_password" db:"ssh_password"`
+
+	// SSH 用户 sudo 密码，查询时解密，不对外返回
+	SudoPassword string `json:"-" db:"sudo_password"`
+
+	// SSH 跳板机，ProxyHost 为空表示直连
+	ProxyHost     string `json:"proxy_host" db:"proxy_host"`
+	ProxyPort     uint64 `json:"proxy_port" db:"proxy_port"`
+	ProxyUser     string `json:"proxy_user" db:"proxy_user"`
+	ProxyPassword string `json:"-" db:"proxy_password"` // 查询时解密，不对外返回
+	ProxyKeyFile  string `json:"proxy_key_file" db:"proxy_key_file"`
+
+	// 已信任的主机公钥，未信任为空
+	Fingerprint      string `json:"fingerprint" db:"fingerprint"`
+	HostKey          string `json:"host_key" db:"host_key"`
+	ProxyFingerprint string `json:"proxy_fingerprint" db:"proxy_fingerprint"`
+	ProxyHostKey     string `json:"proxy_host_key" db:"proxy_host_key"`
+}
+
+// 已信任的 SSH 主机公钥响应
+type HostKeyRespStruct struct {
+	SshHost     string    `json:"ssh_host" db:"ssh_host"`
+	SshPort     uint64    `json:"ssh_port" db:"ssh_port"`
+	KeyType     string    `json:"key_type" db:"key_type"`
+	Fingerprint string    `json:"fingerprint" db:"fingerprint"`
+	PublicKey   string    `json:"public_key" db:"public_key"`
+	UpdateTime  time.Time `json:"update_time" db:"update_time"`
+}
+
+// 机器主机信息响应
+type MachineFactsRespStruct struct {
+	SshHost string `json:"ssh_host"`
+	SshPort uint64 `json:"ssh_port"`
+	module.HostFacts
+	UpdateTime time.Time `json:"update_time"`
+}
+
+// 集群环境检查响应，Status 为主机所有检查项中最严重的结果
+type ClusterCheckRespStruct struct {
+	MachineHost string               `json:"machine_host"`
+	Status      string               `json:"status"`
+	Results     []module.CheckResult `json:"results"`
 }
 
 // 集群离线包响应
@@ -67,6 +111,47 @@ type ClusterTopologyRespStruct struct {
 	DeployDir      string `json:"deploy_dir" db:"deploy_dir"`
 	DataDir        string `json:"data_dir" db:"data_dir"`
 	LogDir         string `json:"log_dir" db:"log_dir"`
+	Hotfix         string `json:"hotfix" db:"hotfix"`
+	TLSEnabled     string `json:"tls_enabled" db:"tls_enabled"`
+}
+
+// 集群是否开启组件间 TLS
+func (t ClusterTopologyRespStruct) IsTLSEnabled() bool {
+	return dmgrutil.StringEqualFold(t.TLSEnabled, dmgrutil.BoolTrue)
+}
+
+// 集群组件访问协议，开启 TLS 时为 https
+func (t ClusterTopologyRespStruct) Scheme() string {
+	if t.IsTLSEnabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// 集群实例实时状态响应
+type ClusterDisplayRespStruct struct {
+	ClusterName    string                      `json:"cluster_name"`
+	ClusterVersion string                      `json:"cluster_version"`
+	ClusterStatus  string                      `json:"cluster_status"`
+	Instances      []InstanceDisplayRespStruct `json:"instances"`
+}
+
+// 实例实时状态
+type InstanceDisplayRespStruct struct {
+	InstanceName  string `json:"instance_name"`
+	ComponentName string `json:"component_name"`
+	MachineHost   string `json:"machine_host"`
+	ServicePort   uint64 `json:"service_port"`
+	Status        string `json:"status"`        // 实例状态 Up、Up|L、Down、Unhealthy、Unknown 或 dm-worker 阶段 Bound、Free、Offline
+	SystemdState  string `json:"systemd_state"` // systemd 服务状态
+	PortAlive     bool   `json:"port_alive"`    // 服务端口是否已监听
+	Leader        bool   `json:"leader"`        // dm-master 是否为 leader
+	Alive         bool   `json:"alive"`         // dm-master 是否存活
+	WorkerStage   string `json:"worker_stage"`  // dm-worker 阶段
+	Uptime        string `json:"uptime"`        // 服务运行时长
+	Version       string `json:"version"`
+	Hotfix        string `json:"hotfix"`  // hotfix 状态 Normal、Reload、Patched
+	Message       string `json:"message"` // 状态查询失败原因
 }
 
 // 集群状态响应
@@ -78,4 +163,61 @@ type ClusterMetaRespStruct struct {
 	ClusterStatus  string `json:"cluster_status" db:"cluster_status"`
 	AdminUser      string `json:"admin_user" db:"admin_user"`
 	AdminPassword  string `json:"admin_password" db:"admin_password"`
+	TLSEnabled     string `json:"tls_enabled" db:"tls_enabled"`
+}
+
+// 集群是否开启组件间 TLS
+func (m ClusterMetaRespStruct) IsTLSEnabled() bool {
+	return dmgrutil.StringEqualFold(m.TLSEnabled, dmgrutil.BoolTrue)
+}
+
+// 集群操作提交响应
+type OperationIDRespStruct struct {
+	OperationID uint64 `json:"operation_id"`
+}
+
+// 集群操作 dry run 运行计划响应
+type OperationPlanRespStruct struct {
+	ClusterName   string      `json:"cluster_name"`
+	OperationType string      `json:"operation_type"`
+	Plan          interface{} `json:"plan"`
+}
+
+// 集群操作状态响应
+type OperationRespStruct struct {
+	OperationID     uint64     `json:"operation_id" db:"id"`
+	ClusterName     string     `json:"cluster_name" db:"cluster_name"`
+	OperationType   string     `json:"operation_type" db:"operation_type"`
+	OperationStatus string     `json:"operation_status" db:"operation_status"`
+	ErrorMsg        string     `json:"error_msg" db:"error_msg"`
+	RetryMsg        string     `json:"retry_msg" db:"retry_msg"`
+	StartTime       *time.Time `json:"start_time" db:"start_time"`
+	EndTime         *time.Time `json:"end_time" db:"end_time"`
+	CreateTime      time.Time  `json:"create_time" db:"create_time"`
+}
+
+// 集群操作命令执行记录响应
+type OperationCommandRespStruct struct {
+	ID          uint64    `json:"id" db:"id"`
+	OperationID uint64    `json:"operation_id" db:"operation_id"`
+	Host        string    `json:"host" db:"host"`
+	Command     string    `json:"command" db:"command"`
+	Sudo        bool      `json:"sudo" db:"sudo"`
+	ExitCode    int       `json:"exit_code" db:"exit_code"`
+	DurationMs  int64     `json:"duration_ms" db:"duration_ms"`
+	Stdout      string    `json:"stdout" db:"stdout"`
+	Stderr      string    `json:"stderr" db:"stderr"`
+	ErrorMsg    string    `json:"error_msg" db:"error_msg"`
+	CreateTime  time.Time `json:"create_time" db:"create_time"`
+}
+
+// 集群锁响应
+type ClusterLockRespStruct struct {
+	ClusterName   string    `json:"cluster_name" db:"cluster_name"`
+	Owner         string    `json:"owner" db:"owner"`
+	OperationType string    `json:"operation_type" db:"operation_type"`
+	OperationID   uint64    `json:"operation_id" db:"operation_id"`
+	ExpireTime    time.Time `json:"expire_time" db:"expire_time"`
+	Expired       bool      `json:"expired" db:"expired"`
+	CreateTime    time.Time `json:"create_time" db:"create_time"`
 }
@@ -22,18 +22,20 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"regexp"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"time"
 
 	"google.golang.org/grpc/codes"
 
 	expect "github.com/google/goexpect"
+	"github.com/joomcode/errorx"
 
 	"golang.org/x/crypto/ssh"
 
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
 	"github.com/wentaojin/dmgr/pkg/dmgrutil"
 	"go.uber.org/zap"
 	kh "golang.org/x/crypto/ssh/knownhosts"
@@ -130,67 +132,75 @@ func GinRecovery(logger *zap.Logger, stack bool) gin.HandlerFunc {
 	}
 }
 
-// 测试 SSH 认证连通性
-func (m *MachineRespStruct) SshAuthTest(edPrivatePath string) (bool, error) {
-	key, err := ioutil.ReadFile(edPrivatePath)
-	if err != nil {
-		return false, fmt.Errorf("unable to read private key: %v", err)
+// SSH 跳板机，未配置返回 nil
+func (m *MachineRespStruct) SSHProxy() *executor.SSHProxyConfig {
+	if m.ProxyHost == "" {
+		return nil
 	}
-
-	// Create the Signer for this private key.
-	signer, err := ssh.ParsePrivateKey(key)
-	if err != nil {
-		return false, fmt.Errorf("unable to parse private key: %v", err)
+	port := int(m.ProxyPort)
+	if port <= 0 {
+		port = 22
 	}
-
-	knowHostsPath := filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
-	if !dmgrutil.IsExist(knowHostsPath) {
-		knowHostsFile, err := os.Create(knowHostsPath)
-		if err != nil {
-			return false, err
-		}
-		defer knowHostsFile.Close()
+	return &executor.SSHProxyConfig{
+		Host:        m.ProxyHost,
+		Port:        port,
+		User:        m.ProxyUser,
+		Password:    m.ProxyPassword,
+		KeyFile:     m.ProxyKeyFile,
+		Fingerprint: m.ProxyFingerprint,
 	}
+}
 
-	hostKeyCallback, err := kh.New(knowHostsPath)
+// 测试 SSH 认证连通性，配置跳板机时通过跳板机连接
+// 主机公钥按已信任的主机公钥校验，未信任或不一致时返回错误，不再分发 SSH 公钥
+func (m *MachineRespStruct) SshAuthTest(edPrivatePath string) (bool, error) {
+	config, err := executor.NewSSHClientConfig(m.SshUser, edPrivatePath, "", "", m.Fingerprint, time.Duration(executor.DefaultConnectTimeout)*time.Second)
 	if err != nil {
-		return false, fmt.Errorf("could not create hostkeycallback function: %v", err)
+		return false, err
 	}
 
-	config := &ssh.ClientConfig{
-		User: m.SshUser,
-		Auth: []ssh.AuthMethod{
-			// Add in password check here for moar security.
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: hostKeyCallback,
-	}
 	// Connect to the remote server and perform the SSH handshake.
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", m.SshHost, m.SshPort), config)
+	client, err := executor.DialSSH(fmt.Sprintf("%s:%d", m.SshHost, m.SshPort), config, m.SSHProxy())
 	if err != nil {
-		// 当 know_hosts 文件为空时，忽略错误
-		// ssh: handshake failed: knownhosts: key is unknown
+		if errorx.IsOfType(err, executor.ErrSSHHostKeyUntrusted) || errorx.IsOfType(err, executor.ErrSSHHostKeyMismatch) {
+			return false, err
+		}
+		// 私钥认证失败，需分发 SSH 公钥
 		return false, nil
-	} else {
-		client.Close()
 	}
+	client.Close()
 	return true, nil
 }
 
+// 分发 SSH 公钥，配置跳板机时通过跳板机分发
+// ssh-copy-id 只信任 dmgr 已记录的主机公钥，主机公钥不一致时分发失败
 func (m *MachineRespStruct) SshCopyID(executeTimeout uint64) error {
-	e, _, err := expect.Spawn(fmt.Sprintf("ssh-copy-id %s@%s -p %d", m.SshUser, m.SshHost, m.SshPort), time.Second*time.Duration(executeTimeout))
+	knownHostsPath, err := m.knownHostsFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(knownHostsPath)
+
+	e, _, err := expect.SpawnWithArgs(m.sshCopyIDArgs(knownHostsPath), time.Second*time.Duration(executeTimeout))
 	if err != nil {
 		return err
 	}
 	defer e.Close()
 
-	caser := []expect.Caser{
+	var caser []expect.Caser
+	// 跳板机密码提示需先于目标主机密码提示匹配
+	if m.ProxyHost != "" && m.ProxyKeyFile == "" {
+		caser = append(caser, &expect.BCase{R: regexp.QuoteMeta(fmt.Sprintf("%s@%s's password", m.ProxyUser, m.ProxyHost)), T: func() (tag expect.Tag, status *expect.Status) {
+			_ = e.Send(m.ProxyPassword + "\n")
+			return expect.OKTag, expect.NewStatus(codes.OK, "")
+		}})
+	}
+	caser = append(caser,
 		&expect.BCase{R: "password", T: func() (tag expect.Tag, status *expect.Status) {
 			_ = e.Send(m.SshPassword + "\n")
 			return expect.OKTag, expect.NewStatus(codes.OK, "")
 		}},
-		&expect.BCase{R: "yes/no", S: "yes\n"},
-	}
+	)
 
 	for {
 		output, _, _, err := e.ExpectSwitchCase(caser, time.Second*time.Duration(executeTimeout))
@@ -199,15 +209,70 @@ func (m *MachineRespStruct) SshCopyID(executeTimeout uint64) error {
 			break
 		}
 		if err != nil {
-			if strings.Contains(output, "known_hosts") {
-				cmd := fmt.Sprintf("sed -i '/%s/d' %s", m.SshHost, filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts"))
-				if _, execError := exec.Command("bash", "-c", cmd).Output(); execError != nil {
-					return fmt.Errorf("sed file [%v] failed: %v", filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts"), err)
-				}
-				e, _, _ = expect.Spawn(fmt.Sprintf("ssh-copy-id %s@%s -p %d", m.SshUser, m.SshHost, m.SshPort), time.Second*time.Duration(executeTimeout))
-				continue
+			if strings.Contains(output, "Host key verification failed") || strings.Contains(output, "IDENTIFICATION HAS CHANGED") {
+				return fmt.Errorf("ssh-copy-id %s@%s failed: host key verification failed, re-trust the host if it was reinstalled", m.SshUser, m.SshHost)
 			}
+			return fmt.Errorf("ssh-copy-id %s@%s failed: %v, output: %s", m.SshUser, m.SshHost, err, output)
 		}
 	}
 	return nil
 }
+
+// 生成临时 known_hosts 文件，只包含 dmgr 已信任的机器以及跳板机主机公钥
+func (m *MachineRespStruct) knownHostsFile() (string, error) {
+	if m.HostKey == "" {
+		return "", fmt.Errorf("host key of %s:%d is not trusted", m.SshHost, m.SshPort)
+	}
+	var lines []string
+	line, err := knownHostsLine(m.SshHost, m.SshPort, m.HostKey)
+	if err != nil {
+		return "", err
+	}
+	lines = append(lines, line)
+
+	if proxy := m.SSHProxy(); proxy != nil {
+		if m.ProxyHostKey == "" {
+			return "", fmt.Errorf("host key of proxy %s is not trusted", proxy.Addr())
+		}
+		line, err := knownHostsLine(proxy.Host, uint64(proxy.Port), m.ProxyHostKey)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+
+	f, err := ioutil.TempFile("", "dmgr_known_hosts")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func knownHostsLine(host string, port uint64, hostKey string) (string, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return "", fmt.Errorf("parse host key of %s:%d failed: %v", host, port, err)
+	}
+	return kh.Line([]string{kh.Normalize(net.JoinHostPort(host, strconv.FormatUint(port, 10)))}, key), nil
+}
+
+// ssh-copy-id 命令参数
+// 1、只使用临时 known_hosts 文件校验主机公钥
+// 2、配置跳板机时通过 ProxyCommand 经跳板机连接
+func (m *MachineRespStruct) sshCopyIDArgs(knownHostsPath string) []string {
+	hostKeyOpts := fmt.Sprintf("-o StrictHostKeyChecking=yes -o UserKnownHostsFile=%s", knownHostsPath)
+	args := append([]string{"ssh-copy-id"}, strings.Fields(hostKeyOpts)...)
+	if proxy := m.SSHProxy(); proxy != nil {
+		proxyCmd := fmt.Sprintf("ssh %s -W %%h:%%p -p %d", hostKeyOpts, proxy.Port)
+		if proxy.KeyFile != "" {
+			proxyCmd = fmt.Sprintf("%s -i %s", proxyCmd, proxy.KeyFile)
+		}
+		args = append(args, "-o", fmt.Sprintf("ProxyCommand=%s %s@%s", proxyCmd, proxy.User, proxy.Host))
+	}
+	return append(args, fmt.Sprintf("%s@%s", m.SshUser, m.SshHost), "-p", strconv.FormatUint(m.SshPort, 10))
+}
@@ -44,6 +44,10 @@ func InitMachineRouter(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware)
 	router := r.Group("/machine").Use(authMiddleware.MiddlewareFunc())
 	{
 		router.POST("/add", v1.AddMachine)
+		router.POST("/hostkey/trust", v1.TrustMachineHostKey)
+		router.POST("/hostkey/backfill", v1.BackfillMachineHostKey)
+		router.POST("/facts/refresh", v1.RefreshMachineFacts)
+		router.POST("/facts/list", v1.MachineFactsList)
 	}
 	return router
 }
@@ -61,9 +65,11 @@ func InitWarehouseRouter(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddlewar
 func InitClusterRouter(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) (R gin.IRoutes) {
 	router := r.Group("/cluster").Use(authMiddleware.MiddlewareFunc())
 	{
+		router.POST("/check", v1.ClusterCheck)
 		router.POST("/deploy", v1.ClusterDeploy)
 		router.POST("/start", v1.ClusterStart)
 		router.POST("/stop", v1.ClusterStop)
+		router.POST("/restart", v1.ClusterRestart)
 		router.POST("/scale-out", v1.ClusterScaleOut)
 		router.POST("/scale-in", v1.ClusterScaleIn)
 		router.POST("/reload", v1.CLusterReload)
@@ -71,6 +77,23 @@ func InitClusterRouter(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware)
 		router.POST("/destroy", v1.ClusterDestroy)
 		router.POST("/patch", v1.ClusterPatch)
 		router.POST("/status", v1.ClusterStatus)
+		router.POST("/display", v1.ClusterDisplay)
+		router.POST("/lock/list", v1.ClusterLockList)
+		router.POST("/lock/release", v1.ClusterLockRelease)
+	}
+	return router
+}
+
+// 集群操作路由
+func InitOperationRouter(r *gin.RouterGroup, authMiddleware *jwt.GinJWTMiddleware) (R gin.IRoutes) {
+	router := r.Group("/operation").Use(authMiddleware.MiddlewareFunc())
+	{
+		router.POST("/status", v1.OperationStatus)
+		router.POST("/list", v1.OperationList)
+		router.POST("/commands", v1.OperationCommands)
+		router.POST("/cancel", v1.OperationCancel)
+		router.POST("/resume", v1.OperationResume)
+		router.GET("/events", v1.OperationEvents)
 	}
 	return router
 }
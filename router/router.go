@@ -77,6 +77,7 @@ func registerRouter(file *dmgrutil.MiddlewareConfig) *gin.Engine {
 	InitMachineRouter(v1Group, authMiddleware)    // 注册机器路由
 	InitWarehouseRouter(v1Group, authMiddleware)  // 注册离线包路由
 	InitClusterRouter(v1Group, authMiddleware)    // 注册集群管理路由
+	InitOperationRouter(v1Group, authMiddleware)  // 注册集群操作路由
 	InitDatasourceRouter(v1Group, authMiddleware) // 注册任务数据源路由
 	InitTaskRouter(v1Group, authMiddleware)       // 注册任务管理路由
 
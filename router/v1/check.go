@@ -0,0 +1,147 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wentaojin/dmgr/pkg/cluster/module"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"github.com/wentaojin/dmgr/request"
+	"github.com/wentaojin/dmgr/response"
+	"github.com/wentaojin/dmgr/service"
+	"go.uber.org/zap"
+)
+
+// 集群部署或扩容前环境检查，并发检查拓扑中所有主机，返回每台主机检查结果
+func ClusterCheck(c *gin.Context) {
+	var req request.ClusterCheckReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
+		return
+	}
+
+	// 与部署相同的默认端口以及目录
+	topo, uniqueHosts, instanceList := request.ValidDeployReqStructField(request.ClusterDeployReqStruct{ClusterTopology: req.ClusterTopology})
+
+	// 与部署相同的实例名以及主机端口冲突校验
+	if repeatInstList := dmgrutil.FilterRepeatElem(instanceList); len(repeatInstList) != 0 {
+		response.FailWithMsg(c, fmt.Errorf("cluster topology component isn't global unique, exist conflict [%v]", repeatInstList))
+		return
+	}
+	s := service.NewMysqlService()
+	dbHostPortArr, err := s.GetMachinePortArray(uniqueHosts)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	if response.FailWithMsg(c, request.ValidComponentPortConflict(topo.ClusterTopology, dbHostPortArr)) {
+		return
+	}
+
+	machineList, err := s.GetMachineList(uniqueHosts)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	if len(machineList) == 0 || len(machineList) != len(uniqueHosts) {
+		if response.FailWithMsg(c, fmt.Errorf("cluster topology host [%v] isn't match machine list, please add host information first", uniqueHosts)) {
+			return
+		}
+	}
+
+	configs := make(map[string]*module.CheckModuleConfig)
+	for _, t := range topo.ClusterTopology {
+		config, ok := configs[t.MachineHost]
+		if !ok {
+			config = &module.CheckModuleConfig{Apply: req.Apply}
+			configs[t.MachineHost] = config
+		}
+		config.Ports = append(config.Ports, t.ServicePort)
+		// dm-master 存有 peer-port、alertmanager 存有 cluster-port
+		switch t.ComponentName {
+		case dmgrutil.ComponentDmMaster:
+			config.Ports = append(config.Ports, t.PeerPort)
+		case dmgrutil.ComponentAlertmanager:
+			config.Ports = append(config.Ports, t.ClusterPort)
+		}
+		config.Dirs = append(config.Dirs,
+			dmgrutil.AbsClusterDeployDir(t.DeployDir, t.InstanceName),
+			dmgrutil.AbsClusterDataDir(t.DeployDir, t.DataDir, t.InstanceName))
+	}
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]response.ClusterCheckRespStruct, len(machineList))
+	)
+	for i, machine := range machineList {
+		config, ok := configs[machine.SshHost]
+		if !ok {
+			results[i] = checkMachineFailed(response.ClusterCheckRespStruct{MachineHost: machine.SshHost}, fmt.Errorf("machine [%s] isn't in cluster topology", machine.SshHost))
+			continue
+		}
+		wg.Add(1)
+		go func(i int, machine response.MachineRespStruct, config module.CheckModuleConfig) {
+			defer wg.Done()
+			results[i] = checkMachine(c.Request.Context(), s, machine, config)
+		}(i, machine, *config)
+	}
+	wg.Wait()
+
+	response.SuccessWithData(c, results)
+}
+
+// 检查单台主机环境，主机无法连接或检查失败时结果为 fail，检查时采集的主机信息同时记录
+func checkMachine(ctx context.Context, s *service.MysqlService, machine response.MachineRespStruct, config module.CheckModuleConfig) response.ClusterCheckRespStruct {
+	resp := response.ClusterCheckRespStruct{MachineHost: machine.SshHost, Status: module.CheckStatusPass}
+
+	exec, closeExec, err := machineExecutor(machine)
+	if err != nil {
+		return checkMachineFailed(resp, err)
+	}
+	defer closeExec()
+
+	facts, results, err := module.NewCheckModule(config).Execute(ctx, exec)
+	if err != nil {
+		return checkMachineFailed(resp, err)
+	}
+	if err := s.ReplaceMachineFacts(response.MachineFactsRespStruct{
+		SshHost:    machine.SshHost,
+		SshPort:    machine.SshPort,
+		HostFacts:  facts,
+		UpdateTime: time.Now(),
+	}); err != nil {
+		dmgrutil.Logger.Warn("ClusterCheck", zap.String("host", machine.SshHost), zap.String("msg", "record machine facts failed"), zap.Error(err))
+	}
+
+	resp.Results = results
+	for _, r := range results {
+		switch {
+		case r.Status == module.CheckStatusFail:
+			resp.Status = module.CheckStatusFail
+		case r.Status == module.CheckStatusWarn && resp.Status == module.CheckStatusPass:
+			resp.Status = module.CheckStatusWarn
+		}
+	}
+	return resp
+}
+
+func checkMachineFailed(resp response.ClusterCheckRespStruct, err error) response.ClusterCheckRespStruct {
+	resp.Status = module.CheckStatusFail
+	resp.Results = []module.CheckResult{{Name: module.CheckNameConnect, Status: module.CheckStatusFail, Message: err.Error()}}
+	return resp
+}
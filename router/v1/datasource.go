@@ -23,6 +23,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/wentaojin/dmgr/pkg/cluster/api"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
 	"github.com/wentaojin/dmgr/pkg/dmgrutil"
 	"github.com/wentaojin/dmgr/request"
 	"github.com/wentaojin/dmgr/response"
@@ -37,7 +38,13 @@ func TaskClusterCreate(c *gin.Context) {
 	}
 
 	s := service.NewMysqlService()
-	dmMasterUrl, err := GetActiveDmMasterAddr(s, req.ClusterName)
+	unlock, err := LockCluster(c, s, req.ClusterName, dmgrutil.OperationTaskCreate)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	defer unlock()
+
+	dmMasterUrl, tlsConfig, err := GetActiveDmMasterAddr(s, req.ClusterName)
 	if response.FailWithMsg(c, err) {
 		return
 	}
@@ -55,9 +62,11 @@ func TaskClusterCreate(c *gin.Context) {
 			return
 		}
 
-		// 任务 source 创建
-		respByte, err := api.CreateSource(dmMasterUrl, strings.NewReader(jsonSRC))
-		if response.FailWithMsg(c, fmt.Errorf("response: %v, error: %v", string(respByte), err)) {
+		// 任务 source 创建，dm-master 响应以及错误中的数据源密码脱敏
+		respByte, err := api.CreateSource(dmMasterUrl, strings.NewReader(jsonSRC), tlsConfig)
+		if err != nil {
+			secretCtx := executor.WithSecrets(c, resp.Password)
+			response.FailWithMsg(c, fmt.Errorf("response: %v, error: %v", executor.Redact(secretCtx, string(respByte)), executor.Redact(secretCtx, err.Error())))
 			return
 		}
 
@@ -98,6 +107,12 @@ func TaskSourceDelete(c *gin.Context) {
 	//	- 存在多个引用不能删除
 	//  - 符合条件引用删除
 	s := service.NewMysqlService()
+	unlock, err := LockCluster(c, s, req.ClusterName, dmgrutil.OperationTaskSourceDelete)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	defer unlock()
+
 	sourceInfo, err := s.GetTaskSourceBySourceName(req.SourceName)
 	if response.FailWithMsg(c, err) {
 		return
@@ -129,12 +144,12 @@ func TaskSourceDelete(c *gin.Context) {
 	// 2. 停止 source 任务
 	// 3. 删除 dm-master source 任务
 	// 4. 清理数据库元数据信息
-	dmMasterUrl, err := GetActiveDmMasterAddr(s, req.ClusterName)
+	dmMasterUrl, tlsConfig, err := GetActiveDmMasterAddr(s, req.ClusterName)
 	if response.FailWithMsg(c, err) {
 		return
 	}
 
-	respByte, err := api.GetSourceStatusBySourceName(dmMasterUrl, req.SourceName)
+	respByte, err := api.GetSourceStatusBySourceName(dmMasterUrl, req.SourceName, tlsConfig)
 	if response.FailWithMsg(c, err) {
 		return
 	}
@@ -146,13 +161,13 @@ func TaskSourceDelete(c *gin.Context) {
 		if response.FailWithMsg(c, err) {
 			return
 		}
-		_, err = api.StopSourceBySourceName(dmMasterUrl, req.SourceName, strings.NewReader(jsonWK))
+		_, err = api.StopSourceBySourceName(dmMasterUrl, req.SourceName, strings.NewReader(jsonWK), tlsConfig)
 		if response.FailWithMsg(c, err) {
 			return
 		}
 	}
 
-	_, err = api.DeleteSourceBySourceName(dmMasterUrl, req.SourceName)
+	_, err = api.DeleteSourceBySourceName(dmMasterUrl, req.SourceName, tlsConfig)
 	if response.FailWithMsg(c, err) {
 		return
 	}
@@ -175,6 +190,12 @@ func TaskSourceUpdate(c *gin.Context) {
 	// 2. 查询 source name 引用关系
 	// 	- 根据引用关系判断是否可修改
 	s := service.NewMysqlService()
+	unlock, err := LockCluster(c, s, req.ClusterName, dmgrutil.OperationTaskSourceUpdate)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	defer unlock()
+
 	sourceInfo, err := s.GetTaskSourceBySourceName(req.SourceName)
 	if response.FailWithMsg(c, err) {
 		return
@@ -204,12 +225,12 @@ func TaskSourceUpdate(c *gin.Context) {
 
 	for _, task := range taskCluster {
 		if task.ClusterName == req.ClusterName && task.TaskName == req.TaskName && task.SourceName == req.SourceName {
-			dmMasterUrl, err := GetActiveDmMasterAddr(s, req.ClusterName)
+			dmMasterUrl, tlsConfig, err := GetActiveDmMasterAddr(s, req.ClusterName)
 			if response.FailWithMsg(c, err) {
 				return
 			}
 
-			respByte, err := api.GetSourceStatusBySourceName(dmMasterUrl, req.SourceName)
+			respByte, err := api.GetSourceStatusBySourceName(dmMasterUrl, req.SourceName, tlsConfig)
 			if response.FailWithMsg(c, err) {
 				return
 			}
@@ -221,7 +242,7 @@ func TaskSourceUpdate(c *gin.Context) {
 				if response.FailWithMsg(c, err) {
 					return
 				}
-				_, err = api.StopSourceBySourceName(dmMasterUrl, req.SourceName, strings.NewReader(jsonWK))
+				_, err = api.StopSourceBySourceName(dmMasterUrl, req.SourceName, strings.NewReader(jsonWK), tlsConfig)
 				if response.FailWithMsg(c, err) {
 					return
 				}
@@ -239,7 +260,7 @@ func TaskSourceUpdate(c *gin.Context) {
 			if response.FailWithMsg(c, err) {
 				return
 			}
-			_, err = api.StartSourceBySourceName(dmMasterUrl, req.SourceName, strings.NewReader(jsonSRC))
+			_, err = api.StartSourceBySourceName(dmMasterUrl, req.SourceName, strings.NewReader(jsonSRC), tlsConfig)
 			if response.FailWithMsg(c, err) {
 				return
 			}
@@ -279,6 +300,12 @@ func TaskTargetDelete(c *gin.Context) {
 	//	- 存在多个引用不能删除
 	//  - 符合条件引用删除
 	s := service.NewMysqlService()
+	unlock, err := LockCluster(c, s, req.ClusterName, dmgrutil.OperationTaskTargetDelete)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	defer unlock()
+
 	targetInfo, err := s.GetTaskSourceBySourceName(req.TargetName)
 	if response.FailWithMsg(c, err) {
 		return
@@ -306,7 +333,7 @@ func TaskTargetDelete(c *gin.Context) {
 		}
 	}
 
-	dmMasterUrl, err := GetActiveDmMasterAddr(s, req.ClusterName)
+	dmMasterUrl, tlsConfig, err := GetActiveDmMasterAddr(s, req.ClusterName)
 	if response.FailWithMsg(c, err) {
 		return
 	}
@@ -314,7 +341,7 @@ func TaskTargetDelete(c *gin.Context) {
 	// todo: API 待完善
 	// 1. 停止同步任务（待完善补充）
 	// 2. 只停止任务不删除任务(临时设置删除)
-	_, err = api.DeleteTaskByTaskName(dmMasterUrl, req.TaskName)
+	_, err = api.DeleteTaskByTaskName(dmMasterUrl, req.TaskName, tlsConfig)
 	if response.FailWithMsg(c, err) {
 		return
 	}
@@ -337,6 +364,12 @@ func TaskTargetUpdate(c *gin.Context) {
 	// 2. 查询 source name 引用关系
 	// 	- 根据引用关系判断是否可修改
 	s := service.NewMysqlService()
+	unlock, err := LockCluster(c, s, req.ClusterName, dmgrutil.OperationTaskTargetUpdate)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	defer unlock()
+
 	targetInfo, err := s.GetTaskTargetByTargetName(req.TargetName)
 	if response.FailWithMsg(c, err) {
 		return
@@ -366,7 +399,7 @@ func TaskTargetUpdate(c *gin.Context) {
 
 	for _, task := range taskCluster {
 		if task.ClusterName == req.ClusterName && task.TaskName == req.TaskName && task.TargetName == req.TargetName {
-			dmMasterUrl, err := GetActiveDmMasterAddr(s, req.ClusterName)
+			dmMasterUrl, tlsConfig, err := GetActiveDmMasterAddr(s, req.ClusterName)
 			if response.FailWithMsg(c, err) {
 				return
 			}
@@ -374,7 +407,7 @@ func TaskTargetUpdate(c *gin.Context) {
 			// todo: API 待完善
 			// 1. 停止任务同步 (API 待补充完善)
 			// 2. 重新启动任务同步（请求 struct body 待补充完善，暂时以 task struct 代替）
-			_, err = api.StartTaskMigration(dmMasterUrl, strings.NewReader("task struct"))
+			_, err = api.StartTaskMigration(dmMasterUrl, strings.NewReader("task struct"), tlsConfig)
 			if response.FailWithMsg(c, err) {
 				return
 			}
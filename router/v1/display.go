@@ -0,0 +1,237 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wentaojin/dmgr/pkg/cluster/api"
+	"github.com/wentaojin/dmgr/pkg/cluster/module"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"github.com/wentaojin/dmgr/request"
+	"github.com/wentaojin/dmgr/response"
+	"github.com/wentaojin/dmgr/service"
+)
+
+// 集群实例实时状态，通过 SSH 查询 systemd 服务状态以及端口监听，dm-master、dm-worker 通过 dm-master 接口查询 leader、存活以及 worker 阶段
+func ClusterDisplay(c *gin.Context) {
+	var req request.ClusterDisplayReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
+		return
+	}
+
+	s := service.NewMysqlService()
+	clusterMeta, err := s.GetClusterMeta(req.ClusterName)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("cluster [%s] not exist", req.ClusterName)
+	}
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	tlsConfig, err := clusterTLSConfig(clusterMeta)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	clusterTopos, err := s.GetClusterTopologyByClusterName(req.ClusterName)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+
+	hostTopos := make(map[string][]response.ClusterTopologyRespStruct)
+	for _, t := range clusterTopos {
+		hostTopos[t.MachineHost] = append(hostTopos[t.MachineHost], t)
+	}
+	var hosts []string
+	for host := range hostTopos {
+		hosts = append(hosts, host)
+	}
+	machineList, err := s.GetMachineList(hosts)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+
+	// 按主机并发查询，每台主机一次 SSH 命令查询所有实例
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		instances []response.InstanceDisplayRespStruct
+	)
+	for _, machine := range machineList {
+		wg.Add(1)
+		go func(machine response.MachineRespStruct) {
+			defer wg.Done()
+			insts := displayMachineInstances(c.Request.Context(), machine, hostTopos[machine.SshHost], clusterMeta.ClusterVersion)
+			mu.Lock()
+			instances = append(instances, insts...)
+			mu.Unlock()
+		}(machine)
+		delete(hostTopos, machine.SshHost)
+	}
+	wg.Wait()
+
+	// 拓扑中主机已不存在于机器信息中
+	for host, topos := range hostTopos {
+		for _, t := range topos {
+			inst := newInstanceDisplay(t, clusterMeta.ClusterVersion)
+			inst.Message = fmt.Sprintf("machine [%s] not exist", host)
+			instances = append(instances, inst)
+		}
+	}
+
+	displayDmMembers(instances, tlsConfig)
+
+	sort.SliceStable(instances, func(i, j int) bool {
+		oi, oj := componentOrder(instances[i].ComponentName), componentOrder(instances[j].ComponentName)
+		if oi != oj {
+			return oi < oj
+		}
+		return instances[i].InstanceName < instances[j].InstanceName
+	})
+
+	response.SuccessWithData(c, response.ClusterDisplayRespStruct{
+		ClusterName:    clusterMeta.ClusterName,
+		ClusterVersion: clusterMeta.ClusterVersion,
+		ClusterStatus:  clusterMeta.ClusterStatus,
+		Instances:      instances,
+	})
+}
+
+func newInstanceDisplay(t response.ClusterTopologyRespStruct, clusterVersion string) response.InstanceDisplayRespStruct {
+	return response.InstanceDisplayRespStruct{
+		InstanceName:  t.InstanceName,
+		ComponentName: t.ComponentName,
+		MachineHost:   t.MachineHost,
+		ServicePort:   t.ServicePort,
+		Status:        dmgrutil.InstanceUnknownStatus,
+		Version:       clusterVersion,
+		Hotfix:        t.Hotfix,
+	}
+}
+
+// 查询单台主机所有实例 systemd 服务状态以及端口监听，主机无法连接时实例状态为 Unknown
+func displayMachineInstances(ctx context.Context, machine response.MachineRespStruct, topos []response.ClusterTopologyRespStruct, clusterVersion string) []response.InstanceDisplayRespStruct {
+	var (
+		units     []string
+		instances []response.InstanceDisplayRespStruct
+	)
+	for _, t := range topos {
+		units = append(units, fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort))
+		instances = append(instances, newInstanceDisplay(t, clusterVersion))
+	}
+
+	exec, closeExec, err := machineExecutor(machine)
+	if err != nil {
+		return displayFailed(instances, err)
+	}
+	defer closeExec()
+
+	unitStatus, listenPorts, err := module.NewStatusModule(units).Execute(ctx, exec)
+	if err != nil {
+		return displayFailed(instances, err)
+	}
+	listen := make(map[uint64]bool)
+	for _, p := range listenPorts {
+		listen[uint64(p)] = true
+	}
+
+	for i := range instances {
+		inst := &instances[i]
+		status := unitStatus[units[i]]
+		inst.SystemdState = status.ActiveState
+		inst.PortAlive = listen[inst.ServicePort]
+		if status.Uptime > 0 {
+			inst.Uptime = status.Uptime.String()
+		}
+		switch {
+		case status.ActiveState != "active":
+			inst.Status = dmgrutil.InstanceDownStatus
+		case !inst.PortAlive:
+			inst.Status = dmgrutil.InstanceUnhealthyStatus
+		default:
+			inst.Status = dmgrutil.InstanceUpStatus
+		}
+	}
+	return instances
+}
+
+func displayFailed(instances []response.InstanceDisplayRespStruct, err error) []response.InstanceDisplayRespStruct {
+	for i := range instances {
+		instances[i].Message = err.Error()
+	}
+	return instances
+}
+
+// 通过已监听端口的 dm-master 查询 dm-master leader、存活以及 dm-worker 阶段
+func displayDmMembers(instances []response.InstanceDisplayRespStruct, tlsConfig *tls.Config) {
+	var dmMasterAddr []string
+	for _, inst := range instances {
+		if inst.ComponentName == dmgrutil.ComponentDmMaster && inst.PortAlive {
+			dmMasterAddr = append(dmMasterAddr, fmt.Sprintf("%s:%d", inst.MachineHost, inst.ServicePort))
+		}
+	}
+	if len(dmMasterAddr) == 0 {
+		return
+	}
+	dmMasterClient := api.NewDMMasterClient(dmMasterAddr, api.DmMasterApiTimeout, tlsConfig)
+
+	for i := range instances {
+		inst := &instances[i]
+		if inst.Status != dmgrutil.InstanceUpStatus {
+			continue
+		}
+		switch inst.ComponentName {
+		case dmgrutil.ComponentDmMaster:
+			isFound, isActive, isLeader, err := dmMasterClient.GetMaster(inst.InstanceName)
+			if err != nil {
+				inst.Message = err.Error()
+				continue
+			}
+			inst.Leader, inst.Alive = isLeader, isLeader || isActive
+			switch {
+			case isLeader:
+				inst.Status = dmgrutil.InstanceLeaderStatus
+			case !isFound || !isActive:
+				inst.Status = dmgrutil.InstanceUnhealthyStatus
+			}
+		case dmgrutil.ComponentDmWorker:
+			stage, err := dmMasterClient.GetWorker(inst.InstanceName)
+			if err != nil {
+				inst.Message = err.Error()
+				continue
+			}
+			inst.WorkerStage = stage
+			if stage != "" {
+				inst.Status = stage
+			}
+		}
+	}
+}
+
+// 组件启动顺序，未知组件排在最后
+func componentOrder(componentName string) int {
+	for i, comp := range dmgrutil.StartComponentOrder {
+		if comp == componentName {
+			return i
+		}
+	}
+	return len(dmgrutil.StartComponentOrder)
+}
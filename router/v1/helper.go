@@ -16,17 +16,21 @@ limitations under the License.
 package v1
 
 import (
+	"crypto/tls"
 	"fmt"
 	"path/filepath"
 	"strings"
 
 	"github.com/wentaojin/dmgr/pkg/cluster/api"
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
 	"github.com/wentaojin/dmgr/service"
 
 	"github.com/wentaojin/dmgr/request"
 
 	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+	"github.com/wentaojin/dmgr/pkg/cluster/module"
 	"github.com/wentaojin/dmgr/pkg/cluster/task"
+	"github.com/wentaojin/dmgr/pkg/cluster/template"
 	"github.com/wentaojin/dmgr/pkg/dmgrutil"
 	"github.com/wentaojin/dmgr/response"
 )
@@ -60,6 +64,7 @@ func GenerateClusterTopology(clusterMeta interface{}, topoReq []request.Topology
 					t.ClusterPath = v.ClusterPath
 					t.AdminUser = v.AdminUser
 					t.AdminPassword = v.AdminPassword
+					t.TLSEnabled = v.TLSEnabled
 				case response.ClusterMetaRespStruct:
 					t.ClusterName = v.ClusterName
 					t.ClusterUser = v.ClusterUser
@@ -67,6 +72,7 @@ func GenerateClusterTopology(clusterMeta interface{}, topoReq []request.Topology
 					t.ClusterPath = v.ClusterPath
 					t.AdminUser = v.AdminUser
 					t.AdminPassword = v.AdminPassword
+					t.TLSEnabled = v.TLSEnabled
 				default:
 					return clusterTopo, fmt.Errorf("component [%v] instance [%v] host [%v] assert failed", topo.ComponentName, topo.InstanceName, topo.MachineHost)
 				}
@@ -210,6 +216,36 @@ func CopyClusterFile(clusterTopo []response.ClusterTopologyRespStruct) []task.Ta
 					0)
 		}
 
+		// 集群开启 TLS 时分发 CA 以及实例证书至 {deploy_dir}/tls，证书以组件名命名
+		if cluster.IsTLSEnabled() && isTLSComponent(componentName) {
+			certDir := dmgrutil.AbsClusterCertDir(cluster.ClusterPath, cluster.ClusterName)
+			tlsDir := dmgrutil.AbsClusterTLSDir(cluster.DeployDir, cluster.InstanceName)
+			copyFileTask.CopyFile(
+				cluster.ClusterName,
+				dmgrutil.CertFile(certDir, dmgrutil.CertCAName),
+				dmgrutil.CertFile(tlsDir, dmgrutil.CertCAName),
+				dmgrutil.FileTypeTLS,
+				cluster.MachineHost,
+				false,
+				0).
+				CopyFile(
+					cluster.ClusterName,
+					dmgrutil.CertFile(certDir, instanceCertName(cluster)),
+					dmgrutil.CertFile(tlsDir, componentName),
+					dmgrutil.FileTypeTLS,
+					cluster.MachineHost,
+					false,
+					0).
+				CopyFile(
+					cluster.ClusterName,
+					dmgrutil.CertKeyFile(certDir, instanceCertName(cluster)),
+					dmgrutil.CertKeyFile(tlsDir, componentName),
+					dmgrutil.FileTypeTLS,
+					cluster.MachineHost,
+					false,
+					0)
+		}
+
 		copyFileTask.CopyFile(
 			cluster.ClusterName,
 			filepath.Join(dmgrutil.AbsClusterCacheDir(cluster.ClusterPath, cluster.ClusterName), fmt.Sprintf("%s-%s-%d.service", componentName, cluster.MachineHost, cluster.ServicePort)),
@@ -218,12 +254,55 @@ func CopyClusterFile(clusterTopo []response.ClusterTopologyRespStruct) []task.Ta
 			cluster.MachineHost,
 			false,
 			0)
-		copyFileTasks = append(copyFileTasks, copyFileTask.BuildTask())
+		copyFileTasks = append(copyFileTasks, task.WithRetry(copyFileTask.BuildTask(), task.DefaultRetryPolicy()))
 	}
 
 	return copyFileTasks
 }
 
+// 生成组件配置文件、运行脚本，grafana 用户密码标记为集群操作敏感参数
+func generateClusterFile(ctx *ctxt.Context, topo []response.ClusterTopologyRespStruct, cos template.ClusterOperatorStage, clusterStage string, adminUser, adminPassword string) error {
+	ctx.AddSecrets(adminPassword)
+	for _, t := range topo {
+		ctx.AddSecrets(t.AdminPassword)
+	}
+	return template.GenerateClusterFileWithStage(topo, cos, clusterStage, adminUser, adminPassword)
+}
+
+// 生成集群 TLS 证书，集群未开启 TLS 时跳过
+// 1、集群 CA 以及 dmgr 客户端证书只生成一次，扩容阶段复用
+// 2、dm-master、dm-worker、prometheus 按实例生成证书，证书 SAN 为实例所在主机
+func GenerateClusterCert(clusterTopo []response.ClusterTopologyRespStruct) error {
+	for _, t := range clusterTopo {
+		componentName := strings.ToLower(t.ComponentName)
+		if !t.IsTLSEnabled() || !isTLSComponent(componentName) {
+			continue
+		}
+		certDir := dmgrutil.AbsClusterCertDir(t.ClusterPath, t.ClusterName)
+		if err := dmgrutil.GenerateClusterCA(certDir, t.ClusterName); err != nil {
+			return err
+		}
+		if err := dmgrutil.GenerateCert(certDir, instanceCertName(t), componentName, []string{t.MachineHost}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 需要 TLS 证书的组件
+func isTLSComponent(componentName string) bool {
+	switch componentName {
+	case dmgrutil.ComponentDmMaster, dmgrutil.ComponentDmWorker, dmgrutil.ComponentPrometheus:
+		return true
+	}
+	return false
+}
+
+// 实例证书名，以组件名为前缀，避免与 CA 以及客户端证书重名
+func instanceCertName(t response.ClusterTopologyRespStruct) string {
+	return fmt.Sprintf("%s-%s", strings.ToLower(t.ComponentName), t.InstanceName)
+}
+
 // 用于初始化环境的任务
 func EnvClusterUserInit(machineList []response.MachineRespStruct, clusterUser, skipCreateUser string) []task.Task {
 	var envInitTasks []task.Task
@@ -238,6 +317,7 @@ func EnvClusterUserInit(machineList []response.MachineRespStruct, clusterUser, s
 				machine.SshPassword,
 				"",
 				"",
+				machine.SudoPassword,
 				executor.DefaultConnectTimeout,
 				executor.DefaultExecuteTimeout,
 			).
@@ -254,74 +334,227 @@ func EnvClusterUserInit(machineList []response.MachineRespStruct, clusterUser, s
 	return envInitTasks
 }
 
-// 用于 COPY 集群组件的任务
+// 用于 COPY 集群组件的任务，按主机分组
+// 1、同一主机的组件文件只上传一次至主机暂存目录，再本地复制至各实例 bin 目录
+// 2、复制完成后清理主机暂存目录
+// 3、暂存目录位于主机第一个实例的部署目录下，各实例使用 cp 复制而非硬链接或 mv，实例部署目录无需与暂存目录位于同一文件系统，
+// 但该部署目录所在文件系统需要额外容纳一份组件文件
 func EnvClusterComponentInit(clusterTopo []response.ClusterTopologyRespStruct,
 	clusterUntarDir string) []task.Task {
-	var copyCompTasks []task.Task
-
-	// 集群环境初始化以及组件名 Copy
+	var (
+		hosts         []string
+		hostTopos     = make(map[string][]response.ClusterTopologyRespStruct)
+		copyCompTasks []task.Task
+	)
 	for _, cluster := range clusterTopo {
+		if _, ok := hostTopos[cluster.MachineHost]; !ok {
+			hosts = append(hosts, cluster.MachineHost)
+		}
+		hostTopos[cluster.MachineHost] = append(hostTopos[cluster.MachineHost], cluster)
+	}
+
+	for _, host := range hosts {
+		topos := hostTopos[host]
+		stageDir := dmgrutil.AbsClusterStageDir(topos[0].DeployDir, topos[0].ClusterVersion)
+
 		copyCompTask := task.NewBuilder().
 			UserSSH(
-				cluster.MachineHost,
-				cluster.SshPort,
-				cluster.ClusterUser,
+				host,
+				topos[0].SshPort,
+				topos[0].ClusterUser,
 				executor.DefaultConnectTimeout,
 				executor.DefaultExecuteTimeout,
-			).
-			Mkdir(cluster.ClusterUser, cluster.MachineHost, []string{
+			)
+
+		dirs := []string{stageDir}
+		for _, cluster := range topos {
+			dirs = append(dirs,
 				dmgrutil.AbsClusterBinDir(cluster.DeployDir, cluster.InstanceName),
 				dmgrutil.AbsClusterConfDir(cluster.DeployDir, cluster.InstanceName),
 				dmgrutil.AbsClusterScriptDir(cluster.DeployDir, cluster.InstanceName),
 				dmgrutil.AbsClusterDataDir(cluster.DeployDir, cluster.DataDir, cluster.InstanceName),
-				dmgrutil.AbsClusterLogDir(cluster.DeployDir, cluster.LogDir, cluster.InstanceName)}...)
+				dmgrutil.AbsClusterLogDir(cluster.DeployDir, cluster.LogDir, cluster.InstanceName))
+			if cluster.IsTLSEnabled() && isTLSComponent(strings.ToLower(cluster.ComponentName)) {
+				dirs = append(dirs, dmgrutil.AbsClusterTLSDir(cluster.DeployDir, cluster.InstanceName))
+			}
+		}
+		copyCompTask.Mkdir(topos[0].ClusterUser, host, dirs...)
 
-		switch strings.ToLower(cluster.ComponentName) {
-		case dmgrutil.ComponentGrafana:
-			copyCompTask.CopyComponent(
-				cluster.ClusterName,
-				cluster.ComponentName,
-				cluster.ClusterVersion,
-				dmgrutil.AbsClusterGrafanaComponent(cluster.ClusterPath, cluster.ClusterName, cluster.ClusterVersion, dmgrutil.ComponentGrafanaTarPKG),
-				cluster.MachineHost,
-				fmt.Sprintf("%s/%s", dmgrutil.AbsClusterDeployDir(cluster.DeployDir, cluster.InstanceName), dmgrutil.ComponentGrafanaTarPKG))
-		default:
-			copyCompTask.CopyComponent(
+		// 组件文件 -> 主机暂存文件
+		staged := make(map[string]string)
+		for _, cluster := range topos {
+			src, _ := componentPath(cluster, clusterUntarDir)
+			if _, ok := staged[src]; !ok {
+				staged[src] = filepath.Join(stageDir, filepath.Base(src))
+				copyCompTask.StageComponent(host, src, staged[src])
+			}
+		}
+		for _, cluster := range topos {
+			src, dst := componentPath(cluster, clusterUntarDir)
+			copyCompTask.CopyStagedComponent(
 				cluster.ClusterName,
 				cluster.ComponentName,
 				cluster.ClusterVersion,
-				filepath.Join(clusterUntarDir, dmgrutil.DirBin, strings.ToLower(cluster.ComponentName)),
-				cluster.MachineHost,
-				filepath.Join(dmgrutil.AbsClusterBinDir(cluster.DeployDir, cluster.InstanceName), strings.ToLower(cluster.ComponentName)),
-			)
+				src,
+				staged[src],
+				host,
+				dst)
 		}
-		copyCompTasks = append(copyCompTasks, copyCompTask.BuildTask())
+
+		machineHost := host
+		copyCompTask.Func(fmt.Sprintf("Clean stage dir %s:%s", machineHost, stageDir), func(ctx *ctxt.Context) error {
+			exec, ok := ctx.GetExecutor(machineHost)
+			if !ok {
+				return task.ErrNoExecutor
+			}
+			// 暂存目录为空时一并删除其父目录 .stage
+			_, _, err := exec.Execute(ctx, fmt.Sprintf(`rm -rf %[1]s && if [ -d %[2]s ]; then rmdir --ignore-fail-on-non-empty %[2]s; fi`, stageDir, filepath.Dir(stageDir)), false)
+			return err
+		})
+		copyCompTasks = append(copyCompTasks, task.WithRetry(copyCompTask.BuildTask(), task.DefaultRetryPolicy()))
 	}
 
 	return copyCompTasks
 }
 
-// 用于 DM Master API 访问
-func GetActiveDmMasterAddr(s *service.MysqlService, clusterName string) (string, error) {
-	var (
-		dmMasterAddr     []string
-		activeMasterAddr string
-	)
+// 组件文件以及实例目标文件
+func componentPath(cluster response.ClusterTopologyRespStruct, clusterUntarDir string) (string, string) {
+	if strings.ToLower(cluster.ComponentName) == dmgrutil.ComponentGrafana {
+		return dmgrutil.AbsClusterGrafanaComponent(cluster.ClusterPath, cluster.ClusterName, cluster.ClusterVersion, dmgrutil.ComponentGrafanaTarPKG),
+			fmt.Sprintf("%s/%s", dmgrutil.AbsClusterDeployDir(cluster.DeployDir, cluster.InstanceName), dmgrutil.ComponentGrafanaTarPKG)
+	}
+	return filepath.Join(clusterUntarDir, dmgrutil.DirBin, strings.ToLower(cluster.ComponentName)),
+		filepath.Join(dmgrutil.AbsClusterBinDir(cluster.DeployDir, cluster.InstanceName), strings.ToLower(cluster.ComponentName))
+}
+
+// 用于 DM Master API 访问，返回 leader 访问地址以及集群 TLS 配置
+func GetActiveDmMasterAddr(s *service.MysqlService, clusterName string) (string, *tls.Config, error) {
+	dmMasterAddr, err := getDmMasterAddrs(s, clusterName)
+	if err != nil {
+		return "", nil, err
+	}
+	tlsConfig, err := getClusterTLSConfig(s, clusterName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	dmMasterClient := api.NewDMMasterClient(dmMasterAddr, api.DmMasterApiTimeout, tlsConfig)
+
+	_, activeMasterAddr, err := dmMasterClient.GetLeader(api.DefaultRetryOpt)
+	if err != nil {
+		return activeMasterAddr, tlsConfig, err
+	}
+
+	return dmMasterClient.GetURL(activeMasterAddr), tlsConfig, nil
+}
 
+// 获取 dmgr 访问集群组件的 TLS 配置，集群未开启 TLS 时返回 nil
+func getClusterTLSConfig(s *service.MysqlService, clusterName string) (*tls.Config, error) {
+	clusterMeta, err := s.GetClusterMeta(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return clusterTLSConfig(clusterMeta)
+}
+
+// 加载集群 dmgr 客户端证书，集群未开启 TLS 时返回 nil
+func clusterTLSConfig(clusterMeta response.ClusterMetaRespStruct) (*tls.Config, error) {
+	if !clusterMeta.IsTLSEnabled() {
+		return nil, nil
+	}
+	tlsConfig, err := dmgrutil.LoadClientTLSConfig(dmgrutil.AbsClusterCertDir(clusterMeta.ClusterPath, clusterMeta.ClusterName))
+	if err != nil {
+		return nil, fmt.Errorf("load cluster [%s] tls client cert failed: %v", clusterMeta.ClusterName, err)
+	}
+	return tlsConfig, nil
+}
+
+// 获取集群所有 dm-master 地址
+func getDmMasterAddrs(s *service.MysqlService, clusterName string) ([]string, error) {
+	var dmMasterAddr []string
 	dmMasters, err := s.GetClusterComponent(clusterName, dmgrutil.ComponentDmMaster)
 	if err != nil {
-		return activeMasterAddr, err
+		return dmMasterAddr, err
 	}
 	for _, dm := range dmMasters {
 		dmMasterAddr = append(dmMasterAddr, fmt.Sprintf("%s:%d", dm.MachineHost, dm.ServicePort))
 	}
+	return dmMasterAddr, nil
+}
 
-	dmMasterClient := api.NewDMMasterClient(dmMasterAddr, api.DmMasterApiTimeout, nil)
+// 滚动重启顺序，按组件启动顺序，dm-master 先重启 follower 最后重启 leader
+// 无法获取 leader（如集群未启动）时 dm-master 保持原有顺序
+func RollingRestartOrder(clusterTopos []response.ClusterTopologyRespStruct, dmMasterAddr []string, tlsConfig *tls.Config) []response.ClusterTopologyRespStruct {
+	var leader string
+	if len(dmMasterAddr) > 0 {
+		leader, _, _ = api.NewDMMasterClient(dmMasterAddr, api.DmMasterApiTimeout, tlsConfig).
+			GetLeader(&dmgrutil.RetryOption{Attempts: 1, Timeout: api.DmMasterApiTimeout})
+	}
 
-	_, activeMasterAddr, err = dmMasterClient.GetLeader(api.DefaultRetryOpt)
-	if err != nil {
-		return activeMasterAddr, err
+	var ordered []response.ClusterTopologyRespStruct
+	for _, component := range dmgrutil.StartComponentOrder {
+		var leaderTopo []response.ClusterTopologyRespStruct
+		for _, t := range clusterTopos {
+			if component != strings.ToLower(t.ComponentName) {
+				continue
+			}
+			if component == dmgrutil.ComponentDmMaster && t.InstanceName == leader {
+				leaderTopo = append(leaderTopo, t)
+				continue
+			}
+			ordered = append(ordered, t)
+		}
+		ordered = append(ordered, leaderTopo...)
+	}
+	return ordered
+}
+
+// 滚动重启单个实例，operate 为实例停止后、启动前的操作（如复制组件、配置文件），可为空
+// dm-master 为 leader 时重启前先驱逐 leader，dm-worker 停止前先迁移绑定的数据源至空闲 dm-worker
+// dm-master、dm-worker 启动后需通过健康检查才能继续下一个实例
+func RollingRestartInstance(t response.ClusterTopologyRespStruct, dmMasterAddr []string, tlsConfig *tls.Config, operate func(b *task.Builder) *task.Builder) *task.Builder {
+	serviceName := fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort)
+	componentName := strings.ToLower(t.ComponentName)
+
+	b := task.NewBuilder().
+		SSHKeySet(
+			filepath.Join(
+				dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
+			filepath.Join(
+				dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
+		UserSSH(
+			t.MachineHost,
+			t.SshPort,
+			t.ClusterUser,
+			executor.DefaultConnectTimeout,
+			module.DefaultSystemdExecuteTimeout)
+	switch componentName {
+	case dmgrutil.ComponentDmMaster:
+		b = b.EvictLeader(dmMasterAddr, tlsConfig, t.InstanceName)
+	case dmgrutil.ComponentDmWorker:
+		// 逐个重启，其余 dm-worker 均可作为迁移目标
+		b = b.DrainWorker(dmMasterAddr, tlsConfig, t.InstanceName, nil, module.DefaultSystemdExecuteTimeout)
+	}
+	b = b.StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir, serviceName, module.DefaultSystemdExecuteTimeout)
+	if operate != nil {
+		b = operate(b)
+	}
+	b = b.StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir, serviceName, module.DefaultSystemdExecuteTimeout).
+		WithRetry(task.DefaultRetryPolicy())
+	if componentName == dmgrutil.ComponentDmMaster || componentName == dmgrutil.ComponentDmWorker {
+		b = b.WaitHealthy(dmMasterAddr, tlsConfig, componentName, t.InstanceName, module.DefaultSystemdExecuteTimeout)
 	}
+	return b
+}
 
-	return dmMasterClient.GetURL(activeMasterAddr), nil
+// 拓扑中的 dm-worker 实例名，用于集群停止、缩容时排除同一操作中将要停止的 dm-worker，不作为数据源迁移目标
+// 滚动重启逐个重启 dm-worker，其余 dm-worker 保持运行，无需排除
+func dmWorkerInstances(clusterTopos []response.ClusterTopologyRespStruct) []string {
+	var workers []string
+	for _, t := range clusterTopos {
+		if strings.ToLower(t.ComponentName) == dmgrutil.ComponentDmWorker {
+			workers = append(workers, t.InstanceName)
+		}
+	}
+	return workers
 }
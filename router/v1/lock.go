@@ -0,0 +1,84 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wentaojin/dmgr/pkg/cluster/operation"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"github.com/wentaojin/dmgr/request"
+	"github.com/wentaojin/dmgr/response"
+	"github.com/wentaojin/dmgr/service"
+	"go.uber.org/zap"
+)
+
+// 集群锁列表查询
+func ClusterLockList(c *gin.Context) {
+	s := service.NewMysqlService()
+	resp, err := s.GetClusterLockList()
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	response.SuccessWithData(c, resp)
+}
+
+// 强制释放集群锁
+// 用于清理 dmgr 异常退出等原因残留的集群锁，不会取消持有集群锁的集群操作
+func ClusterLockRelease(c *gin.Context) {
+	var req request.ClusterLockReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
+		return
+	}
+
+	s := service.NewMysqlService()
+	lock, err := s.GetClusterLock(req.ClusterName)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("cluster [%s] isn't locked", req.ClusterName)
+	}
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	if response.FailWithMsg(c, s.ForceReleaseClusterLock(req.ClusterName)) {
+		return
+	}
+	dmgrutil.Logger.Warn("ClusterLock", zap.String("cluster", req.ClusterName),
+		zap.String("owner", lock.Owner),
+		zap.String("operation", lock.OperationType),
+		zap.Uint64("operation_id", lock.OperationID),
+		zap.String("released_by", GetCurrentUser(c).Username),
+		zap.String("msg", "cluster lock force released"))
+	response.SuccessWithoutData(c)
+}
+
+// 同步运行的集群变更获取集群排他锁，返回释放函数
+func LockCluster(c *gin.Context, s *service.MysqlService, clusterName, operationType string) (func(), error) {
+	lock, err := s.AcquireClusterLock(clusterName, GetCurrentUser(c).Username, operationType, operation.LockTTL())
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		releaseClusterLock(s, lock)
+	}, nil
+}
+
+func releaseClusterLock(s *service.MysqlService, lock service.ClusterLock) {
+	if err := s.ReleaseClusterLock(lock); err != nil {
+		dmgrutil.Logger.Error("ClusterLock", zap.String("cluster", lock.ClusterName), zap.Error(err))
+	}
+}
@@ -16,13 +16,29 @@ limitations under the License.
 package v1
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+	"github.com/wentaojin/dmgr/pkg/cluster/module"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
 	"github.com/wentaojin/dmgr/request"
 	"github.com/wentaojin/dmgr/response"
 	"github.com/wentaojin/dmgr/service"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
 )
 
-// 新增机器
+// 新增机器，首次新增时记录机器以及跳板机主机公钥
+// dmgr 所在本机使用本地执行器，无需记录主机公钥
 func AddMachine(c *gin.Context) {
 	var req request.MachineReqStruct
 	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
@@ -30,8 +46,236 @@ func AddMachine(c *gin.Context) {
 	}
 
 	s := service.NewMysqlService()
+	if !executor.IsLocalHost(req.SshHost) {
+		if _, err := trustMachineHostKey(s, req); response.FailWithMsg(c, err) {
+			return
+		}
+	}
+
 	if response.FailWithMsg(c, s.AddMachine(req)) {
 		return
 	}
 	response.SuccessWithoutData(c)
 }
+
+// 首次新增机器时记录跳板机以及机器主机公钥，机器主机公钥通过已信任的跳板机获取
+func trustMachineHostKey(s *service.MysqlService, req request.MachineReqStruct) (response.HostKeyRespStruct, error) {
+	machine := response.MachineRespStruct{
+		ProxyHost:     req.ProxyHost,
+		ProxyPort:     req.ProxyPort,
+		ProxyUser:     req.ProxyUser,
+		ProxyPassword: req.ProxyPassword,
+		ProxyKeyFile:  req.ProxyKeyFile,
+	}
+	proxy := machine.SSHProxy()
+	if proxy != nil {
+		proxyKey, err := trustHostKey(s, proxy.Host, uint64(proxy.Port), nil, false)
+		if err != nil {
+			return response.HostKeyRespStruct{}, err
+		}
+		proxy.Fingerprint = proxyKey.Fingerprint
+	}
+	return trustHostKey(s, req.SshHost, req.SshPort, proxy, false)
+}
+
+// 记录所有未信任机器以及跳板机的主机公钥（首次使用时信任），已信任的主机公钥保持不变
+// 用于升级前新增、未记录主机公钥的机器，单台机器失败不影响其他机器
+func BackfillMachineHostKey(c *gin.Context) {
+	s := service.NewMysqlService()
+	machines, err := s.GetUntrustedMachineList()
+	if response.FailWithMsg(c, err) {
+		return
+	}
+
+	var (
+		hostKeys []response.HostKeyRespStruct
+		failed   []string
+	)
+	for _, m := range machines {
+		if executor.IsLocalHost(m.SshHost) {
+			continue
+		}
+		hostKey, err := trustMachineHostKey(s, request.MachineReqStruct{
+			SshHost:       m.SshHost,
+			SshPort:       m.SshPort,
+			ProxyHost:     m.ProxyHost,
+			ProxyPort:     m.ProxyPort,
+			ProxyUser:     m.ProxyUser,
+			ProxyPassword: m.ProxyPassword,
+			ProxyKeyFile:  m.ProxyKeyFile,
+		})
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s:%d: %v", m.SshHost, m.SshPort, err))
+			continue
+		}
+		dmgrutil.Logger.Warn("BackfillHostKey",
+			zap.String("host", hostKey.SshHost),
+			zap.Uint64("port", hostKey.SshPort),
+			zap.String("fingerprint", hostKey.Fingerprint))
+		hostKeys = append(hostKeys, hostKey)
+	}
+	if len(failed) > 0 {
+		response.FailWithMsg(c, fmt.Errorf("backfill host key failed: %s", strings.Join(failed, "; ")))
+		return
+	}
+	response.SuccessWithData(c, hostKeys)
+}
+
+// 重新信任主机公钥，用于机器或跳板机重装后更新已记录的主机公钥
+func TrustMachineHostKey(c *gin.Context) {
+	var req request.HostKeyTrustReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
+		return
+	}
+
+	s := service.NewMysqlService()
+	// 机器配置跳板机时通过跳板机获取主机公钥，非机器（如跳板机）直接获取
+	machine, err := s.GetMachine(req.SshHost, req.SshPort)
+	if err != nil && err != sql.ErrNoRows {
+		response.FailWithMsg(c, err)
+		return
+	}
+	oldKey, err := s.GetHostKey(req.SshHost, req.SshPort)
+	if err != nil && err != sql.ErrNoRows {
+		response.FailWithMsg(c, err)
+		return
+	}
+
+	newKey, err := trustHostKey(s, req.SshHost, req.SshPort, machine.SSHProxy(), true)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	dmgrutil.Logger.Warn("TrustHostKey",
+		zap.String("host", req.SshHost),
+		zap.Uint64("port", req.SshPort),
+		zap.String("old fingerprint", oldKey.Fingerprint),
+		zap.String("new fingerprint", newKey.Fingerprint))
+	response.SuccessWithData(c, newKey)
+}
+
+// 获取并记录主机公钥
+// replace 为 false 时已信任的主机公钥保持不变，为 true 时覆盖已信任的主机公钥
+func trustHostKey(s *service.MysqlService, host string, port uint64, proxy *executor.SSHProxyConfig, replace bool) (response.HostKeyRespStruct, error) {
+	if !replace {
+		hostKey, err := s.GetHostKey(host, port)
+		if err == nil {
+			return hostKey, nil
+		}
+		if err != sql.ErrNoRows {
+			return hostKey, err
+		}
+	}
+
+	addr := net.JoinHostPort(host, strconv.FormatUint(port, 10))
+	key, err := executor.ScanHostKey(addr, proxy, time.Duration(executor.DefaultConnectTimeout)*time.Second)
+	if err != nil {
+		return response.HostKeyRespStruct{}, fmt.Errorf("get host key of %s failed: %v", addr, err)
+	}
+	hostKey := response.HostKeyRespStruct{
+		SshHost:     host,
+		SshPort:     port,
+		KeyType:     key.Type(),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+		UpdateTime:  time.Now(),
+	}
+	if replace {
+		err = s.ReplaceHostKey(hostKey)
+	} else {
+		err = s.AddHostKey(hostKey)
+	}
+	return hostKey, err
+}
+
+// 刷新机器主机信息，通过 SSH 采集并记录
+func RefreshMachineFacts(c *gin.Context) {
+	var req request.MachineFactsRefreshReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
+		return
+	}
+
+	s := service.NewMysqlService()
+	machine, err := s.GetMachine(req.SshHost, req.SshPort)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("machine [%s:%d] not exist, please add machine first", req.SshHost, req.SshPort)
+	}
+	if response.FailWithMsg(c, err) {
+		return
+	}
+
+	facts, err := gatherMachineFacts(c.Request.Context(), machine)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	if response.FailWithMsg(c, s.ReplaceMachineFacts(facts)) {
+		return
+	}
+	response.SuccessWithData(c, facts)
+}
+
+// 查询已采集的机器主机信息
+func MachineFactsList(c *gin.Context) {
+	var req request.MachineFactsReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
+		return
+	}
+
+	var hosts []string
+	if req.SshHost != "" {
+		hosts = append(hosts, req.SshHost)
+	}
+	factsList, err := service.NewMysqlService().GetMachineFactsList(hosts)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	response.SuccessWithData(c, factsList)
+}
+
+// 通过 SSH 采集机器主机信息
+func gatherMachineFacts(ctx context.Context, machine response.MachineRespStruct) (response.MachineFactsRespStruct, error) {
+	exec, closeExec, err := machineExecutor(machine)
+	if err != nil {
+		return response.MachineFactsRespStruct{}, err
+	}
+	defer closeExec()
+
+	hostFacts, err := module.NewFactsModule().Execute(ctx, exec)
+	if err != nil {
+		return response.MachineFactsRespStruct{}, fmt.Errorf("gather machine [%s:%d] facts failed: %v", machine.SshHost, machine.SshPort, err)
+	}
+	return response.MachineFactsRespStruct{
+		SshHost:    machine.SshHost,
+		SshPort:    machine.SshPort,
+		HostFacts:  hostFacts,
+		UpdateTime: time.Now(),
+	}, nil
+}
+
+// 机器执行器，配置跳板机时通过跳板机连接，dmgr 所在本机使用本地执行器，使用完毕需调用返回的关闭函数
+func machineExecutor(machine response.MachineRespStruct) (executor.Executor, func(), error) {
+	if executor.IsLocalHost(machine.SshHost) {
+		current, err := user.Current()
+		if err != nil {
+			return nil, nil, err
+		}
+		return executor.NewLocalExecutor(machine.SshHost, current.Username, false), func() {}, nil
+	}
+
+	exec, err := executor.NewSSHExecutor(false, executor.SSHConfig{
+		Host:         machine.SshHost,
+		Port:         int(machine.SshPort),
+		User:         machine.SshUser,
+		Password:     machine.SshPassword,
+		Proxy:        machine.SSHProxy(),
+		Fingerprint:  machine.Fingerprint,
+		SudoPassword: machine.SudoPassword,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return exec, func() {
+		if closer, ok := exec.(io.Closer); ok {
+			closer.Close()
+		}
+	}, nil
+}
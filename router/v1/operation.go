@@ -0,0 +1,412 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/cluster/event"
+	"github.com/wentaojin/dmgr/pkg/cluster/executor"
+	"github.com/wentaojin/dmgr/pkg/cluster/operation"
+	"github.com/wentaojin/dmgr/pkg/cluster/task"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"github.com/wentaojin/dmgr/request"
+	"github.com/wentaojin/dmgr/response"
+	"github.com/wentaojin/dmgr/service"
+	"go.uber.org/zap"
+)
+
+// 集群操作状态查询
+func OperationStatus(c *gin.Context) {
+	var req request.OperationReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
+		return
+	}
+
+	s := service.NewMysqlService()
+	resp, err := s.GetOperation(req.OperationID)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	response.SuccessWithData(c, resp)
+}
+
+// 集群操作远程命令执行记录查询
+func OperationCommands(c *gin.Context) {
+	var req request.OperationCommandReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
+		return
+	}
+
+	s := service.NewMysqlService()
+	resp, err := s.GetOperationCommands(req)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	response.SuccessWithData(c, resp)
+}
+
+// 集群操作列表查询
+func OperationList(c *gin.Context) {
+	var req request.OperationListReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
+		return
+	}
+
+	s := service.NewMysqlService()
+	resp, err := s.GetOperationList(req)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	response.SuccessWithData(c, resp)
+}
+
+// 取消集群操作
+// 1、排队中的集群操作不再运行
+// 2、运行中的集群操作不再运行新的步骤，并终止正在运行的远程命令以及文件传输
+func OperationCancel(c *gin.Context) {
+	var req request.OperationReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
+		return
+	}
+
+	s := service.NewMysqlService()
+	op, err := s.GetOperation(req.OperationID)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	if op.OperationStatus != dmgrutil.OperationQueuedStatus && op.OperationStatus != dmgrutil.OperationRunningStatus {
+		if response.FailWithMsg(c, fmt.Errorf("operation [%d] already finished, status [%s]", op.OperationID, op.OperationStatus)) {
+			return
+		}
+	}
+	if !operation.Cancel(op.OperationID) {
+		if response.FailWithMsg(c, fmt.Errorf("operation [%d] isn't running", op.OperationID)) {
+			return
+		}
+	}
+	dmgrutil.Logger.Warn("Operation", zap.Uint64("id", op.OperationID), zap.String("msg", "operation cancel requested"))
+	response.SuccessWithoutData(c)
+}
+
+// 集群操作运行事件推送 Server-Sent Events
+// 1、回放已产生的运行事件
+// 2、持续推送后续运行事件，直至集群操作结束或客户端断开
+func OperationEvents(c *gin.Context) {
+	var req request.OperationReqStruct
+	if response.FailWithMsg(c, c.ShouldBindQuery(&req)) {
+		return
+	}
+
+	s := service.NewMysqlService()
+	op, err := s.GetOperation(req.OperationID)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+
+	history, events, cancel := event.Subscribe(req.OperationID)
+	defer cancel()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	for _, ev := range history {
+		c.SSEvent(ev.Type, ev)
+	}
+
+	// 事件流不存在（已清理或程序重启）或已结束，推送集群操作最终状态
+	if events == nil {
+		if len(history) == 0 {
+			c.SSEvent(event.OperationFinish, event.Event{
+				OperationID: op.OperationID,
+				Type:        event.OperationFinish,
+				Status:      op.OperationStatus,
+				Error:       op.ErrorMsg,
+				Time:        time.Now(),
+			})
+		}
+		c.Writer.Flush()
+		return
+	}
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(ev.Type, ev)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// 集群操作异步提交
+// 1、获取集群排他锁，集群已有其他操作运行时立即返回错误
+// 2、记录集群操作，状态 queued
+// 3、提交后台工作池运行，立即返回操作 ID
+// 返回集群操作是否已记录，未记录的集群操作不会运行，调用方据此清理上传文件等
+func SubmitClusterOperation(c *gin.Context, s *service.MysqlService, clusterName, operationType string, fn func(ctx *ctxt.Context) error) bool {
+	return submitClusterOperation(c, s, clusterName, operationType, "", fn)
+}
+
+// 可断点续做的集群操作异步提交，记录操作请求参数用于断点续做
+func SubmitResumableClusterOperation(c *gin.Context, s *service.MysqlService, clusterName, operationType string, req interface{}, fn func(ctx *ctxt.Context) error) bool {
+	requestBody, err := json.Marshal(req)
+	if response.FailWithMsg(c, err) {
+		return false
+	}
+	return submitClusterOperation(c, s, clusterName, operationType, string(requestBody), fn)
+}
+
+func submitClusterOperation(c *gin.Context, s *service.MysqlService, clusterName, operationType, requestBody string, fn func(ctx *ctxt.Context) error) bool {
+	lock, err := s.AcquireClusterLock(clusterName, GetCurrentUser(c).Username, operationType, operation.LockTTL())
+	if response.FailWithMsg(c, err) {
+		return false
+	}
+	operationID, err := s.AddOperation(clusterName, operationType, requestBody)
+	if err != nil {
+		releaseClusterLock(s, lock)
+		response.FailWithMsg(c, err)
+		return false
+	}
+	enqueueClusterOperation(c, s, operationID, lock, fn)
+	return true
+}
+
+// 集群操作断点续做
+// 1、仅支持失败或取消的升级、补丁集群操作
+// 2、根据记录的操作请求参数重新生成任务，跳过已完成的步骤，从第一个未完成的步骤继续运行
+func OperationResume(c *gin.Context) {
+	var req request.OperationReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
+		return
+	}
+
+	s := service.NewMysqlService()
+	op, err := s.GetOperation(req.OperationID)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	if op.OperationStatus != dmgrutil.OperationFailedStatus && op.OperationStatus != dmgrutil.OperationCanceledStatus {
+		if response.FailWithMsg(c, fmt.Errorf("operation [%d] status [%s] can't resume, only support failed or canceled operation", op.OperationID, op.OperationStatus)) {
+			return
+		}
+	}
+	requestBody, err := s.GetOperationRequest(op.OperationID)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+
+	var fn func(ctx *ctxt.Context) error
+	switch op.OperationType {
+	case dmgrutil.OperationUpgrade:
+		var upgradeReq request.ClusterUpgradeReqStruct
+		if response.FailWithMsg(c, json.Unmarshal([]byte(requestBody), &upgradeReq)) {
+			return
+		}
+		fn, err = newClusterUpgradeOperation(s, upgradeReq)
+	case dmgrutil.OperationPatch:
+		var params clusterPatchParams
+		if response.FailWithMsg(c, json.Unmarshal([]byte(requestBody), &params)) {
+			return
+		}
+		// 补丁包与首次提交时不一致时不允许断点续做
+		if err = params.verifyPackage(); err == nil {
+			fn = newClusterPatchOperation(s, params)
+		}
+	default:
+		err = fmt.Errorf("operation [%d] type [%s] not support resume", op.OperationID, op.OperationType)
+	}
+	if response.FailWithMsg(c, err) {
+		return
+	}
+
+	lock, err := s.AcquireClusterLock(op.ClusterName, GetCurrentUser(c).Username, op.OperationType, operation.LockTTL())
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	if err := s.ResumeOperation(op.OperationID); err != nil {
+		releaseClusterLock(s, lock)
+		if response.FailWithMsg(c, err) {
+			return
+		}
+	}
+	enqueueClusterOperation(c, s, op.OperationID, lock, fn)
+}
+
+// 集群操作 dry run
+// 生成与实际运行相同的任务，只返回运行计划，不运行任何任务，也不记录集群操作
+func PlanClusterOperation(c *gin.Context, clusterName, operationType string, fn func(ctx *ctxt.Context) error) {
+	ctx, planner := task.NewDryRunContext()
+	if response.FailWithMsg(c, fn(ctx)) {
+		return
+	}
+	response.SuccessWithData(c, response.OperationPlanRespStruct{
+		ClusterName:   clusterName,
+		OperationType: operationType,
+		Plan:          planner.Plans(),
+	})
+}
+
+// 集群操作提交后台工作池运行，立即返回操作 ID
+func enqueueClusterOperation(c *gin.Context, s *service.MysqlService, operationID uint64, lock service.ClusterLock, fn func(ctx *ctxt.Context) error) {
+	if err := s.SetClusterLockOperation(lock, operationID); err != nil {
+		dmgrutil.Logger.Error("Operation", zap.Uint64("id", operationID), zap.Error(err))
+	}
+
+	event.Open(operationID)
+	opCtx := operation.Register(operationID)
+	if err := operation.Submit(func() {
+		runClusterOperation(opCtx, s, operationID, lock, fn)
+	}); err != nil {
+		operation.Unregister(operationID)
+		releaseClusterLock(s, lock)
+		if errFinish := s.FinishOperation(operationID, dmgrutil.OperationFailedStatus, err.Error()); errFinish != nil {
+			dmgrutil.Logger.Error("Operation", zap.Uint64("id", operationID), zap.Error(errFinish))
+		}
+		event.Close(operationID)
+		if response.FailWithMsg(c, err) {
+			return
+		}
+	}
+
+	response.SuccessWithData(c, response.OperationIDRespStruct{OperationID: operationID})
+}
+
+// 后台运行集群操作，并记录运行状态
+// 1、排队期间已取消的集群操作不再运行
+// 2、运行超过整体超时时间或被取消时，停止运行新的步骤并终止正在运行的远程命令
+// 3、运行结束释放集群锁，排队期间集群锁已丢失（过期被其他操作获取或被强制释放）不再运行
+func runClusterOperation(opCtx context.Context, s *service.MysqlService, operationID uint64, lock service.ClusterLock, fn func(ctx *ctxt.Context) error) {
+	defer event.Close(operationID)
+	defer operation.Unregister(operationID)
+	defer releaseClusterLock(s, lock)
+
+	if opCtx.Err() != nil {
+		finishClusterOperation(s, ctxt.NewOperationContext(opCtx, operationID), dmgrutil.OperationCanceledStatus, "operation canceled before running")
+		return
+	}
+	if err := s.RenewClusterLock(lock, operation.LockTTL()); err != nil {
+		finishClusterOperation(s, ctxt.NewOperationContext(opCtx, operationID), dmgrutil.OperationFailedStatus, err.Error())
+		return
+	}
+
+	if err := s.StartOperation(operationID); err != nil {
+		dmgrutil.Logger.Error("Operation", zap.Uint64("id", operationID), zap.Error(err))
+	}
+	deadlineCtx, cancel := operation.WithDeadline(opCtx)
+	defer cancel()
+	ctx := ctxt.NewOperationContext(deadlineCtx, operationID)
+	defer ctx.Close()
+	ctx.Emit(event.Event{Type: event.OperationStart, Status: dmgrutil.OperationRunningStatus})
+
+	// 步骤检查点，断点续做时跳过已完成的步骤
+	stepKeys, err := s.GetOperationSteps(operationID)
+	if err != nil {
+		finishClusterOperation(s, ctx, dmgrutil.OperationFailedStatus, fmt.Sprintf("get operation steps failed: %v", err))
+		return
+	}
+	ctx.SetCheckpoint(stepKeys, func(stepKey, stepName string) error {
+		return s.AddOperationStep(operationID, stepKey, stepName)
+	})
+	// 步骤重试记录，用于集群操作结果查询
+	ctx.SetRetryRecord(func(msg string) error {
+		return s.AddOperationRetry(operationID, msg)
+	})
+	// 远程命令执行记录，用于排查集群操作失败原因
+	ctx.SetCommandRecord(func(rec ctxt.CommandRecord) error {
+		return s.AddOperationCommand(operationID, rec)
+	})
+	if err := setSSHHosts(s, ctx); err != nil {
+		finishClusterOperation(s, ctx, dmgrutil.OperationFailedStatus, err.Error())
+		return
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("operation panic: %v", r)
+			}
+		}()
+		err = fn(ctx)
+	}()
+	ctx.Cleanup()
+
+	status, errMsg := dmgrutil.OperationSucceededStatus, ""
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Err(), context.Canceled):
+		status, errMsg = dmgrutil.OperationCanceledStatus, fmt.Sprintf("operation canceled: %v", err)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		status, errMsg = dmgrutil.OperationFailedStatus, fmt.Sprintf("operation deadline exceeded: %v", err)
+	default:
+		status, errMsg = dmgrutil.OperationFailedStatus, err.Error()
+	}
+	finishClusterOperation(s, ctx, status, errMsg)
+}
+
+// 设置 SSH 跳板机以及已信任的主机公钥
+// 1、分段网络中的主机通过跳板机连接
+// 2、SSH 连接时校验主机公钥，未信任或不一致的主机拒绝连接
+func setSSHHosts(s *service.MysqlService, ctx *ctxt.Context) error {
+	proxyMachines, err := s.GetProxyMachineList()
+	if err != nil {
+		return fmt.Errorf("get machine ssh proxy failed: %v", err)
+	}
+	ctx.SSHProxies = make(map[string]*executor.SSHProxyConfig, len(proxyMachines))
+	for i := range proxyMachines {
+		ctx.SSHProxies[proxyMachines[i].SshHost] = proxyMachines[i].SSHProxy()
+		ctx.AddSecrets(proxyMachines[i].ProxyPassword)
+	}
+
+	hostKeys, err := s.GetHostKeyList()
+	if err != nil {
+		return fmt.Errorf("get machine host key failed: %v", err)
+	}
+	ctx.SSHHostKeys = make(map[string]string, len(hostKeys))
+	for _, k := range hostKeys {
+		ctx.SSHHostKeys[net.JoinHostPort(k.SshHost, strconv.FormatUint(k.SshPort, 10))] = k.Fingerprint
+	}
+	return nil
+}
+
+// 记录集群操作结束状态，并推送结束事件
+func finishClusterOperation(s *service.MysqlService, ctx *ctxt.Context, status, errMsg string) {
+	if errMsg != "" {
+		dmgrutil.Logger.Error("Operation", zap.Uint64("id", ctx.OperationID), zap.String("status", status), zap.String("error", errMsg))
+	} else {
+		dmgrutil.Logger.Info("Operation", zap.Uint64("id", ctx.OperationID), zap.String("status", status))
+	}
+
+	if err := s.FinishOperation(ctx.OperationID, status, errMsg); err != nil {
+		dmgrutil.Logger.Error("Operation", zap.Uint64("id", ctx.OperationID), zap.Error(err))
+	}
+	ctx.Emit(event.Event{Type: event.OperationFinish, Status: status, Error: errMsg})
+}
@@ -18,6 +18,7 @@ package v1
 import (
 	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -44,6 +45,7 @@ import (
 	"github.com/wentaojin/dmgr/request"
 	"github.com/wentaojin/dmgr/response"
 	"github.com/wentaojin/dmgr/service"
+	"go.uber.org/zap"
 )
 
 // 集群部署
@@ -96,20 +98,6 @@ func ClusterDeploy(c *gin.Context) {
 		}
 	}
 
-	// 解压离线镜像包到指定目录
-	// {cluster_path}/cluster/{cluster_name}/{cluster_version}
-	clusterNameDir := dmgrutil.AbsClusterUntarDir(topo.ClusterPath, topo.ClusterName)
-	clusterUntarDir := filepath.Join(clusterNameDir, topo.ClusterVersion)
-
-	if response.FailWithMsg(c, dmgrutil.UnCompressTarGz(filepath.Join(pkg.PackagePath, pkg.PackageName), clusterUntarDir)) {
-		return
-	}
-
-	// 初始化组件配置文件、脚本等文件缓存目录以及 SSH 认证存放目录
-	if response.FailWithMsg(c, dmgrutil.InitComponentCacheAndSSHDir(topo.ClusterPath, topo.ClusterName)) {
-		return
-	}
-
 	// 集群拓扑查询生成
 	// 1、根据拓扑中主机信息，获取主机 SSH 信息
 	// 2、判断是否存在主机信息，存在则重新生成集群拓扑
@@ -122,56 +110,150 @@ func ClusterDeploy(c *gin.Context) {
 			return
 		}
 	}
-	clusterTopo, err := GenerateClusterTopology(req.ClusterMetaReqStruct, req.ClusterTopology, machineList)
-	if response.FailWithMsg(c, err) {
-		return
-	}
 
-	// 集群部署
-	// 集群环境初始化以及集群组件复制 COPY
-	envInitTasks := EnvClusterUserInit(machineList, topo.ClusterUser, topo.SkipCreateUser)
-	copyCompTasks := EnvClusterComponentInit(clusterTopo, clusterUntarDir)
+	fn := func(ctx *ctxt.Context) error {
+		// 持有集群锁后再次判断集群名是否冲突，避免同名集群并发部署
+		exist, err := s.ValidClusterNameIsExist(topo.ClusterName)
+		if err != nil {
+			return err
+		}
+		if exist {
+			return fmt.Errorf("cluster deploy failed: cluster_name [%v] exist", topo.ClusterName)
+		}
+
+		// 解压离线镜像包到指定目录
+		// {cluster_path}/cluster/{cluster_name}/{cluster_version}
+		clusterNameDir := dmgrutil.AbsClusterUntarDir(topo.ClusterPath, topo.ClusterName)
+		clusterUntarDir := filepath.Join(clusterNameDir, topo.ClusterVersion)
+
+		clusterTopo, err := GenerateClusterTopology(req.ClusterMetaReqStruct, req.ClusterTopology, machineList)
+		if err != nil {
+			return err
+		}
+
+		// 集群部署
+		// 集群环境初始化以及集群组件复制 COPY
+		envInitTasks := EnvClusterUserInit(machineList, topo.ClusterUser, topo.SkipCreateUser)
+		copyCompTasks := EnvClusterComponentInit(clusterTopo, clusterUntarDir)
+		copyFileTasks := CopyClusterFile(clusterTopo)
 
-	// 获取生成集群部署配置文件、运行脚本等文件信息
-	cos := template.GetClusterFile(clusterTopo)
+		builder := task.NewBuilder().
+			Func("Uncompress offline package", func(ctx *ctxt.Context) error {
+				if err := dmgrutil.UnCompressTarGz(filepath.Join(pkg.PackagePath, pkg.PackageName), clusterUntarDir); err != nil {
+					return err
+				}
+				// 记录离线镜像包所有文件 SHA-256，组件分发后校验
+				if err := dmgrutil.GenerateChecksumFile(clusterUntarDir); err != nil {
+					return err
+				}
+				// 初始化组件配置文件、脚本等文件缓存目录以及 SSH 认证存放目录
+				return dmgrutil.InitComponentCacheAndSSHDir(topo.ClusterPath, topo.ClusterName)
+			}).
+			// 生成组件配置文件、运行脚本
+			Func("Generate cluster files", func(ctx *ctxt.Context) error {
+				return generateClusterFile(ctx,
+					clusterTopo,
+					template.GetClusterFile(clusterTopo),
+					template.ClusterDeployStage,
+					topo.AdminUser,
+					topo.AdminPassword)
+			}).
+			// 集群开启 TLS 时生成集群 CA 以及实例证书
+			Func("Generate TLS certificates", func(ctx *ctxt.Context) error {
+				return GenerateClusterCert(clusterTopo)
+			}).
+			Serial("+ Generate SSH keys",
+				task.NewBuilder().
+					SSHKeyGen(dmgrutil.HomeSshDir, executor.DefaultExecuteTimeout).
+					SSHKeyCopy(dmgrutil.HomeSshDir, dmgrutil.AbsClusterSSHDir(topo.ClusterPath, topo.ClusterName), machineList, executor.DefaultExecuteTimeout, dmgrutil.RsaConcurrency).BuildTask()).
+			Parallel("+ Initialize target host environments", false, envInitTasks...).
+			Parallel("+ Copy components", false, copyCompTasks...).
+			Parallel("+ Copy files", false, copyFileTasks...).
+			// 集群元数据以及集群拓扑更新
+			// TODO: 清理缓存目录
+			Func("Record cluster metadata", func(ctx *ctxt.Context) error {
+				return s.AddClusterMetaAndTopology(topo.ClusterMetaReqStruct, topo.ClusterTopology)
+			}).
+			RollbackOnFailure().BuildTask()
+
+		// 部署失败，逆序回滚已运行的任务
+		return builder.Execute(ctx)
+	}
+
+	if req.DryRun {
+		PlanClusterOperation(c, topo.ClusterName, dmgrutil.OperationDeploy, fn)
+		return
+	}
+	SubmitClusterOperation(c, s, topo.ClusterName, dmgrutil.OperationDeploy, fn)
+}
 
-	// 生成以及 Copy 组件配置文件、运行脚本
-	if response.FailWithMsg(c,
-		template.GenerateClusterFileWithStage(
-			clusterTopo,
-			cos,
-			template.ClusterDeployStage,
-			topo.AdminUser,
-			topo.AdminPassword)) {
+// 集群启动
+func ClusterStart(c *gin.Context) {
+	var req request.ClusterOperatorReqStruct
+	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
 		return
 	}
-	copyFileTasks := CopyClusterFile(clusterTopo)
-
-	builder := task.NewBuilder().
-		Serial("+ Generate SSH keys",
-			task.NewBuilder().
-				SSHKeyGen(dmgrutil.HomeSshDir, executor.DefaultExecuteTimeout).
-				SSHKeyCopy(dmgrutil.HomeSshDir, dmgrutil.AbsClusterSSHDir(topo.ClusterPath, topo.ClusterName), machineList, executor.DefaultExecuteTimeout, dmgrutil.RsaConcurrency).BuildTask()).
-		Parallel("+ Initialize target host environments", false, envInitTasks...).
-		Parallel("+ Copy components", false, copyCompTasks...).
-		Parallel("+ Copy files", false, copyFileTasks...).BuildTask()
 
-	if response.FailWithMsg(c, builder.Execute(ctxt.NewContext())) {
+	// 判断指定实例名是否在指定组件中 [组件操作以实例名为准，实例名全局唯一]
+	s := service.NewMysqlService()
+	instNames, err := s.FilterComponentInstance(req)
+	if response.FailWithMsg(c, err) {
 		return
 	}
 
-	// 集群元数据以及集群拓扑更新
-	if response.FailWithMsg(c, s.AddClusterMetaAndTopology(topo.ClusterMetaReqStruct, topo.ClusterTopology)) {
+	// 根据集群名、实例名查询集群拓扑
+	clusterTopos, err := s.GetClusterTopologyByInstanceName(req.ClusterName, instNames)
+	if response.FailWithMsg(c, err) {
 		return
 	}
 
-	// TODO: 清理缓存目录
+	fn := func(ctx *ctxt.Context) error {
+		// 按组件启动顺序启动
+		for _, component := range dmgrutil.StartComponentOrder {
+			for _, t := range clusterTopos {
+				compName := strings.ToLower(t.ComponentName)
+				if component == compName {
+					startCompTask := task.NewBuilder().
+						SSHKeySet(
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
+						UserSSH(
+							t.MachineHost,
+							t.SshPort,
+							t.ClusterUser,
+							executor.DefaultConnectTimeout,
+							module.DefaultSystemdExecuteTimeout).
+						StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
+							fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
+							module.DefaultSystemdExecuteTimeout).WithRetry(task.DefaultRetryPolicy()).
+						EnableInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
+							fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
+							module.DefaultSystemdExecuteTimeout, true).BuildTask()
+
+					if err := startCompTask.Execute(ctx); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		// 更新集群状态
+		return task.NewBuilder().Func("Update cluster status", func(ctx *ctxt.Context) error {
+			return s.UpdateClusterMetaStatus(req.ClusterName, dmgrutil.ClusterUpStatus)
+		}).BuildTask().Execute(ctx)
+	}
 
-	response.SuccessWithoutData(c)
+	if req.DryRun {
+		PlanClusterOperation(c, req.ClusterName, dmgrutil.OperationStart, fn)
+		return
+	}
+	SubmitClusterOperation(c, s, req.ClusterName, dmgrutil.OperationStart, fn)
 }
 
-// 集群启动
-func ClusterStart(c *gin.Context) {
+// 集群停止
+func ClusterStop(c *gin.Context) {
 	var req request.ClusterOperatorReqStruct
 	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
 		return
@@ -190,46 +272,63 @@ func ClusterStart(c *gin.Context) {
 		return
 	}
 
-	// 按组件启动顺序启动
-	for _, component := range dmgrutil.StartComponentOrder {
-		for _, t := range clusterTopos {
-			compName := strings.ToLower(t.ComponentName)
-			if component == compName {
-				startCompTask := task.NewBuilder().
-					SSHKeySet(
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
-					UserSSH(
-						t.MachineHost,
-						t.SshPort,
-						t.ClusterUser,
-						executor.DefaultConnectTimeout,
-						module.DefaultSystemdExecuteTimeout).
-					StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
-						module.DefaultSystemdExecuteTimeout).
-					EnableInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
+	fn := func(ctx *ctxt.Context) error {
+		dmMasterAddr, err := getDmMasterAddrs(s, req.ClusterName)
+		if err != nil {
+			return err
+		}
+		tlsConfig, err := getClusterTLSConfig(s, req.ClusterName)
+		if err != nil {
+			return err
+		}
+		stopWorkers := dmWorkerInstances(clusterTopos)
+
+		// 按组件停止顺序停止
+		for _, component := range dmgrutil.StopComponentOrder {
+			for _, t := range clusterTopos {
+				compName := strings.ToLower(t.ComponentName)
+				if component == compName {
+					stopCompTask := task.NewBuilder().
+						SSHKeySet(
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
+						UserSSH(
+							t.MachineHost,
+							t.SshPort,
+							t.ClusterUser,
+							executor.DefaultConnectTimeout,
+							module.DefaultSystemdExecuteTimeout)
+					// 停止 dm-worker 前迁移绑定的数据源
+					if compName == dmgrutil.ComponentDmWorker {
+						stopCompTask = stopCompTask.DrainWorker(dmMasterAddr, tlsConfig, t.InstanceName, stopWorkers, module.DefaultSystemdExecuteTimeout)
+					}
+					stopCompTask = stopCompTask.StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
 						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
-						module.DefaultSystemdExecuteTimeout, true).BuildTask()
+						module.DefaultSystemdExecuteTimeout)
 
-				if response.FailWithMsg(c, startCompTask.Execute(ctxt.NewContext())) {
-					return
+					if err := stopCompTask.BuildTask().Execute(ctx); err != nil {
+						return err
+					}
 				}
 			}
 		}
+		// 更新集群状态
+		return task.NewBuilder().Func("Update cluster status", func(ctx *ctxt.Context) error {
+			return s.UpdateClusterMetaStatus(req.ClusterName, dmgrutil.ClusterOfflineStatus)
+		}).BuildTask().Execute(ctx)
 	}
 
-	// 更新集群状态
-	if response.FailWithMsg(c, s.UpdateClusterMetaStatus(req.ClusterName, dmgrutil.ClusterUpStatus)) {
+	if req.DryRun {
+		PlanClusterOperation(c, req.ClusterName, dmgrutil.OperationStop, fn)
 		return
 	}
-	response.SuccessWithoutData(c)
+	SubmitClusterOperation(c, s, req.ClusterName, dmgrutil.OperationStop, fn)
 }
 
-// 集群停止
-func ClusterStop(c *gin.Context) {
+// 集群滚动重启
+func ClusterRestart(c *gin.Context) {
 	var req request.ClusterOperatorReqStruct
 	if response.FailWithMsg(c, c.ShouldBindJSON(&req)) {
 		return
@@ -248,38 +347,33 @@ func ClusterStop(c *gin.Context) {
 		return
 	}
 
-	// 按组件停止顺序停止
-	for _, component := range dmgrutil.StopComponentOrder {
-		for _, t := range clusterTopos {
-			compName := strings.ToLower(t.ComponentName)
-			if component == compName {
-				startCompTask := task.NewBuilder().
-					SSHKeySet(
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
-					UserSSH(
-						t.MachineHost,
-						t.SshPort,
-						t.ClusterUser,
-						executor.DefaultConnectTimeout,
-						module.DefaultSystemdExecuteTimeout).
-					StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
-						module.DefaultSystemdExecuteTimeout).BuildTask()
-
-				if response.FailWithMsg(c, startCompTask.Execute(ctxt.NewContext())) {
-					return
-				}
+	fn := func(ctx *ctxt.Context) error {
+		dmMasterAddr, err := getDmMasterAddrs(s, req.ClusterName)
+		if err != nil {
+			return err
+		}
+		tlsConfig, err := getClusterTLSConfig(s, req.ClusterName)
+		if err != nil {
+			return err
+		}
+		// 逐个实例重启，dm-master 先重启 follower，驱逐 leader 后最后重启原 leader
+		for _, t := range RollingRestartOrder(clusterTopos, dmMasterAddr, tlsConfig) {
+			if err := RollingRestartInstance(t, dmMasterAddr, tlsConfig, nil).BuildTask().Execute(ctx); err != nil {
+				return err
 			}
 		}
+
+		// 更新集群状态
+		return task.NewBuilder().Func("Update cluster status", func(ctx *ctxt.Context) error {
+			return s.UpdateClusterMetaStatus(req.ClusterName, dmgrutil.ClusterUpStatus)
+		}).BuildTask().Execute(ctx)
 	}
-	// 更新集群状态
-	if response.FailWithMsg(c, s.UpdateClusterMetaStatus(req.ClusterName, dmgrutil.ClusterOfflineStatus)) {
+
+	if req.DryRun {
+		PlanClusterOperation(c, req.ClusterName, dmgrutil.OperationRestart, fn)
 		return
 	}
-	response.SuccessWithoutData(c)
+	SubmitClusterOperation(c, s, req.ClusterName, dmgrutil.OperationRestart, fn)
 }
 
 // 集群扩容
@@ -361,84 +455,127 @@ func ClusterScaleOut(c *gin.Context) {
 		return
 	}
 
-	// 集群环境初始化以及集群组件复制 COPY
-	envInitTasks := EnvClusterUserInit(machineList, clusterMeta.ClusterUser, topo.SkipCreateUser)
-	copyCompTasks := EnvClusterComponentInit(clusterTopo, clusterUntarDir)
+	fn := func(ctx *ctxt.Context) error {
+		// 集群环境初始化以及集群组件复制 COPY
+		envInitTasks := EnvClusterUserInit(machineList, clusterMeta.ClusterUser, topo.SkipCreateUser)
+		copyCompTasks := EnvClusterComponentInit(clusterTopo, clusterUntarDir)
 
-	// 获取生成集群部署配置文件、运行脚本等文件信息【根据元数据库已有集群组件信息】
-	cos := template.GetClusterFile(topoDB)
+		// 获取生成集群部署配置文件、运行脚本等文件信息【根据元数据库已有集群组件信息】
+		cos := template.GetClusterFile(topoDB)
 
-	// 生成以及 Copy 组件配置文件、运行脚本
-	// 1、重新生成以及分发集群已存在的组件配置文件、运行脚本
-	// 2、生成以及分发扩容组件配置文件、运行脚本
-	switch strings.ToLower(topo.ComponentName) {
-	case dmgrutil.ComponentDmMaster:
-		cos.DmMasterAddrs = append(cos.DmMasterAddrs, fmt.Sprintf("%s:%v", topo.MachineHost, topo.ServicePort))
-	case dmgrutil.ComponentDmWorker:
-		cos.DmWorkerAddrs = append(cos.DmWorkerAddrs, fmt.Sprintf("%s:%v", topo.MachineHost, topo.ServicePort))
-	case dmgrutil.ComponentGrafana:
-		cos.GrafanaAddr = fmt.Sprintf("%s:%v", topo.MachineHost, topo.ServicePort)
-	case dmgrutil.ComponentAlertmanager:
-		cos.AlertmanagerAddrs = append(cos.AlertmanagerAddrs, fmt.Sprintf("%s:%v", topo.MachineHost, topo.ServicePort))
-		cos.AlertmanagerScripts = append(cos.AlertmanagerScripts, &script.AlertManagerScript{
-			IP:          topo.MachineHost,
-			WebPort:     topo.ServicePort,
-			ClusterPort: topo.ClusterPort,
-			DeployDir:   dmgrutil.AbsClusterDeployDir(topo.DeployDir, topo.InstanceName),
-			DataDir:     dmgrutil.AbsClusterDataDir(topo.DeployDir, topo.DataDir, topo.InstanceName),
-			LogDir:      dmgrutil.AbsClusterLogDir(topo.DeployDir, topo.LogDir, topo.InstanceName),
-			TLSEnabled:  false,
-		})
-	case dmgrutil.ComponentPrometheus:
-		cos.PrometheusAddr = fmt.Sprintf("%s:%v", topo.MachineHost, topo.ServicePort)
-	default:
-		if response.FailWithMsg(c, fmt.Errorf("component [%v] not exist, panic", topo.ComponentName)) {
-			return
+		// 生成以及 Copy 组件配置文件、运行脚本
+		// 1、重新生成以及分发集群已存在的组件配置文件、运行脚本
+		// 2、生成以及分发扩容组件配置文件、运行脚本
+		switch strings.ToLower(topo.ComponentName) {
+		case dmgrutil.ComponentDmMaster:
+			cos.DmMasterAddrs = append(cos.DmMasterAddrs, fmt.Sprintf("%s:%v", topo.MachineHost, topo.ServicePort))
+		case dmgrutil.ComponentDmWorker:
+			cos.DmWorkerAddrs = append(cos.DmWorkerAddrs, fmt.Sprintf("%s:%v", topo.MachineHost, topo.ServicePort))
+		case dmgrutil.ComponentGrafana:
+			cos.GrafanaAddr = fmt.Sprintf("%s:%v", topo.MachineHost, topo.ServicePort)
+		case dmgrutil.ComponentAlertmanager:
+			cos.AlertmanagerAddrs = append(cos.AlertmanagerAddrs, fmt.Sprintf("%s:%v", topo.MachineHost, topo.ServicePort))
+			cos.AlertmanagerScripts = append(cos.AlertmanagerScripts, &script.AlertManagerScript{
+				IP:          topo.MachineHost,
+				WebPort:     topo.ServicePort,
+				ClusterPort: topo.ClusterPort,
+				DeployDir:   dmgrutil.AbsClusterDeployDir(topo.DeployDir, topo.InstanceName),
+				DataDir:     dmgrutil.AbsClusterDataDir(topo.DeployDir, topo.DataDir, topo.InstanceName),
+				LogDir:      dmgrutil.AbsClusterLogDir(topo.DeployDir, topo.LogDir, topo.InstanceName),
+				TLSEnabled:  clusterMeta.IsTLSEnabled(),
+			})
+		case dmgrutil.ComponentPrometheus:
+			cos.PrometheusAddr = fmt.Sprintf("%s:%v", topo.MachineHost, topo.ServicePort)
+		default:
+			return fmt.Errorf("component [%v] not exist, panic", topo.ComponentName)
 		}
-	}
 
-	if response.FailWithMsg(c, template.GenerateClusterFileWithStage(topoDB,
-		cos,
-		template.ClusterDeployStage,
-		"",
-		"")) {
-		return
-	}
-
-	if response.FailWithMsg(c, template.GenerateClusterFileWithStage(clusterTopo,
-		cos,
-		template.ClusterScaleOutStage,
-		topo.AdminUser,
-		topo.AdminPassword)) {
-		return
-	}
-
-	// 集群已部署存在的组件配置文件以及脚本刷新 refresh
-	refreshFileTasks := CopyClusterFile(topoDB)
-
-	// 扩容组件配置文件以及脚本分发
-	scaleFileTasks := CopyClusterFile(clusterTopo)
-
-	// 扩容集群组件
-	builder := task.NewBuilder().
-		Serial("+ Generate SSH keys",
-			task.NewBuilder().
-				SSHKeyGen(dmgrutil.HomeSshDir, executor.DefaultExecuteTimeout).
-				SSHKeyCopy(dmgrutil.HomeSshDir, dmgrutil.AbsClusterSSHDir(clusterTopo[0].ClusterPath, topo.ClusterName), machineList, executor.DefaultExecuteTimeout, dmgrutil.RsaConcurrency).BuildTask()).
-		Parallel("+ Initialize target host environments", false, envInitTasks...).
-		Parallel("+ Copy components", false, copyCompTasks...).
-		Parallel("+ Refresh files", false, refreshFileTasks...).
-		Parallel("+ Copy files", false, scaleFileTasks...).BuildTask()
+		// 集群已部署存在的组件配置文件以及脚本刷新 refresh
+		refreshFileTasks := CopyClusterFile(topoDB)
+
+		// 扩容组件配置文件以及脚本分发
+		scaleFileTasks := CopyClusterFile(clusterTopo)
+
+		// 启动扩容组件
+		var startTasks []task.Task
+		for _, component := range dmgrutil.StartComponentOrder {
+			for _, t := range clusterTopo {
+				if component == strings.ToLower(t.ComponentName) {
+					startTasks = append(startTasks, task.NewBuilder().
+						SSHKeySet(
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
+						UserSSH(
+							t.MachineHost,
+							t.SshPort,
+							t.ClusterUser,
+							executor.DefaultConnectTimeout,
+							module.DefaultSystemdExecuteTimeout).
+						StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
+							fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
+							module.DefaultSystemdExecuteTimeout).WithRetry(task.DefaultRetryPolicy()).
+						EnableInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
+							fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
+							module.DefaultSystemdExecuteTimeout, true).BuildTask())
+				}
+			}
+		}
 
-	if response.FailWithMsg(c, builder.Execute(ctxt.NewContext())) {
-		return
-	}
+		// 扩容集群组件
+		// 扩容失败，逆序回滚已运行的任务（包含已刷新的集群组件配置文件以及脚本）
+		builder := task.NewBuilder().
+			Func("Generate cluster files", func(ctx *ctxt.Context) error {
+				if err := generateClusterFile(ctx, topoDB,
+					cos,
+					template.ClusterDeployStage,
+					"",
+					""); err != nil {
+					return err
+				}
+				return generateClusterFile(ctx, clusterTopo,
+					cos,
+					template.ClusterScaleOutStage,
+					topo.AdminUser,
+					topo.AdminPassword)
+			}).
+			// 集群开启 TLS 时复用集群 CA 生成扩容实例证书
+			Func("Generate TLS certificates", func(ctx *ctxt.Context) error {
+				return GenerateClusterCert(clusterTopo)
+			}).
+			Serial("+ Generate SSH keys",
+				task.NewBuilder().
+					SSHKeyGen(dmgrutil.HomeSshDir, executor.DefaultExecuteTimeout).
+					SSHKeyCopy(dmgrutil.HomeSshDir, dmgrutil.AbsClusterSSHDir(clusterTopo[0].ClusterPath, topo.ClusterName), machineList, executor.DefaultExecuteTimeout, dmgrutil.RsaConcurrency).BuildTask()).
+			Parallel("+ Initialize target host environments", false, envInitTasks...).
+			Parallel("+ Copy components", false, copyCompTasks...).
+			Parallel("+ Refresh files", false, refreshFileTasks...).
+			Parallel("+ Copy files", false, scaleFileTasks...).
+			Serial("+ Start scale-out instances", startTasks...).
+			RollbackOnFailure().BuildTask()
+
+		if err := builder.Execute(ctx); err != nil {
+			return err
+		}
 
-	// 启动扩容组件
-	for _, component := range dmgrutil.StartComponentOrder {
+		// 更新 grafana 用户密码
+		// 如果存在其他多个 grafana，表记录只记录最后一个 grafana 用户密码，并且缩容 grafana 不会自动更新清理 admin_user、admin_password 字段记录
 		for _, t := range clusterTopo {
-			if component == strings.ToLower(t.ComponentName) {
-				scaleOutCompTask := task.NewBuilder().
+			if strings.ToLower(t.ComponentName) == dmgrutil.ComponentGrafana {
+				clusterName := t.ClusterName
+				if err := task.NewBuilder().Func("Update grafana user", func(ctx *ctxt.Context) error {
+					return s.UpdateGrafanaUserAndPassword(clusterName, req.AdminUser, req.AdminPassword)
+				}).BuildTask().Execute(ctx); err != nil {
+					return err
+				}
+			}
+		}
+
+		// 刷新 prometheus 组件
+		for _, t := range topoDB {
+			if strings.ToLower(t.ComponentName) == dmgrutil.ComponentPrometheus {
+				refreshCompTask := task.NewBuilder().
 					SSHKeySet(
 						filepath.Join(
 							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
@@ -450,62 +587,29 @@ func ClusterScaleOut(c *gin.Context) {
 						t.ClusterUser,
 						executor.DefaultConnectTimeout,
 						module.DefaultSystemdExecuteTimeout).
-					StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
+					StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
 						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
 						module.DefaultSystemdExecuteTimeout).
-					EnableInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
-						module.DefaultSystemdExecuteTimeout, true).BuildTask()
+					StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
+						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort), module.DefaultSystemdExecuteTimeout).WithRetry(task.DefaultRetryPolicy()).BuildTask()
 
-				if response.FailWithMsg(c, scaleOutCompTask.Execute(ctxt.NewContext())) {
-					return
-				}
-
-				// 更新 grafana 用户密码
-				// 如果存在其他多个 grafana，表记录只记录最后一个 grafana 用户密码，并且缩容 grafana 不会自动更新清理 admin_user、admin_password 字段记录
-				switch component {
-				case dmgrutil.ComponentGrafana:
-					if response.FailWithMsg(c, s.UpdateGrafanaUserAndPassword(t.ClusterName, req.AdminUser, req.AdminPassword)) {
-						return
-					}
+				if err := refreshCompTask.Execute(ctx); err != nil {
+					return err
 				}
 			}
 		}
-	}
 
-	// 刷新 prometheus 组件
-	for _, t := range topoDB {
-		if strings.ToLower(t.ComponentName) == dmgrutil.ComponentPrometheus {
-			refreshCompTask := task.NewBuilder().
-				SSHKeySet(
-					filepath.Join(
-						dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
-					filepath.Join(
-						dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
-				UserSSH(
-					t.MachineHost,
-					t.SshPort,
-					t.ClusterUser,
-					executor.DefaultConnectTimeout,
-					module.DefaultSystemdExecuteTimeout).
-				StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-					fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
-					module.DefaultSystemdExecuteTimeout).
-				StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-					fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort), module.DefaultSystemdExecuteTimeout).BuildTask()
-
-			if response.FailWithMsg(c, refreshCompTask.Execute(ctxt.NewContext())) {
-				return
-			}
-		}
+		// 更新集群拓扑
+		return task.NewBuilder().Func("Record cluster topology", func(ctx *ctxt.Context) error {
+			return s.AddClusterTopology([]request.TopologyReqStruct{req.TopologyReqStruct})
+		}).BuildTask().Execute(ctx)
 	}
 
-	// 更新集群拓扑
-	if response.FailWithMsg(c, s.AddClusterTopology([]request.TopologyReqStruct{req.TopologyReqStruct})) {
+	if req.DryRun {
+		PlanClusterOperation(c, topo.ClusterName, dmgrutil.OperationScaleOut, fn)
 		return
 	}
-
-	response.SuccessWithoutData(c)
+	SubmitClusterOperation(c, s, topo.ClusterName, dmgrutil.OperationScaleOut, fn)
 }
 
 // 集群缩容
@@ -554,7 +658,11 @@ func ClusterScaleIn(c *gin.Context) {
 			return
 		}
 	}
-	dmMasterClient := api.NewDMMasterClient(activeDmMasters, api.DmMasterApiTimeout, nil)
+	tlsConfig, err := getClusterTLSConfig(s, req.ClusterName)
+	if response.FailWithMsg(c, err) {
+		return
+	}
+	dmMasterClient := api.NewDMMasterClient(activeDmMasters, api.DmMasterApiTimeout, tlsConfig)
 
 	// 根据集群名、实例名查询集群拓扑
 	clusterTopos, err := s.GetClusterTopologyByInstanceName(req.ClusterName, instNames)
@@ -562,123 +670,142 @@ func ClusterScaleIn(c *gin.Context) {
 		return
 	}
 
-	// 缩容组件
-	// 注意：缩容组件 DestroyInstance 只会清理子目录，不会清理父目录
-	// 比如：deployDir=/data/marvin/{instance_name}, 则清理执行命令 m -rf /data/marvin/{instance_name}，保留 /data/marvin/ 目录，防止误删除
-	for _, component := range dmgrutil.StartComponentOrder {
-		for _, t := range clusterTopos {
-			if component == strings.ToLower(t.ComponentName) {
-				scaleInCompTask := task.NewBuilder().
-					SSHKeySet(
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
-					UserSSH(
-						t.MachineHost,
-						t.SshPort,
-						t.ClusterUser,
-						executor.DefaultConnectTimeout,
-						module.DefaultSystemdExecuteTimeout).
-					StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
-						module.DefaultSystemdExecuteTimeout).
-					DestroyInstance(t.MachineHost, t.ServicePort, t.ComponentName, t.InstanceName, t.DeployDir, t.DataDir, t.LogDir, executor.DefaultExecuteTimeout).BuildTask()
-
-				if response.FailWithMsg(c, scaleInCompTask.Execute(ctxt.NewContext())) {
-					return
-				}
-
-				switch component {
-				case dmgrutil.ComponentDmMaster:
-					err := dmMasterClient.OfflineMaster(t.InstanceName, nil)
-					if response.FailWithMsg(c, err) {
-						return
+	fn := func(ctx *ctxt.Context) error {
+		scaleInWorkers := dmWorkerInstances(clusterTopos)
+
+		// 缩容组件
+		// 注意：缩容组件 DestroyInstance 只会清理子目录，不会清理父目录
+		// 比如：deployDir=/data/marvin/{instance_name}, 则清理执行命令 m -rf /data/marvin/{instance_name}，保留 /data/marvin/ 目录，防止误删除
+		for _, component := range dmgrutil.StartComponentOrder {
+			for _, t := range clusterTopos {
+				if component == strings.ToLower(t.ComponentName) {
+					scaleInCompTask := task.NewBuilder().
+						SSHKeySet(
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
+						UserSSH(
+							t.MachineHost,
+							t.SshPort,
+							t.ClusterUser,
+							executor.DefaultConnectTimeout,
+							module.DefaultSystemdExecuteTimeout)
+					// 缩容 dm-worker 前迁移绑定的数据源
+					if component == dmgrutil.ComponentDmWorker {
+						scaleInCompTask = scaleInCompTask.DrainWorker(activeDmMasters, tlsConfig, t.InstanceName, scaleInWorkers, module.DefaultSystemdExecuteTimeout)
+					}
+					scaleInCompTask = scaleInCompTask.
+						StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
+							fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
+							module.DefaultSystemdExecuteTimeout).
+						DestroyInstance(t.MachineHost, t.ServicePort, t.ComponentName, t.InstanceName, t.DeployDir, t.DataDir, t.LogDir, executor.DefaultExecuteTimeout)
+
+					instanceName := t.InstanceName
+					switch component {
+					case dmgrutil.ComponentDmMaster:
+						scaleInCompTask = scaleInCompTask.Func(fmt.Sprintf("Offline dm-master %s", instanceName), func(ctx *ctxt.Context) error {
+							return dmMasterClient.OfflineMaster(instanceName, nil)
+						})
+					case dmgrutil.ComponentDmWorker:
+						scaleInCompTask = scaleInCompTask.Func(fmt.Sprintf("Offline dm-worker %s", instanceName), func(ctx *ctxt.Context) error {
+							return dmMasterClient.OfflineWorker(instanceName, nil)
+						})
 					}
-				case dmgrutil.ComponentDmWorker:
-					err := dmMasterClient.OfflineWorker(t.InstanceName, nil)
-					if response.FailWithMsg(c, err) {
-						return
+
+					if err := scaleInCompTask.BuildTask().Execute(ctx); err != nil {
+						return err
 					}
 				}
 			}
 		}
-	}
 
-	// 清理元数据表
-	if response.FailWithMsg(c, s.DelClusterTopologyByInstanceName(req.ClusterName, instNames)) {
-		return
-	}
-
-	// 刷新 prometheus 组件
-	if !dmgrutil.IsContainElem(req.ComponentName, dmgrutil.ComponentPrometheus) {
-		// 获取集群拓扑信息
-		topoDB, err := s.GetClusterTopologyByClusterName(req.ClusterName)
-		if response.FailWithMsg(c, err) {
-			return
-		}
-		// 获取扩容集群元信息
-		clusterMeta, err := s.GetClusterMeta(req.ClusterName)
-		if response.FailWithMsg(c, err) {
-			return
-		}
-
-		// 获取生成集群部署配置文件、运行脚本等文件信息【根据元数据库已有集群组件信息】
-		cos := template.GetClusterFile(topoDB)
-
-		// 生成以及 Copy 组件配置文件、运行脚本
-		if response.FailWithMsg(c, template.GenerateClusterFileWithStage(topoDB,
-			cos,
-			template.ClusterScaleOutStage,
-			"",
-			"")) {
-			return
+		// 清理元数据表
+		if err := task.NewBuilder().Func("Delete cluster topology", func(ctx *ctxt.Context) error {
+			return s.DelClusterTopologyByInstanceName(req.ClusterName, instNames)
+		}).BuildTask().Execute(ctx); err != nil {
+			return err
 		}
 
-		// 集群已部署存在的组件配置文件以及脚本刷新 refresh
-		copyFileTasks := CopyClusterFile(topoDB)
-
-		builder := task.NewBuilder().
-			SSHKeySet(
-				filepath.Join(
-					dmgrutil.AbsClusterSSHDir(clusterMeta.ClusterPath, clusterMeta.ClusterName), "id_ed25519"),
-				filepath.Join(
-					dmgrutil.AbsClusterSSHDir(clusterMeta.ClusterPath, clusterMeta.ClusterName), "id_ed25519.pub")).
-			Parallel("+ Copy files", false, copyFileTasks...).BuildTask()
+		// 刷新 prometheus 组件
+		if !dmgrutil.IsContainElem(req.ComponentName, dmgrutil.ComponentPrometheus) {
+			// 获取集群拓扑信息，排除已缩容的实例
+			clusterTopoDB, err := s.GetClusterTopologyByClusterName(req.ClusterName)
+			if err != nil {
+				return err
+			}
+			delInstNames := dmgrutil.NewStringSet(instNames...)
+			var topoDB []response.ClusterTopologyRespStruct
+			for _, t := range clusterTopoDB {
+				if !delInstNames.Exist(t.InstanceName) {
+					topoDB = append(topoDB, t)
+				}
+			}
+			// 获取扩容集群元信息
+			clusterMeta, err := s.GetClusterMeta(req.ClusterName)
+			if err != nil {
+				return err
+			}
 
-		if response.FailWithMsg(c, builder.Execute(ctxt.NewContext())) {
-			return
-		}
+			// 集群已部署存在的组件配置文件以及脚本刷新 refresh
+			copyFileTasks := CopyClusterFile(topoDB)
+
+			builder := task.NewBuilder().
+				// 生成组件配置文件、运行脚本【根据元数据库已有集群组件信息】
+				Func("Generate cluster files", func(ctx *ctxt.Context) error {
+					return generateClusterFile(ctx, topoDB,
+						template.GetClusterFile(topoDB),
+						template.ClusterScaleOutStage,
+						"",
+						"")
+				}).
+				SSHKeySet(
+					filepath.Join(
+						dmgrutil.AbsClusterSSHDir(clusterMeta.ClusterPath, clusterMeta.ClusterName), "id_ed25519"),
+					filepath.Join(
+						dmgrutil.AbsClusterSSHDir(clusterMeta.ClusterPath, clusterMeta.ClusterName), "id_ed25519.pub")).
+				Parallel("+ Copy files", false, copyFileTasks...).BuildTask()
 
-		// 刷新 prometheus 组件
-		for _, t := range topoDB {
-			if strings.ToLower(t.ComponentName) == dmgrutil.ComponentPrometheus {
-				refreshCompTask := task.NewBuilder().
-					SSHKeySet(
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
-					UserSSH(
-						t.MachineHost,
-						t.SshPort,
-						t.ClusterUser,
-						executor.DefaultConnectTimeout,
-						module.DefaultSystemdExecuteTimeout).
-					StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
-						module.DefaultSystemdExecuteTimeout).
-					StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort), module.DefaultSystemdExecuteTimeout).BuildTask()
+			if err := builder.Execute(ctx); err != nil {
+				return err
+			}
 
-				if response.FailWithMsg(c, refreshCompTask.Execute(ctxt.NewContext())) {
-					return
+			// 刷新 prometheus 组件
+			for _, t := range topoDB {
+				if strings.ToLower(t.ComponentName) == dmgrutil.ComponentPrometheus {
+					refreshCompTask := task.NewBuilder().
+						SSHKeySet(
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
+						UserSSH(
+							t.MachineHost,
+							t.SshPort,
+							t.ClusterUser,
+							executor.DefaultConnectTimeout,
+							module.DefaultSystemdExecuteTimeout).
+						StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
+							fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
+							module.DefaultSystemdExecuteTimeout).
+						StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
+							fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort), module.DefaultSystemdExecuteTimeout).WithRetry(task.DefaultRetryPolicy()).BuildTask()
+
+					if err := refreshCompTask.Execute(ctx); err != nil {
+						return err
+					}
 				}
 			}
+
 		}
+		return nil
+	}
 
+	if req.DryRun {
+		PlanClusterOperation(c, req.ClusterName, dmgrutil.OperationScaleIn, fn)
+		return
 	}
-	response.SuccessWithoutData(c)
+	SubmitClusterOperation(c, s, req.ClusterName, dmgrutil.OperationScaleIn, fn)
 }
 
 // 集群滚更
@@ -713,7 +840,7 @@ func CLusterReload(c *gin.Context) {
 	clusterUntarDir := filepath.Join(clusterNameDir, clusterMeta.ClusterVersion)
 	// 目标目录是否存在
 	pkgDir := filepath.Join(clusterUntarDir, dmgrutil.DirPatch)
-	if exist, _ := dmgrutil.PathExists(pkgDir); !exist {
+	if exist, _ := dmgrutil.PathExists(pkgDir); !exist && !req.DryRun {
 		if response.FailWithMsg(c, os.MkdirAll(pkgDir, 0750)) {
 			return
 		}
@@ -754,34 +881,6 @@ func CLusterReload(c *gin.Context) {
 		}
 	}
 
-	// 文件上传
-	filePath := filepath.Join(pkgDir, file.Filename)
-	if response.FailWithMsg(c, c.SaveUploadedFile(file, filePath)) {
-		return
-	}
-
-	// 	本地运行
-	// 文件解压是否覆盖
-	var cmd string
-	if req.Overwrite == dmgrutil.BoolTrue {
-		// 覆盖
-		cmd = fmt.Sprintf(`cp %s %s`, filepath.Join(pkgDir, file.Filename),
-			filepath.Join(clusterUntarDir, dmgrutil.DirConf, file.Filename))
-	}
-	currentUser, currentIP, err := dmgrutil.GetClientOutBoundIP()
-	if response.FailWithMsg(c, err) {
-		return
-	}
-	_, stdErr, err := executor.NewLocalExecutor(currentIP, currentUser, currentUser == "root").Execute(cmd, executor.DefaultExecuteTimeout)
-	if response.FailWithMsg(c, err) {
-		return
-	}
-	if len(stdErr) != 0 {
-		if response.FailWithMsg(c, fmt.Errorf("local host [%v] user [%v] running cmd [%v] failed: %v", currentIP, currentUser, cmd, string(stdErr))) {
-			return
-		}
-	}
-
 	// 判断指定实例名是否在指定组件中 [组件操作以实例名为准，实例名全局唯一]
 	instNames, err := s.FilterComponentInstance(request.ClusterOperatorReqStruct{
 		ClusterName:   req.ClusterName,
@@ -798,48 +897,89 @@ func CLusterReload(c *gin.Context) {
 		return
 	}
 
-	// 启停对应组件
-	for _, component := range dmgrutil.StartComponentOrder {
-		for _, t := range clusterTopos {
-			if component == strings.ToLower(t.ComponentName) {
-				reloadCompTask := task.NewBuilder().
-					SSHKeySet(
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
-					UserSSH(
-						t.MachineHost,
-						t.SshPort,
-						t.ClusterUser,
-						executor.DefaultConnectTimeout,
-						module.DefaultSystemdExecuteTimeout).
-					CopyFile(
-						t.ClusterName,
-						filepath.Join(pkgDir, file.Filename),
-						filepath.Join(dmgrutil.AbsClusterConfDir(t.DeployDir, t.InstanceName), file.Filename),
-						dmgrutil.FileTypeComponent,
-						t.MachineHost,
-						false,
-						0,
-					).
-					StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
-						module.DefaultSystemdExecuteTimeout).
-					StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort), module.DefaultSystemdExecuteTimeout).BuildTask()
-				if response.FailWithMsg(c, reloadCompTask.Execute(ctxt.NewContext())) {
-					return
-				}
+	// 文件上传，dry run 不保存上传文件
+	// 配置文件保存到操作独立的上传目录，集群操作结束后删除
+	uploadDir := filepath.Join(pkgDir, uploadDirPrefix+"*")
+	if !req.DryRun {
+		uploadDir, _, err = saveClusterUpload(c, file, pkgDir, file.Filename)
+		if response.FailWithMsg(c, err) {
+			return
+		}
+	}
+	filePath := filepath.Join(uploadDir, file.Filename)
+
+	fn := func(ctx *ctxt.Context) error {
+		ctx.AddCleanup(func(ctx *ctxt.Context) {
+			removeClusterUpload(uploadDir)
+		})
+
+		// 	本地运行
+		prepareTask := task.NewBuilder().Func("Prepare reload file", func(ctx *ctxt.Context) error {
+			// 文件解压是否覆盖
+			var cmd string
+			if req.Overwrite == dmgrutil.BoolTrue {
+				// 覆盖
+				cmd = fmt.Sprintf(`cp %s %s`, filePath,
+					filepath.Join(clusterUntarDir, dmgrutil.DirConf, file.Filename))
+			}
+			currentUser, currentIP, err := dmgrutil.GetClientOutBoundIP()
+			if err != nil {
+				return err
+			}
+			_, stdErr, err := executor.NewLocalExecutor(currentIP, currentUser, currentUser == "root").Execute(ctx, cmd, false)
+			if err != nil {
+				return err
+			}
+			if len(stdErr) != 0 {
+				return fmt.Errorf("local host [%v] user [%v] running cmd [%v] failed: %v", currentIP, currentUser, cmd, string(stdErr))
+			}
+			return nil
+		}).BuildTask()
+		if err := prepareTask.Execute(ctx); err != nil {
+			return err
+		}
+
+		// 滚动重启对应组件
+		dmMasterAddr, err := getDmMasterAddrs(s, req.ClusterName)
+		if err != nil {
+			return err
+		}
+		tlsConfig, err := getClusterTLSConfig(s, req.ClusterName)
+		if err != nil {
+			return err
+		}
+		for _, t := range RollingRestartOrder(clusterTopos, dmMasterAddr, tlsConfig) {
+			t := t
+			instanceName := t.InstanceName
+			reloadCompTask := RollingRestartInstance(t, dmMasterAddr, tlsConfig, func(b *task.Builder) *task.Builder {
+				return b.CopyFile(
+					t.ClusterName,
+					filePath,
+					filepath.Join(dmgrutil.AbsClusterConfDir(t.DeployDir, t.InstanceName), file.Filename),
+					dmgrutil.FileTypeComponent,
+					t.MachineHost,
+					false,
+					0,
+				).WithRetry(task.DefaultRetryPolicy())
+			}).
 				// 元数据表更新
-				if response.FailWithMsg(c, s.UpdateClusterHotFixStatus(req.ClusterName, t.InstanceName, dmgrutil.ReloadComponent)) {
-					return
-				}
+				Func(fmt.Sprintf("Update instance %s status", instanceName), func(ctx *ctxt.Context) error {
+					return s.UpdateClusterHotFixStatus(req.ClusterName, instanceName, dmgrutil.ReloadComponent)
+				}).BuildTask()
+			if err := reloadCompTask.Execute(ctx); err != nil {
+				return err
 			}
 		}
+		return nil
 	}
 
-	response.SuccessWithoutData(c)
+	if req.DryRun {
+		PlanClusterOperation(c, req.ClusterName, dmgrutil.OperationReload, fn)
+		return
+	}
+	if !SubmitClusterOperation(c, s, req.ClusterName, dmgrutil.OperationReload, fn) {
+		removeClusterUpload(uploadDir)
+	}
 }
 
 // 集群升级
@@ -849,152 +989,159 @@ func ClusterUpgrade(c *gin.Context) {
 		return
 	}
 
-	// 判断对应版本离线安装包是否存在
 	s := service.NewMysqlService()
-	pkg, err := s.ValidClusterVersionPackageIsExist(req.ClusterVersion)
+	fn, err := newClusterUpgradeOperation(s, req)
 	if response.FailWithMsg(c, err) {
 		return
 	}
+	if req.DryRun {
+		PlanClusterOperation(c, req.ClusterName, dmgrutil.OperationUpgrade, fn)
+		return
+	}
+	SubmitResumableClusterOperation(c, s, req.ClusterName, dmgrutil.OperationUpgrade, req, fn)
+}
+
+// 生成集群升级操作，用于集群升级以及断点续做
+func newClusterUpgradeOperation(s *service.MysqlService, req request.ClusterUpgradeReqStruct) (func(ctx *ctxt.Context) error, error) {
+	// 判断对应版本离线安装包是否存在
+	pkg, err := s.ValidClusterVersionPackageIsExist(req.ClusterVersion)
+	if err != nil {
+		return nil, err
+	}
 	if dmgrutil.IsStructureEqual(pkg, response.WarehouseRespStruct{}) {
-		if response.FailWithMsg(c, fmt.Errorf("cluster_version [%v] offline package not exist", req.ClusterVersion)) {
-			return
-		}
+		return nil, fmt.Errorf("cluster_version [%v] offline package not exist", req.ClusterVersion)
 	}
 
 	// 获取集群元信息
 	clusterMeta, err := s.GetClusterMeta(req.ClusterName)
-	if response.FailWithMsg(c, err) {
-		return
+	if err != nil {
+		return nil, err
 	}
-	// 解压离线镜像包到指定目录
-	// {cluster_path}/cluster/{cluster_name}/{cluster_version}
-	clusterNameDir := dmgrutil.AbsClusterUntarDir(clusterMeta.ClusterPath, clusterMeta.ClusterName)
 
-	// 创建新集群版本路径
-	clusterUntarDir := filepath.Join(clusterNameDir, req.ClusterVersion)
-	if response.FailWithMsg(c, dmgrutil.UnCompressTarGz(filepath.Join(pkg.PackagePath, pkg.PackageName), clusterUntarDir)) {
-		return
-	}
+	return func(ctx *ctxt.Context) error {
+		// 解压离线镜像包到指定目录
+		// {cluster_path}/cluster/{cluster_name}/{cluster_version}
+		clusterNameDir := dmgrutil.AbsClusterUntarDir(clusterMeta.ClusterPath, clusterMeta.ClusterName)
 
-	// 集群拓扑查询生成 From 数据库
-	clusterTopoDB, err := s.GetClusterTopologyByClusterName(clusterMeta.ClusterName)
-	if response.FailWithMsg(c, err) {
-		return
-	}
+		// 创建新集群版本路径
+		clusterUntarDir := filepath.Join(clusterNameDir, req.ClusterVersion)
 
-	// 考虑升级，需要把数据库的 cluster_version 替换成当前升级集群版本
-	var clusterTopos []response.ClusterTopologyRespStruct
-	for _, c := range clusterTopoDB {
-		c.ClusterVersion = req.ClusterVersion
-		clusterTopos = append(clusterTopos, c)
-	}
-
-	// 获取生成集群部署配置文件、运行脚本等文件信息
-	cos := template.GetClusterFile(clusterTopos)
+		// 集群拓扑查询生成 From 数据库
+		clusterTopoDB, err := s.GetClusterTopologyByClusterName(clusterMeta.ClusterName)
+		if err != nil {
+			return err
+		}
 
-	// 继承上个版本参数配置文件 dm-master.toml、dm-worker.toml 以及 alertmanager.yml，其他保持默认默认，不影响
-	cmds := []string{
-		fmt.Sprintf(`cp %v %v`,
-			filepath.Join(clusterNameDir, clusterMeta.ClusterVersion, dmgrutil.DirConf, "*.toml"),
-			filepath.Join(clusterNameDir, req.ClusterVersion, dmgrutil.DirConf)),
-		fmt.Sprintf(`cp %v %v`,
-			filepath.Join(clusterNameDir, clusterMeta.ClusterVersion, dmgrutil.DirConf, "alertmanager.yml"),
-			filepath.Join(clusterNameDir, req.ClusterVersion, dmgrutil.DirConf)),
-	}
-	currentUser, currentIP, err := dmgrutil.GetClientOutBoundIP()
-	if response.FailWithMsg(c, err) {
-		return
-	}
-	for _, cmd := range cmds {
-		_, stdErr, err := executor.NewLocalExecutor(currentIP, currentUser, currentUser == "root").Execute(cmd, executor.DefaultExecuteTimeout)
-		if response.FailWithMsg(c, err) {
-			return
+		// 考虑升级，需要把数据库的 cluster_version 替换成当前升级集群版本
+		var clusterTopos []response.ClusterTopologyRespStruct
+		for _, c := range clusterTopoDB {
+			c.ClusterVersion = req.ClusterVersion
+			clusterTopos = append(clusterTopos, c)
 		}
-		if len(stdErr) != 0 {
-			if response.FailWithMsg(c, fmt.Errorf("local host [%v] user [%v] running cmd [%v] failed: %v", currentIP, currentUser, cmd, string(stdErr))) {
-				return
+
+		// 	本地运行
+		// 解压离线镜像包以及生成组件配置文件，断点续做时跳过
+		prepareTask := task.NewBuilder().Func("Prepare upgrade package", func(ctx *ctxt.Context) error {
+			if err := dmgrutil.UnCompressTarGz(filepath.Join(pkg.PackagePath, pkg.PackageName), clusterUntarDir); err != nil {
+				return err
+			}
+			// 记录离线镜像包所有文件 SHA-256，组件分发后校验
+			if err := dmgrutil.GenerateChecksumFile(clusterUntarDir); err != nil {
+				return err
 			}
-		}
-	}
 
-	// 生成以及 Copy 组件配置文件、运行脚本
-	if response.FailWithMsg(c,
-		template.GenerateClusterFileWithStage(
-			clusterTopos,
-			cos,
-			template.ClusterDeployStage,
-			clusterMeta.AdminUser,
-			clusterMeta.AdminPassword)) {
-		return
-	}
-	copyFileTasks := CopyClusterFile(clusterTopos)
-	copyFileTask := task.NewBuilder().
-		SSHKeySet(
-			filepath.Join(
-				dmgrutil.AbsClusterSSHDir(clusterMeta.ClusterPath, clusterMeta.ClusterName), "id_ed25519"),
-			filepath.Join(
-				dmgrutil.AbsClusterSSHDir(clusterMeta.ClusterPath, clusterMeta.ClusterName), "id_ed25519.pub")).
-		Parallel("+ Copy files", false, copyFileTasks...).BuildTask()
+			// 继承上个版本参数配置文件 dm-master.toml、dm-worker.toml 以及 alertmanager.yml，其他保持默认默认，不影响
+			cmds := []string{
+				fmt.Sprintf(`cp %v %v`,
+					filepath.Join(clusterNameDir, clusterMeta.ClusterVersion, dmgrutil.DirConf, "*.toml"),
+					filepath.Join(clusterNameDir, req.ClusterVersion, dmgrutil.DirConf)),
+				fmt.Sprintf(`cp %v %v`,
+					filepath.Join(clusterNameDir, clusterMeta.ClusterVersion, dmgrutil.DirConf, "alertmanager.yml"),
+					filepath.Join(clusterNameDir, req.ClusterVersion, dmgrutil.DirConf)),
+			}
+			currentUser, currentIP, err := dmgrutil.GetClientOutBoundIP()
+			if err != nil {
+				return err
+			}
+			for _, cmd := range cmds {
+				_, stdErr, err := executor.NewLocalExecutor(currentIP, currentUser, currentUser == "root").Execute(ctx, cmd, false)
+				if err != nil {
+					return err
+				}
+				if len(stdErr) != 0 {
+					return fmt.Errorf("local host [%v] user [%v] running cmd [%v] failed: %v", currentIP, currentUser, cmd, string(stdErr))
+				}
+			}
 
-	if response.FailWithMsg(c, copyFileTask.Execute(ctxt.NewContext())) {
-		return
-	}
+			// 生成组件配置文件、运行脚本
+			return generateClusterFile(ctx,
+				clusterTopos,
+				template.GetClusterFile(clusterTopos),
+				template.ClusterDeployStage,
+				clusterMeta.AdminUser,
+				clusterMeta.AdminPassword)
+		}).BuildTask()
+		if err := prepareTask.Execute(ctx); err != nil {
+			return err
+		}
 
-	// 升级对应组件
-	for _, component := range dmgrutil.StartComponentOrder {
-		for _, t := range clusterTopos {
-			if component == strings.ToLower(t.ComponentName) {
-				upgradeCompTask := task.NewBuilder().
-					SSHKeySet(
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
-					UserSSH(
-						t.MachineHost,
-						t.SshPort,
-						t.ClusterUser,
-						executor.DefaultConnectTimeout,
-						module.DefaultSystemdExecuteTimeout).
-					StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
-						module.DefaultSystemdExecuteTimeout)
+		copyFileTasks := CopyClusterFile(clusterTopos)
+		copyFileTask := task.NewBuilder().
+			SSHKeySet(
+				filepath.Join(
+					dmgrutil.AbsClusterSSHDir(clusterMeta.ClusterPath, clusterMeta.ClusterName), "id_ed25519"),
+				filepath.Join(
+					dmgrutil.AbsClusterSSHDir(clusterMeta.ClusterPath, clusterMeta.ClusterName), "id_ed25519.pub")).
+			Parallel("+ Copy files", false, copyFileTasks...).BuildTask()
 
+		if err := copyFileTask.Execute(ctx); err != nil {
+			return err
+		}
+
+		// 滚动升级对应组件
+		dmMasterAddr, err := getDmMasterAddrs(s, clusterMeta.ClusterName)
+		if err != nil {
+			return err
+		}
+		tlsConfig, err := getClusterTLSConfig(s, clusterMeta.ClusterName)
+		if err != nil {
+			return err
+		}
+		for _, t := range RollingRestartOrder(clusterTopos, dmMasterAddr, tlsConfig) {
+			t := t
+			upgradeCompTask := RollingRestartInstance(t, dmMasterAddr, tlsConfig, func(b *task.Builder) *task.Builder {
 				switch strings.ToLower(t.ComponentName) {
 				case dmgrutil.ComponentGrafana:
-					upgradeCompTask = upgradeCompTask.CopyComponent(
+					return b.CopyComponent(
 						t.ClusterName,
 						t.ComponentName,
 						req.ClusterVersion,
 						dmgrutil.AbsClusterGrafanaComponent(t.ClusterPath, t.ClusterName, req.ClusterVersion, dmgrutil.ComponentGrafanaTarPKG),
 						t.MachineHost,
 						fmt.Sprintf("%s/%s", dmgrutil.AbsClusterDeployDir(t.DeployDir, t.InstanceName), dmgrutil.ComponentGrafanaTarPKG),
-					)
+					).WithRetry(task.DefaultRetryPolicy())
 				default:
-					upgradeCompTask = upgradeCompTask.CopyComponent(
+					return b.CopyComponent(
 						t.ClusterName,
 						t.ComponentName,
 						req.ClusterVersion,
 						filepath.Join(clusterUntarDir, dmgrutil.DirBin, strings.ToLower(t.ComponentName)),
 						t.MachineHost,
-						dmgrutil.AbsClusterBinDir(t.DeployDir, t.InstanceName),
-					)
+						filepath.Join(dmgrutil.AbsClusterBinDir(t.DeployDir, t.InstanceName), strings.ToLower(t.ComponentName)),
+					).WithRetry(task.DefaultRetryPolicy())
 				}
-				upgradeCompTask = upgradeCompTask.StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-					fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort), module.DefaultSystemdExecuteTimeout)
+			})
 
-				if response.FailWithMsg(c, upgradeCompTask.BuildTask().Execute(ctxt.NewContext())) {
-					return
-				}
+			if err := upgradeCompTask.BuildTask().Execute(ctx); err != nil {
+				return err
 			}
 		}
-	}
 
-	// 更新元数据集群版本信息
-	if response.FailWithMsg(c, s.UpdateClusterVersion(req.ClusterName, req.ClusterVersion)) {
-		return
-	}
-	response.SuccessWithoutData(c)
+		// 更新元数据集群版本信息
+		return task.NewBuilder().Func("Update cluster version", func(ctx *ctxt.Context) error {
+			return s.UpdateClusterVersion(req.ClusterName, req.ClusterVersion)
+		}).BuildTask().Execute(ctx)
+	}, nil
 }
 
 // 集群补丁
@@ -1025,7 +1172,7 @@ func ClusterPatch(c *gin.Context) {
 	clusterUntarDir := filepath.Join(clusterNameDir, clusterMeta.ClusterVersion)
 	// 目标目录是否存在
 	pkgDir := filepath.Join(clusterUntarDir, dmgrutil.DirPatch)
-	if exist, _ := dmgrutil.PathExists(pkgDir); !exist {
+	if exist, _ := dmgrutil.PathExists(pkgDir); !exist && !req.DryRun {
 		if response.FailWithMsg(c, os.MkdirAll(pkgDir, 0750)) {
 			return
 		}
@@ -1050,112 +1197,197 @@ func ClusterPatch(c *gin.Context) {
 		return
 	}
 
-	// 文件上传
-	filePath := filepath.Join(pkgDir, fmt.Sprintf("%v.tar.gz", req.ComponentName))
-	if response.FailWithMsg(c, c.SaveUploadedFile(file, filePath)) {
+	// 文件上传，dry run 不保存上传文件
+	// 补丁包保存到操作独立的上传目录，补丁完成后删除，失败或取消时保留用于断点续做
+	fileName := fmt.Sprintf("%v.tar.gz", req.ComponentName)
+	uploadDir := filepath.Join(pkgDir, uploadDirPrefix+"*")
+	var checksum string
+	if !req.DryRun {
+		uploadDir, checksum, err = saveClusterUpload(c, file, pkgDir, fileName)
+		if response.FailWithMsg(c, err) {
+			return
+		}
+	}
+
+	params := clusterPatchParams{
+		ClusterName:     req.ClusterName,
+		ComponentName:   req.ComponentName,
+		InstanceName:    instNames,
+		Overwrite:       req.Overwrite,
+		ClusterUntarDir: clusterUntarDir,
+		PkgDir:          uploadDir,
+		FilePath:        filepath.Join(uploadDir, fileName),
+		Checksum:        checksum,
+	}
+	if req.DryRun {
+		PlanClusterOperation(c, req.ClusterName, dmgrutil.OperationPatch, newClusterPatchOperation(s, params))
 		return
 	}
+	if !SubmitResumableClusterOperation(c, s, req.ClusterName, dmgrutil.OperationPatch, params, newClusterPatchOperation(s, params)) {
+		removeClusterUpload(uploadDir)
+	}
+}
+
+// 集群补丁运行参数，用于断点续做
+type clusterPatchParams struct {
+	ClusterName     string   `json:"cluster_name"`
+	ComponentName   string   `json:"component_name"`
+	InstanceName    []string `json:"instance_name"`
+	Overwrite       string   `json:"overwrite"`
+	ClusterUntarDir string   `json:"cluster_untar_dir"`
+	PkgDir          string   `json:"pkg_dir"`
+	FilePath        string   `json:"file_path"`
+	Checksum        string   `json:"checksum"`
+}
+
+// 校验补丁包 SHA-256 与提交时一致，避免断点续做时使用被替换的补丁包
+func (p clusterPatchParams) verifyPackage() error {
+	checksum, err := dmgrutil.SHA256Sum(p.FilePath)
+	if err != nil {
+		return fmt.Errorf("patch package [%s] check failed: %v", p.FilePath, err)
+	}
+	if checksum != p.Checksum {
+		return fmt.Errorf("patch package [%s] sha256 [%s] mismatch, expected [%s]", p.FilePath, checksum, p.Checksum)
+	}
+	return nil
+}
 
-	// 	本地运行
-	// 文件解压是否覆盖
-	var cmds []string
-	if req.Overwrite == dmgrutil.BoolTrue {
-		// 覆盖
-		// 组件是 grafana 组件则不进行解压
-		if strings.ToLower(req.ComponentName) == dmgrutil.ComponentGrafana {
-			cmds = []string{
-				fmt.Sprintf(`cp %s %s`, filepath.Join(pkgDir, dmgrutil.ComponentGrafanaTarPKG),
-					filepath.Join(clusterUntarDir, dmgrutil.DirBin, dmgrutil.ComponentGrafanaTarPKG)),
+// 生成集群补丁操作，用于集群补丁以及断点续做
+func newClusterPatchOperation(s *service.MysqlService, params clusterPatchParams) func(ctx *ctxt.Context) error {
+	return func(ctx *ctxt.Context) error {
+		// 	本地运行
+		// 补丁包本地解压，断点续做时跳过
+		prepareTask := task.NewBuilder().Func("Prepare patch package", func(ctx *ctxt.Context) error {
+			if err := params.verifyPackage(); err != nil {
+				return err
 			}
-		} else {
-			cmds = []string{
-				fmt.Sprintf(`tar --no-same-owner -zxvf %v -C %v; rm -rf %v`, filePath, pkgDir, filePath),
-				fmt.Sprintf(`cp %s %s`, filepath.Join(pkgDir, strings.ToLower(req.ComponentName)), filepath.Join(clusterUntarDir, dmgrutil.DirBin, strings.ToLower(req.ComponentName))),
+			// 文件解压是否覆盖
+			var cmds []string
+			if params.Overwrite == dmgrutil.BoolTrue {
+				// 覆盖
+				// 组件是 grafana 组件则不进行解压
+				if strings.ToLower(params.ComponentName) == dmgrutil.ComponentGrafana {
+					cmds = []string{
+						fmt.Sprintf(`cp %s %s`, filepath.Join(params.PkgDir, dmgrutil.ComponentGrafanaTarPKG),
+							filepath.Join(params.ClusterUntarDir, dmgrutil.DirBin, dmgrutil.ComponentGrafanaTarPKG)),
+					}
+				} else {
+					cmds = []string{
+						fmt.Sprintf(`tar --no-same-owner -zxvf %v -C %v`, params.FilePath, params.PkgDir),
+						fmt.Sprintf(`cp %s %s`, filepath.Join(params.PkgDir, strings.ToLower(params.ComponentName)), filepath.Join(params.ClusterUntarDir, dmgrutil.DirBin, strings.ToLower(params.ComponentName))),
+					}
+				}
+			} else {
+				// 补丁组件非 grafana 组件需要解压
+				if strings.ToLower(params.ComponentName) != dmgrutil.ComponentGrafana {
+					cmds = []string{fmt.Sprintf(`tar --no-same-owner -zxvf %v -C %v`, params.FilePath, params.PkgDir)}
+				}
 			}
-		}
-	} else {
-		// 补丁组件非 grafana 组件需要解压
-		if strings.ToLower(req.ComponentName) != dmgrutil.ComponentGrafana {
-			cmds = []string{fmt.Sprintf(`tar --no-same-owner -zxvf %v -C %v; rm -rf %v`, filePath, pkgDir, filePath)}
-		}
-	}
 
-	for _, cmd := range cmds {
-		currentUser, currentIP, err := dmgrutil.GetClientOutBoundIP()
-		if response.FailWithMsg(c, err) {
-			return
-		}
-		_, stdErr, err := executor.NewLocalExecutor(currentIP, currentUser, currentUser == "root").Execute(cmd, executor.DefaultExecuteTimeout)
-		if response.FailWithMsg(c, err) {
-			return
-		}
-		if len(stdErr) != 0 {
-			if response.FailWithMsg(c, fmt.Errorf("local host [%v] user [%v] running cmd [%v] failed: %v", currentIP, currentUser, cmd, string(stdErr))) {
-				return
+			for _, cmd := range cmds {
+				currentUser, currentIP, err := dmgrutil.GetClientOutBoundIP()
+				if err != nil {
+					return err
+				}
+				_, stdErr, err := executor.NewLocalExecutor(currentIP, currentUser, currentUser == "root").Execute(ctx, cmd, false)
+				if err != nil {
+					return err
+				}
+				if len(stdErr) != 0 {
+					return fmt.Errorf("local host [%v] user [%v] running cmd [%v] failed: %v", currentIP, currentUser, cmd, string(stdErr))
+				}
 			}
+			return nil
+		}).BuildTask()
+		if err := prepareTask.Execute(ctx); err != nil {
+			return err
 		}
-	}
-
-	// 根据集群名、实例名查询集群拓扑
-	clusterTopos, err := s.GetClusterTopologyByInstanceName(req.ClusterName, instNames)
-	if response.FailWithMsg(c, err) {
-		return
-	}
 
-	// 集群组件补丁
-	for _, component := range dmgrutil.StartComponentOrder {
-		for _, t := range clusterTopos {
-			if component == strings.ToLower(t.ComponentName) {
-				patchCompTask := task.NewBuilder().
-					SSHKeySet(
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
-					UserSSH(
-						t.MachineHost,
-						t.SshPort,
-						t.ClusterUser,
-						executor.DefaultConnectTimeout,
-						module.DefaultSystemdExecuteTimeout).
-					StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
-						module.DefaultSystemdExecuteTimeout)
+		// 根据集群名、实例名查询集群拓扑
+		clusterTopos, err := s.GetClusterTopologyByInstanceName(params.ClusterName, params.InstanceName)
+		if err != nil {
+			return err
+		}
 
+		// 集群组件滚动补丁
+		dmMasterAddr, err := getDmMasterAddrs(s, params.ClusterName)
+		if err != nil {
+			return err
+		}
+		tlsConfig, err := getClusterTLSConfig(s, params.ClusterName)
+		if err != nil {
+			return err
+		}
+		for _, t := range RollingRestartOrder(clusterTopos, dmMasterAddr, tlsConfig) {
+			t := t
+			instanceName := t.InstanceName
+			patchCompTask := RollingRestartInstance(t, dmMasterAddr, tlsConfig, func(b *task.Builder) *task.Builder {
 				switch strings.ToLower(t.ComponentName) {
 				case dmgrutil.ComponentGrafana:
-					patchCompTask = patchCompTask.CopyComponent(
+					return b.CopyComponent(
 						t.ClusterName,
 						t.ComponentName,
 						"patched",
-						filepath.Join(pkgDir, dmgrutil.ComponentGrafanaTarPKG),
+						filepath.Join(params.PkgDir, dmgrutil.ComponentGrafanaTarPKG),
 						t.MachineHost,
 						dmgrutil.AbsClusterBinDir(t.DeployDir, t.InstanceName),
 					)
 				default:
-					patchCompTask = patchCompTask.CopyComponent(
+					return b.CopyComponent(
 						t.ClusterName,
 						t.ComponentName,
 						"patched",
-						filepath.Join(pkgDir, t.ComponentName),
+						filepath.Join(params.PkgDir, t.ComponentName),
 						t.MachineHost,
 						filepath.Join(dmgrutil.AbsClusterBinDir(t.DeployDir, t.InstanceName), t.ComponentName),
 					)
 				}
-				patchCompTask = patchCompTask.StartInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-					fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort), module.DefaultSystemdExecuteTimeout)
-
-				if response.FailWithMsg(c, patchCompTask.BuildTask().Execute(ctxt.NewContext())) {
-					return
-				}
+			}).
 				// 元数据表更新
-				if response.FailWithMsg(c, s.UpdateClusterHotFixStatus(req.ClusterName, t.InstanceName, dmgrutil.PatchedComponent)) {
-					return
-				}
+				Func(fmt.Sprintf("Update instance %s status", instanceName), func(ctx *ctxt.Context) error {
+					return s.UpdateClusterHotFixStatus(params.ClusterName, instanceName, dmgrutil.PatchedComponent)
+				})
+
+			if err := patchCompTask.BuildTask().Execute(ctx); err != nil {
+				return err
 			}
 		}
+
+		// 补丁完成后删除上传目录
+		return task.NewBuilder().Func("Clean patch package", func(ctx *ctxt.Context) error {
+			return os.RemoveAll(params.PkgDir)
+		}).BuildTask().Execute(ctx)
+	}
+}
+
+// 上传目录前缀，上传目录位于补丁目录下 {cluster_untar_dir}/patch/upload-*
+const uploadDirPrefix = "upload-"
+
+// 上传文件保存到操作独立的上传目录，避免同一集群的多个请求相互覆盖上传文件
+// 返回上传目录以及上传文件 SHA-256
+func saveClusterUpload(c *gin.Context, file *multipart.FileHeader, pkgDir, fileName string) (string, string, error) {
+	uploadDir, err := os.MkdirTemp(pkgDir, uploadDirPrefix)
+	if err != nil {
+		return "", "", err
+	}
+	filePath := filepath.Join(uploadDir, fileName)
+	if err := c.SaveUploadedFile(file, filePath); err != nil {
+		removeClusterUpload(uploadDir)
+		return "", "", err
+	}
+	checksum, err := dmgrutil.SHA256Sum(filePath)
+	if err != nil {
+		removeClusterUpload(uploadDir)
+		return "", "", err
+	}
+	return uploadDir, checksum, nil
+}
+
+// 删除上传目录，删除失败只记录日志
+func removeClusterUpload(uploadDir string) {
+	if err := os.RemoveAll(uploadDir); err != nil {
+		dmgrutil.Logger.Error("RemoveClusterUpload", zap.String("dir", uploadDir), zap.Error(err))
 	}
-	response.SuccessWithoutData(c)
 }
 
 // 集群状态查询
@@ -1191,41 +1423,47 @@ func ClusterDestroy(c *gin.Context) {
 		return
 	}
 
-	// 清理集群
-	// 注意：清理集群 DestroyInstance 所有组件只会清理子目录，不会清理父目录
-	// 比如：deployDir=/data/marvin/{instance_name}, 则清理执行命令 rm -rf /data/marvin/{instance_name}，保留 /data/marvin/ 目录，防止误删除
-	for _, component := range dmgrutil.StopComponentOrder {
-		for _, t := range clusterTopos {
-			compName := strings.ToLower(t.ComponentName)
-			if component == compName {
-				destroyCompTask := task.NewBuilder().
-					SSHKeySet(
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
-						filepath.Join(
-							dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
-					UserSSH(
-						t.MachineHost,
-						t.SshPort,
-						t.ClusterUser,
-						executor.DefaultConnectTimeout,
-						module.DefaultSystemdExecuteTimeout).
-					StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
-						fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
-						module.DefaultSystemdExecuteTimeout).
-					DestroyInstance(t.MachineHost, t.ServicePort, t.ComponentName, t.InstanceName, t.DeployDir, t.DataDir, t.LogDir, executor.DefaultExecuteTimeout).BuildTask()
-
-				if response.FailWithMsg(c, destroyCompTask.Execute(ctxt.NewContext())) {
-					return
+	fn := func(ctx *ctxt.Context) error {
+		// 清理集群
+		// 注意：清理集群 DestroyInstance 所有组件只会清理子目录，不会清理父目录
+		// 比如：deployDir=/data/marvin/{instance_name}, 则清理执行命令 rm -rf /data/marvin/{instance_name}，保留 /data/marvin/ 目录，防止误删除
+		for _, component := range dmgrutil.StopComponentOrder {
+			for _, t := range clusterTopos {
+				compName := strings.ToLower(t.ComponentName)
+				if component == compName {
+					destroyCompTask := task.NewBuilder().
+						SSHKeySet(
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519"),
+							filepath.Join(
+								dmgrutil.AbsClusterSSHDir(t.ClusterPath, t.ClusterName), "id_ed25519.pub")).
+						UserSSH(
+							t.MachineHost,
+							t.SshPort,
+							t.ClusterUser,
+							executor.DefaultConnectTimeout,
+							module.DefaultSystemdExecuteTimeout).
+						StopInstance(t.MachineHost, t.ServicePort, t.InstanceName, t.LogDir,
+							fmt.Sprintf("%s-%d.service", t.ComponentName, t.ServicePort),
+							module.DefaultSystemdExecuteTimeout).
+						DestroyInstance(t.MachineHost, t.ServicePort, t.ComponentName, t.InstanceName, t.DeployDir, t.DataDir, t.LogDir, executor.DefaultExecuteTimeout).BuildTask()
+
+					if err := destroyCompTask.Execute(ctx); err != nil {
+						return err
+					}
 				}
 			}
 		}
+
+		// 清理元数据信息
+		return task.NewBuilder().Func("Destroy cluster metadata", func(ctx *ctxt.Context) error {
+			return s.DestroyClusterMetaAndTopology(req.ClusterName)
+		}).BuildTask().Execute(ctx)
 	}
 
-	// 清理元数据信息
-	if response.FailWithMsg(c, s.DestroyClusterMetaAndTopology(req.ClusterName)) {
+	if req.DryRun {
+		PlanClusterOperation(c, req.ClusterName, dmgrutil.OperationDestroy, fn)
 		return
 	}
-
-	response.SuccessWithoutData(c)
+	SubmitClusterOperation(c, s, req.ClusterName, dmgrutil.OperationDestroy, fn)
 }
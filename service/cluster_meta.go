@@ -24,12 +24,12 @@ import (
 func (s *MysqlService) GetClusterStatus(clusterStatus string) ([]response.ClusterMetaRespStruct, error) {
 	var cm []response.ClusterMetaRespStruct
 	if clusterStatus == "" {
-		if err := s.Engine.Select(&cm, `SELECT cluster_name,cluster_user,cluster_version,cluster_path,cluster_status,admin_user,admin_password FROM cluster_meta`); err != nil {
+		if err := s.Engine.Select(&cm, `SELECT cluster_name,cluster_user,cluster_version,cluster_path,cluster_status,admin_user,admin_password,tls_enabled FROM cluster_meta`); err != nil {
 			return cm, err
 		}
 		return cm, nil
 	}
-	if err := s.Engine.Select(&cm, `SELECT cluster_name,cluster_user,cluster_version,cluster_path,cluster_status,admin_user,admin_password FROM cluster_meta WHERE cluster_status = ?`, clusterStatus); err != nil {
+	if err := s.Engine.Select(&cm, `SELECT cluster_name,cluster_user,cluster_version,cluster_path,cluster_status,admin_user,admin_password,tls_enabled FROM cluster_meta WHERE cluster_status = ?`, clusterStatus); err != nil {
 		return cm, err
 	}
 	return cm, nil
@@ -58,7 +58,7 @@ func (s *MysqlService) ValidClusterNameIsExist(clusterName string) (bool, error)
 
 func (s *MysqlService) GetClusterMeta(clusterName string) (response.ClusterMetaRespStruct, error) {
 	var cm response.ClusterMetaRespStruct
-	if err := s.Engine.Get(&cm, `SELECT cluster_name,cluster_user,cluster_version,cluster_path,cluster_status,admin_user,admin_password FROM cluster_meta WHERE cluster_name = ?`, clusterName); err != nil {
+	if err := s.Engine.Get(&cm, `SELECT cluster_name,cluster_user,cluster_version,cluster_path,cluster_status,admin_user,admin_password,tls_enabled FROM cluster_meta WHERE cluster_name = ?`, clusterName); err != nil {
 		return cm, err
 	}
 	return cm, nil
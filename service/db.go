@@ -46,12 +46,32 @@ func SyncMysqlEngineDB() error {
 	if _, err := Engine.Exec(TaskTables); err != nil {
 		return errors.Errorf("create task table struct failed, err: %v\n", err)
 	}
+	if err := migrateTableColumns(clusterTableColumns); err != nil {
+		return err
+	}
 	if err := initMysqlEngineData(); err != nil {
 		return err
 	}
 	return nil
 }
 
+// 已存在数据表补充缺少的列，重复运行无影响
+func migrateTableColumns(columns []tableColumn) error {
+	for _, c := range columns {
+		var count int
+		if err := Engine.Get(&count, `SELECT COUNT(1) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`, c.table, c.column); err != nil {
+			return errors.Errorf("query table %s column %s failed, err: %v\n", c.table, c.column, err)
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := Engine.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return errors.Errorf("add table %s column %s failed, err: %v\n", c.table, c.column, err)
+		}
+	}
+	return nil
+}
+
 func initMysqlEngineData() error {
 	// 1. 初始化用户
 	encryptSuperPwd, err := dmgrutil.AesEcryptCode([]byte("admin"))
@@ -62,5 +82,10 @@ func initMysqlEngineData() error {
 	if err := NewMysqlService().initUserTableData("admin", encryptSuperPwd); err != nil {
 		return err
 	}
+
+	// 2. 程序重启，重置未运行结束的集群操作
+	if err := NewMysqlService().FailInterruptedOperation(); err != nil {
+		return fmt.Errorf("falied reset interrupted cluster operation: %v", err)
+	}
 	return nil
 }
@@ -60,6 +60,7 @@ func (s *MysqlService) GetClusterTopologyByClusterName(clusterName string) ([]re
 	meta.cluster_path,
 	meta.admin_user,
 	meta.admin_password,
+	meta.tls_enabled,
 	topo.component_name,
 	topo.instance_name,
 	topo.machine_host,
@@ -69,6 +70,7 @@ func (s *MysqlService) GetClusterTopologyByClusterName(clusterName string) ([]re
 	topo.deploy_dir,
 	topo.data_dir,
 	topo.log_dir,
+	topo.hotfix,
 	mh.ssh_user,
 	mh.ssh_password,
 	mh.ssh_port 
@@ -97,6 +99,7 @@ func (s *MysqlService) GetClusterTopologyByInstanceName(clusterName string, inst
 	meta.cluster_path,
 	meta.admin_user,
 	meta.admin_password,
+	meta.tls_enabled,
 	topo.component_name,
 	topo.instance_name,
 	topo.machine_host,
@@ -120,6 +123,7 @@ WHERE meta.cluster_name = ?`, clusterName)
 	meta.cluster_path,
 	meta.admin_user,
 	meta.admin_password,
+	meta.tls_enabled,
 	topo.component_name,
 	topo.instance_name,
 	topo.machine_host,
@@ -170,14 +174,16 @@ cluster_version,
 cluster_path,
 admin_user,
 admin_password,
-skip_create_user) VALUES (
+skip_create_user,
+tls_enabled) VALUES (
 :cluster_name, 
 :cluster_user, 
 :cluster_version,
 :cluster_path,
 :admin_user,
 :admin_password,
-:skip_create_user)`, clusterMeta); err != nil {
+:skip_create_user,
+:tls_enabled)`, clusterMeta); err != nil {
 			return err
 		}
 
@@ -220,7 +226,6 @@ func Transact(db *sqlx.DB, txFunc func(*sqlx.Tx) error) (err error) {
 			tx.Rollback()
 			// re-throw panic after Rollback
 			panic(p)
-			return
 		} else if err != nil {
 			dmgrutil.Logger.Error("Transaction", zap.String("error", err.Error()))
 			tx.Rollback()
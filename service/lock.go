@@ -0,0 +1,158 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/wentaojin/dmgr/response"
+)
+
+// ClusterLock 已获取的集群排他锁
+type ClusterLock struct {
+	ClusterName string
+	Token       string
+}
+
+// 获取集群排他锁
+// 1、已过期的集群锁直接清理
+// 2、集群锁已被持有时立即返回错误，包含持有者、操作以及过期时间
+func (s *MysqlService) AcquireClusterLock(clusterName, owner, operationType string, ttl time.Duration) (ClusterLock, error) {
+	lock := ClusterLock{ClusterName: clusterName}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return lock, err
+	}
+	lock.Token = hex.EncodeToString(b)
+
+	if _, err := s.Engine.Exec(`DELETE FROM cluster_lock WHERE cluster_name = ? AND expire_time < NOW()`, clusterName); err != nil {
+		return lock, err
+	}
+	res, err := s.Engine.Exec(`INSERT IGNORE INTO cluster_lock (cluster_name, lock_token, owner, operation_type, expire_time) VALUES (?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND))`,
+		clusterName, lock.Token, owner, operationType, int64(ttl.Seconds()))
+	if err != nil {
+		return lock, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return lock, err
+	}
+	if rows == 1 {
+		return lock, nil
+	}
+
+	holder, err := s.GetClusterLock(clusterName)
+	if err == sql.ErrNoRows {
+		return lock, fmt.Errorf("cluster [%s] lock was just released, please retry", clusterName)
+	}
+	if err != nil {
+		return lock, err
+	}
+	return lock, fmt.Errorf("cluster [%s] is locked by user [%s] operation [%s] operation_id [%d] until [%s], please retry later or force release the stale lock",
+		clusterName, holder.Owner, holder.OperationType, holder.OperationID, holder.ExpireTime.Format("2006-01-02 15:04:05"))
+}
+
+// 记录集群锁对应的集群操作 ID
+func (s *MysqlService) SetClusterLockOperation(lock ClusterLock, operationID uint64) error {
+	if _, err := s.Engine.Exec(`UPDATE cluster_lock SET operation_id = ? WHERE cluster_name = ? AND lock_token = ?`,
+		operationID, lock.ClusterName, lock.Token); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 集群锁续期，集群锁已过期被其他操作获取或被强制释放时返回错误
+func (s *MysqlService) RenewClusterLock(lock ClusterLock, ttl time.Duration) error {
+	res, err := s.Engine.Exec(`UPDATE cluster_lock SET expire_time = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE cluster_name = ? AND lock_token = ?`,
+		int64(ttl.Seconds()), lock.ClusterName, lock.Token)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("cluster [%s] lock is lost, expired or force released", lock.ClusterName)
+	}
+	return nil
+}
+
+// 释放集群锁，只释放本次获取的集群锁
+func (s *MysqlService) ReleaseClusterLock(lock ClusterLock) error {
+	if _, err := s.Engine.Exec(`DELETE FROM cluster_lock WHERE cluster_name = ? AND lock_token = ?`,
+		lock.ClusterName, lock.Token); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 强制释放集群锁，用于清理异常残留的集群锁
+func (s *MysqlService) ForceReleaseClusterLock(clusterName string) error {
+	res, err := s.Engine.Exec(`DELETE FROM cluster_lock WHERE cluster_name = ?`, clusterName)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("cluster [%s] isn't locked", clusterName)
+	}
+	return nil
+}
+
+func (s *MysqlService) GetClusterLock(clusterName string) (response.ClusterLockRespStruct, error) {
+	var resp response.ClusterLockRespStruct
+	if err := s.Engine.Get(&resp, `SELECT
+	cluster_name,
+	owner,
+	operation_type,
+	operation_id,
+	expire_time,
+	expire_time < NOW() AS expired,
+	create_time
+FROM
+	cluster_lock WHERE cluster_name = ?`, clusterName); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// 集群锁列表
+func (s *MysqlService) GetClusterLockList() ([]response.ClusterLockRespStruct, error) {
+	var resp []response.ClusterLockRespStruct
+	if err := s.Engine.Select(&resp, `SELECT
+	cluster_name,
+	owner,
+	operation_type,
+	operation_id,
+	expire_time,
+	expire_time < NOW() AS expired,
+	create_time
+FROM
+	cluster_lock
+ORDER BY create_time`); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,299 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package service
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// lockDriver 内存模拟 cluster_lock 表，只支持 lock.go 使用的语句，NOW() 由测试控制
+type lockDriver struct{}
+
+type lockRow struct {
+	clusterName, token, owner, operationType string
+	operationID                              uint64
+	expireTime, createTime                   time.Time
+}
+
+type lockTable struct {
+	mu   sync.Mutex
+	now  time.Time
+	rows map[string]*lockRow
+}
+
+var lockTables = struct {
+	sync.Mutex
+	m map[string]*lockTable
+}{m: make(map[string]*lockTable)}
+
+func init() {
+	sql.Register("fakelock", lockDriver{})
+}
+
+func (lockDriver) Open(name string) (driver.Conn, error) {
+	lockTables.Lock()
+	defer lockTables.Unlock()
+	return &lockConn{table: lockTables.m[name]}, nil
+}
+
+type lockConn struct{ table *lockTable }
+
+func (c *lockConn) Prepare(query string) (driver.Stmt, error) {
+	return &lockStmt{table: c.table, query: strings.Join(strings.Fields(query), " ")}, nil
+}
+func (c *lockConn) Close() error              { return nil }
+func (c *lockConn) Begin() (driver.Tx, error) { return nil, fmt.Errorf("transaction not supported") }
+
+type lockStmt struct {
+	table *lockTable
+	query string
+}
+
+func (s *lockStmt) Close() error  { return nil }
+func (s *lockStmt) NumInput() int { return -1 }
+
+func (s *lockStmt) Exec(args []driver.Value) (driver.Result, error) {
+	t := s.table
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	str := func(i int) string { return args[i].(string) }
+	seconds := func(i int) time.Duration { return time.Duration(args[i].(int64)) * time.Second }
+	owned := func(name, token string) (*lockRow, bool) {
+		r, ok := t.rows[name]
+		return r, ok && r.token == token
+	}
+
+	var affected int64
+	switch {
+	case strings.HasPrefix(s.query, "DELETE FROM cluster_lock WHERE cluster_name = ? AND expire_time < NOW()"):
+		if r, ok := t.rows[str(0)]; ok && r.expireTime.Before(t.now) {
+			delete(t.rows, str(0))
+			affected = 1
+		}
+	case strings.HasPrefix(s.query, "INSERT IGNORE INTO cluster_lock"):
+		if _, ok := t.rows[str(0)]; !ok {
+			t.rows[str(0)] = &lockRow{clusterName: str(0), token: str(1), owner: str(2), operationType: str(3),
+				expireTime: t.now.Add(seconds(4)), createTime: t.now}
+			affected = 1
+		}
+	case strings.HasPrefix(s.query, "UPDATE cluster_lock SET operation_id = ?"):
+		if r, ok := owned(str(1), str(2)); ok {
+			r.operationID = uint64(args[0].(int64))
+			affected = 1
+		}
+	case strings.HasPrefix(s.query, "UPDATE cluster_lock SET expire_time"):
+		if r, ok := owned(str(1), str(2)); ok {
+			r.expireTime = t.now.Add(seconds(0))
+			affected = 1
+		}
+	case strings.HasPrefix(s.query, "DELETE FROM cluster_lock WHERE cluster_name = ? AND lock_token = ?"):
+		if _, ok := owned(str(0), str(1)); ok {
+			delete(t.rows, str(0))
+			affected = 1
+		}
+	case strings.HasPrefix(s.query, "DELETE FROM cluster_lock WHERE cluster_name = ?"):
+		if _, ok := t.rows[str(0)]; ok {
+			delete(t.rows, str(0))
+			affected = 1
+		}
+	default:
+		return nil, fmt.Errorf("unexpected exec: %s", s.query)
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+func (s *lockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	t := s.table
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !strings.HasPrefix(s.query, "SELECT cluster_name, owner, operation_type, operation_id, expire_time, expire_time < NOW() AS expired, create_time FROM cluster_lock") {
+		return nil, fmt.Errorf("unexpected query: %s", s.query)
+	}
+
+	var selected []*lockRow
+	for _, r := range t.rows {
+		if len(args) == 0 || r.clusterName == args[0].(string) {
+			selected = append(selected, r)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].createTime.Before(selected[j].createTime) })
+
+	rows := &lockRows{}
+	for _, r := range selected {
+		rows.values = append(rows.values, []driver.Value{
+			r.clusterName, r.owner, r.operationType, int64(r.operationID), r.expireTime, r.expireTime.Before(t.now), r.createTime,
+		})
+	}
+	return rows, nil
+}
+
+type lockRows struct {
+	values [][]driver.Value
+}
+
+func (r *lockRows) Columns() []string {
+	return []string{"cluster_name", "owner", "operation_type", "operation_id", "expire_time", "expired", "create_time"}
+}
+func (r *lockRows) Close() error { return nil }
+func (r *lockRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func newLockService(t *testing.T) (*MysqlService, *lockTable) {
+	table := &lockTable{now: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), rows: make(map[string]*lockRow)}
+	lockTables.Lock()
+	lockTables.m[t.Name()] = table
+	lockTables.Unlock()
+
+	db, err := sql.Open("fakelock", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &MysqlService{Engine: sqlx.NewDb(db, "mysql")}, table
+}
+
+func (t *lockTable) advance(d time.Duration) {
+	t.mu.Lock()
+	t.now = t.now.Add(d)
+	t.mu.Unlock()
+}
+
+func TestAcquireClusterLockConflict(t *testing.T) {
+	s, _ := newLockService(t)
+
+	lock, err := s.AcquireClusterLock("c1", "admin", "upgrade", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetClusterLockOperation(lock, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.AcquireClusterLock("c1", "ops", "patch", time.Hour)
+	if err == nil {
+		t.Fatal("acquired lock held by another operation")
+	}
+	for _, want := range []string{"user [admin]", "operation [upgrade]", "operation_id [42]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("conflict error %q doesn't contain %q", err, want)
+		}
+	}
+
+	// 不同集群互不影响
+	if _, err := s.AcquireClusterLock("c2", "ops", "patch", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcquireExpiredClusterLock(t *testing.T) {
+	s, table := newLockService(t)
+
+	stale, err := s.AcquireClusterLock("c1", "admin", "upgrade", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.advance(2 * time.Minute)
+
+	locks, err := s.GetClusterLockList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 1 || !locks[0].Expired {
+		t.Fatalf("lock list = %+v, want one expired lock", locks)
+	}
+
+	lock, err := s.AcquireClusterLock("c1", "ops", "patch", time.Hour)
+	if err != nil {
+		t.Fatalf("acquire expired lock: %v", err)
+	}
+	// 过期后被其他操作获取，原持有者续期失败，释放不影响新持有者
+	if err := s.RenewClusterLock(stale, time.Hour); err == nil {
+		t.Fatal("renewed lock acquired by another operation")
+	}
+	if err := s.ReleaseClusterLock(stale); err != nil {
+		t.Fatal(err)
+	}
+	holder, err := s.GetClusterLock("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if holder.Owner != "ops" || holder.Expired {
+		t.Fatalf("holder = %+v, want unexpired lock of ops", holder)
+	}
+	if err := s.RenewClusterLock(lock, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReleaseClusterLockByToken(t *testing.T) {
+	s, _ := newLockService(t)
+
+	lock, err := s.AcquireClusterLock("c1", "admin", "reload", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReleaseClusterLock(ClusterLock{ClusterName: "c1", Token: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetClusterLock("c1"); err != nil {
+		t.Fatalf("lock released by other token: %v", err)
+	}
+
+	if err := s.ReleaseClusterLock(lock); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetClusterLock("c1"); err != sql.ErrNoRows {
+		t.Fatalf("get released lock returned %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.AcquireClusterLock("c1", "ops", "reload", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForceReleaseClusterLock(t *testing.T) {
+	s, _ := newLockService(t)
+
+	lock, err := s.AcquireClusterLock("c1", "admin", "upgrade", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ForceReleaseClusterLock("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RenewClusterLock(lock, time.Hour); err == nil {
+		t.Fatal("renewed force released lock")
+	}
+	if err := s.ForceReleaseClusterLock("c1"); err == nil {
+		t.Fatal("force released unlocked cluster")
+	}
+}
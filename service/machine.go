@@ -16,18 +16,72 @@ limitations under the License.
 package service
 
 import (
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/wentaojin/dmgr/pkg/cluster/module"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
 	"github.com/wentaojin/dmgr/request"
 	"github.com/wentaojin/dmgr/response"
 )
 
+// 机器信息以及已信任的机器、跳板机主机公钥
+const machineQuery = `SELECT
+	m.ssh_host,
+	m.ssh_user,
+	m.ssh_password,
+	m.ssh_port,
+	m.sudo_password,
+	m.proxy_host,
+	m.proxy_port,
+	m.proxy_user,
+	m.proxy_password,
+	m.proxy_key_file,
+	COALESCE(k.fingerprint, '') AS fingerprint,
+	COALESCE(k.public_key, '') AS host_key,
+	COALESCE(pk.fingerprint, '') AS proxy_fingerprint,
+	COALESCE(pk.public_key, '') AS proxy_host_key
+FROM
+    machine m
+	LEFT JOIN machine_host_key k ON k.ssh_host = m.ssh_host AND k.ssh_port = m.ssh_port
+	LEFT JOIN machine_host_key pk ON pk.ssh_host = m.proxy_host AND pk.ssh_port = m.proxy_port`
+
 func (s *MysqlService) AddMachine(machine request.MachineReqStruct) error {
-	if _, err := s.Engine.NamedExec(`INSERT INTO machine (ssh_host, ssh_user, ssh_port, ssh_password) values (:ssh_host, :ssh_user, :ssh_port, :ssh_password)`,
+	if machine.ProxyPort == 0 {
+		machine.ProxyPort = 22
+	}
+	// sudo 密码加密存储
+	sudoPassword := ""
+	if machine.SudoPassword != "" {
+		pwd, err := dmgrutil.AesEcryptCode([]byte(machine.SudoPassword))
+		if err != nil {
+			return fmt.Errorf("sudo password aes encrypt failed: %v", err)
+		}
+		sudoPassword = pwd
+	}
+	// 跳板机密码加密存储
+	proxyPassword := ""
+	if machine.ProxyPassword != "" {
+		pwd, err := dmgrutil.AesEcryptCode([]byte(machine.ProxyPassword))
+		if err != nil {
+			return fmt.Errorf("proxy password aes encrypt failed: %v", err)
+		}
+		proxyPassword = pwd
+	}
+	if _, err := s.Engine.NamedExec(`INSERT INTO machine (ssh_host, ssh_user, ssh_port, ssh_password, sudo_password, proxy_host, proxy_port, proxy_user, proxy_password, proxy_key_file) values (:ssh_host, :ssh_user, :ssh_port, :ssh_password, :sudo_password, :proxy_host, :proxy_port, :proxy_user, :proxy_password, :proxy_key_file)`,
 		map[string]interface{}{
-			"ssh_host":     machine.SshHost,
-			"ssh_user":     machine.SshUser,
-			"ssh_port":     machine.SshPort,
-			"ssh_password": machine.SshPassword,
+			"ssh_host":       machine.SshHost,
+			"ssh_user":       machine.SshUser,
+			"ssh_port":       machine.SshPort,
+			"ssh_password":   machine.SshPassword,
+			"sudo_password":  sudoPassword,
+			"proxy_host":     machine.ProxyHost,
+			"proxy_port":     machine.ProxyPort,
+			"proxy_user":     machine.ProxyUser,
+			"proxy_password": proxyPassword,
+			"proxy_key_file": machine.ProxyKeyFile,
 		}); err != nil {
 		return err
 	}
@@ -36,13 +90,7 @@ func (s *MysqlService) AddMachine(machine request.MachineReqStruct) error {
 
 func (s *MysqlService) GetMachineList(machineHosts []string) ([]response.MachineRespStruct, error) {
 	var machineList []response.MachineRespStruct
-	query, args, err := sqlx.In(`SELECT
-	ssh_host,
-	ssh_user,
-	ssh_password,
-	ssh_port 
-FROM
-    machine WHERE ssh_host IN (?)`, machineHosts)
+	query, args, err := sqlx.In(machineQuery+` WHERE m.ssh_host IN (?)`, machineHosts)
 	if err != nil {
 		return machineList, err
 	}
@@ -50,5 +98,174 @@ FROM
 	if err := s.Engine.Select(&machineList, query, args...); err != nil {
 		return machineList, err
 	}
-	return machineList, nil
+	return machineList, decryptMachinePassword(machineList)
+}
+
+func (s *MysqlService) GetMachine(sshHost string, sshPort uint64) (response.MachineRespStruct, error) {
+	var machine response.MachineRespStruct
+	if err := s.Engine.Get(&machine, machineQuery+` WHERE m.ssh_host = ? AND m.ssh_port = ?`, sshHost, sshPort); err != nil {
+		return machine, err
+	}
+	machines := []response.MachineRespStruct{machine}
+	if err := decryptMachinePassword(machines); err != nil {
+		return machine, err
+	}
+	return machines[0], nil
+}
+
+// 配置 SSH 跳板机的机器列表
+func (s *MysqlService) GetProxyMachineList() ([]response.MachineRespStruct, error) {
+	var machineList []response.MachineRespStruct
+	if err := s.Engine.Select(&machineList, machineQuery+` WHERE m.proxy_host <> ''`); err != nil {
+		return machineList, err
+	}
+	return machineList, decryptMachinePassword(machineList)
+}
+
+// 未记录机器或跳板机主机公钥的机器列表，如主机公钥校验前新增的机器
+func (s *MysqlService) GetUntrustedMachineList() ([]response.MachineRespStruct, error) {
+	var machineList []response.MachineRespStruct
+	if err := s.Engine.Select(&machineList, machineQuery+` WHERE k.ssh_host IS NULL OR (m.proxy_host <> '' AND pk.ssh_host IS NULL)`); err != nil {
+		return machineList, err
+	}
+	return machineList, decryptMachinePassword(machineList)
+}
+
+// 解密机器 sudo 密码以及跳板机密码
+func decryptMachinePassword(machineList []response.MachineRespStruct) error {
+	for i := range machineList {
+		if machineList[i].SudoPassword != "" {
+			pwd, err := dmgrutil.AesDeCryptCode(machineList[i].SudoPassword)
+			if err != nil {
+				return fmt.Errorf("machine [%s] sudo password aes decrypt failed: %v", machineList[i].SshHost, err)
+			}
+			machineList[i].SudoPassword = string(pwd)
+		}
+		if machineList[i].ProxyPassword != "" {
+			pwd, err := dmgrutil.AesDeCryptCode(machineList[i].ProxyPassword)
+			if err != nil {
+				return fmt.Errorf("machine [%s] proxy password aes decrypt failed: %v", machineList[i].SshHost, err)
+			}
+			machineList[i].ProxyPassword = string(pwd)
+		}
+	}
+	return nil
+}
+
+// 首次记录主机公钥，已信任的主机公钥保持不变
+func (s *MysqlService) AddHostKey(hostKey response.HostKeyRespStruct) error {
+	if _, err := s.Engine.Exec(`INSERT IGNORE INTO machine_host_key (ssh_host, ssh_port, key_type, fingerprint, public_key) VALUES (?, ?, ?, ?, ?)`,
+		hostKey.SshHost, hostKey.SshPort, hostKey.KeyType, hostKey.Fingerprint, hostKey.PublicKey); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 重新信任主机公钥，覆盖已记录的主机公钥
+func (s *MysqlService) ReplaceHostKey(hostKey response.HostKeyRespStruct) error {
+	if _, err := s.Engine.Exec(`INSERT INTO machine_host_key (ssh_host, ssh_port, key_type, fingerprint, public_key) VALUES (?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE key_type = VALUES(key_type), fingerprint = VALUES(fingerprint), public_key = VALUES(public_key)`,
+		hostKey.SshHost, hostKey.SshPort, hostKey.KeyType, hostKey.Fingerprint, hostKey.PublicKey); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *MysqlService) GetHostKey(sshHost string, sshPort uint64) (response.HostKeyRespStruct, error) {
+	var hostKey response.HostKeyRespStruct
+	if err := s.Engine.Get(&hostKey, `SELECT ssh_host, ssh_port, key_type, fingerprint, public_key, update_time FROM machine_host_key WHERE ssh_host = ? AND ssh_port = ?`,
+		sshHost, sshPort); err != nil {
+		return hostKey, err
+	}
+	return hostKey, nil
+}
+
+func (s *MysqlService) GetHostKeyList() ([]response.HostKeyRespStruct, error) {
+	var hostKeys []response.HostKeyRespStruct
+	if err := s.Engine.Select(&hostKeys, `SELECT ssh_host, ssh_port, key_type, fingerprint, public_key, update_time FROM machine_host_key`); err != nil {
+		return hostKeys, err
+	}
+	return hostKeys, nil
+}
+
+// 机器主机信息，文件系统以及监听端口以 JSON 数组存储
+type machineFactsRow struct {
+	SshHost        string    `db:"ssh_host"`
+	SshPort        uint64    `db:"ssh_port"`
+	OS             string    `db:"os"`
+	Kernel         string    `db:"kernel"`
+	Arch           string    `db:"arch"`
+	CPUCores       int       `db:"cpu_cores"`
+	MemoryTotal    uint64    `db:"memory_total"`
+	Filesystems    string    `db:"filesystems"`
+	ListenPorts    string    `db:"listen_ports"`
+	SystemdVersion string    `db:"systemd_version"`
+	TimeSync       string    `db:"time_sync"`
+	UpdateTime     time.Time `db:"update_time"`
+}
+
+const machineFactsQuery = `SELECT ssh_host, ssh_port, os, kernel, arch, cpu_cores, memory_total, COALESCE(filesystems, '[]') AS filesystems, COALESCE(listen_ports, '[]') AS listen_ports, systemd_version, time_sync, update_time FROM machine_facts`
+
+// 记录机器主机信息，覆盖上次采集的主机信息
+func (s *MysqlService) ReplaceMachineFacts(facts response.MachineFactsRespStruct) error {
+	filesystems, err := json.Marshal(facts.Filesystems)
+	if err != nil {
+		return err
+	}
+	listenPorts, err := json.Marshal(facts.ListenPorts)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Engine.Exec(`INSERT INTO machine_facts (ssh_host, ssh_port, os, kernel, arch, cpu_cores, memory_total, filesystems, listen_ports, systemd_version, time_sync) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE os = VALUES(os), kernel = VALUES(kernel), arch = VALUES(arch), cpu_cores = VALUES(cpu_cores), memory_total = VALUES(memory_total), filesystems = VALUES(filesystems), listen_ports = VALUES(listen_ports), systemd_version = VALUES(systemd_version), time_sync = VALUES(time_sync), update_time = CURRENT_TIMESTAMP`,
+		facts.SshHost, facts.SshPort, facts.OS, facts.Kernel, facts.Arch, facts.CPUCores, facts.MemoryTotal, string(filesystems), string(listenPorts), facts.SystemdVersion, facts.TimeSync); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 查询机器主机信息，machineHosts 为空查询所有机器
+func (s *MysqlService) GetMachineFactsList(machineHosts []string) ([]response.MachineFactsRespStruct, error) {
+	var (
+		rows []machineFactsRow
+		err  error
+	)
+	if len(machineHosts) == 0 {
+		err = s.Engine.Select(&rows, machineFactsQuery)
+	} else {
+		query, args, errIn := sqlx.In(machineFactsQuery+` WHERE ssh_host IN (?)`, machineHosts)
+		if errIn != nil {
+			return nil, errIn
+		}
+		err = s.Engine.Select(&rows, s.Engine.Rebind(query), args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	factsList := make([]response.MachineFactsRespStruct, 0, len(rows))
+	for _, r := range rows {
+		facts := response.MachineFactsRespStruct{
+			SshHost: r.SshHost,
+			SshPort: r.SshPort,
+			HostFacts: module.HostFacts{
+				OS:             r.OS,
+				Kernel:         r.Kernel,
+				Arch:           r.Arch,
+				CPUCores:       r.CPUCores,
+				MemoryTotal:    r.MemoryTotal,
+				SystemdVersion: r.SystemdVersion,
+				TimeSync:       r.TimeSync,
+			},
+			UpdateTime: r.UpdateTime,
+		}
+		if err := json.Unmarshal([]byte(r.Filesystems), &facts.Filesystems); err != nil {
+			return nil, fmt.Errorf("machine [%s] facts filesystems unmarshal failed: %v", r.SshHost, err)
+		}
+		if err := json.Unmarshal([]byte(r.ListenPorts), &facts.ListenPorts); err != nil {
+			return nil, fmt.Errorf("machine [%s] facts listen ports unmarshal failed: %v", r.SshHost, err)
+		}
+		factsList = append(factsList, facts)
+	}
+	return factsList, nil
 }
@@ -0,0 +1,196 @@
+/*
+Copyright © 2020 Marvin
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package service
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/wentaojin/dmgr/pkg/cluster/ctxt"
+	"github.com/wentaojin/dmgr/pkg/dmgrutil"
+	"github.com/wentaojin/dmgr/request"
+	"github.com/wentaojin/dmgr/response"
+)
+
+// 新增集群操作，状态 queued，requestBody 为断点续做所需的操作请求参数
+func (s *MysqlService) AddOperation(clusterName, operationType, requestBody string) (uint64, error) {
+	res, err := s.Engine.Exec(`INSERT INTO operation (cluster_name, operation_type, operation_status, request_body) VALUES (?, ?, ?, ?)`,
+		clusterName, operationType, dmgrutil.OperationQueuedStatus, requestBody)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(id), nil
+}
+
+// 集群操作断点续做，重置为 queued 状态，保留已完成的步骤检查点
+func (s *MysqlService) ResumeOperation(operationID uint64) error {
+	if _, err := s.Engine.Exec(`UPDATE operation SET operation_status = ?, error_msg = NULL, start_time = NULL, end_time = NULL WHERE id = ?`,
+		dmgrutil.OperationQueuedStatus, operationID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 集群操作开始运行
+func (s *MysqlService) StartOperation(operationID uint64) error {
+	if _, err := s.Engine.Exec(`UPDATE operation SET operation_status = ?, start_time = NOW() WHERE id = ?`,
+		dmgrutil.OperationRunningStatus, operationID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 集群操作运行结束，记录结束状态以及错误信息
+func (s *MysqlService) FinishOperation(operationID uint64, operationStatus, errMsg string) error {
+	if _, err := s.Engine.Exec(`UPDATE operation SET operation_status = ?, error_msg = ?, end_time = NOW() WHERE id = ?`,
+		operationStatus, errMsg, operationID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 记录集群操作步骤重试
+func (s *MysqlService) AddOperationRetry(operationID uint64, retryMsg string) error {
+	if _, err := s.Engine.Exec(`UPDATE operation SET retry_msg = CONCAT_WS('\n', retry_msg, ?) WHERE id = ?`,
+		retryMsg, operationID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 记录集群操作远程命令执行
+func (s *MysqlService) AddOperationCommand(operationID uint64, rec ctxt.CommandRecord) error {
+	if _, err := s.Engine.Exec(`INSERT INTO operation_command (operation_id, host, command, sudo, exit_code, duration_ms, stdout, stderr, error_msg) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		operationID, rec.Host, rec.Command, rec.Sudo, rec.ExitCode, rec.Duration.Milliseconds(), rec.Stdout, rec.Stderr, rec.ErrorMsg); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 集群操作远程命令执行记录，按执行顺序
+func (s *MysqlService) GetOperationCommands(req request.OperationCommandReqStruct) ([]response.OperationCommandRespStruct, error) {
+	var resp []response.OperationCommandRespStruct
+	if err := s.Engine.Select(&resp, `SELECT
+	id,
+	operation_id,
+	host,
+	COALESCE(command, '') AS command,
+	sudo,
+	exit_code,
+	duration_ms,
+	COALESCE(stdout, '') AS stdout,
+	COALESCE(stderr, '') AS stderr,
+	COALESCE(error_msg, '') AS error_msg,
+	create_time
+FROM
+	operation_command
+WHERE operation_id = ?
+	AND (? = '' OR host = ?)
+ORDER BY id`, req.OperationID, req.Host, req.Host); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// 程序重启后，未运行结束的集群操作标记失败，同时释放这些操作持有的集群锁
+func (s *MysqlService) FailInterruptedOperation() error {
+	return Transact(s.Engine, func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec(`DELETE l FROM cluster_lock l JOIN operation o ON o.id = l.operation_id WHERE o.operation_status IN (?, ?)`,
+			dmgrutil.OperationQueuedStatus,
+			dmgrutil.OperationRunningStatus); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE operation SET operation_status = ?, error_msg = ?, end_time = NOW() WHERE operation_status IN (?, ?)`,
+			dmgrutil.OperationFailedStatus,
+			"operation interrupted by dmgr restart",
+			dmgrutil.OperationQueuedStatus,
+			dmgrutil.OperationRunningStatus); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *MysqlService) GetOperation(operationID uint64) (response.OperationRespStruct, error) {
+	var resp response.OperationRespStruct
+	if err := s.Engine.Get(&resp, `SELECT
+	id,
+	cluster_name,
+	operation_type,
+	operation_status,
+	COALESCE(error_msg, '') AS error_msg,
+	COALESCE(retry_msg, '') AS retry_msg,
+	start_time,
+	end_time,
+	create_time
+FROM
+	operation WHERE id = ?`, operationID); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// 集群操作列表，可按集群名以及操作状态过滤
+func (s *MysqlService) GetOperationList(req request.OperationListReqStruct) ([]response.OperationRespStruct, error) {
+	var resp []response.OperationRespStruct
+	if err := s.Engine.Select(&resp, `SELECT
+	id,
+	cluster_name,
+	operation_type,
+	operation_status,
+	COALESCE(error_msg, '') AS error_msg,
+	COALESCE(retry_msg, '') AS retry_msg,
+	start_time,
+	end_time,
+	create_time
+FROM
+	operation
+WHERE (? = '' OR cluster_name = ?)
+	AND (? = '' OR operation_status = ?)
+ORDER BY id DESC`, req.ClusterName, req.ClusterName, req.OperationStatus, req.OperationStatus); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// 集群操作请求参数
+func (s *MysqlService) GetOperationRequest(operationID uint64) (string, error) {
+	var requestBody string
+	if err := s.Engine.Get(&requestBody, `SELECT COALESCE(request_body, '') FROM operation WHERE id = ?`, operationID); err != nil {
+		return requestBody, err
+	}
+	return requestBody, nil
+}
+
+// 记录集群操作步骤完成
+func (s *MysqlService) AddOperationStep(operationID uint64, stepKey, stepName string) error {
+	if _, err := s.Engine.Exec(`INSERT IGNORE INTO operation_step (operation_id, step_key, step_name) VALUES (?, ?, ?)`,
+		operationID, stepKey, stepName); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 集群操作已完成的步骤
+func (s *MysqlService) GetOperationSteps(operationID uint64) ([]string, error) {
+	var stepKeys []string
+	if err := s.Engine.Select(&stepKeys, `SELECT step_key FROM operation_step WHERE operation_id = ?`, operationID); err != nil {
+		return stepKeys, err
+	}
+	return stepKeys, nil
+}
@@ -257,6 +257,12 @@ ssh_host varchar(255) NOT NULL COMMENT 'SSH 主机',
 ssh_user varchar(30) NOT NULL COMMENT 'SSH 用户',
 ssh_password varchar(255) NOT NULL COMMENT 'SSH密码',
 ssh_port int NOT NULL COMMENT 'SSH 端口',
+sudo_password varchar(512) NOT NULL DEFAULT '' COMMENT 'SSH 用户 sudo 密码（AES 加密），空表示免密 sudo',
+proxy_host varchar(255) NOT NULL DEFAULT '' COMMENT 'SSH 跳板机，空表示直连',
+proxy_port int NOT NULL DEFAULT 22 COMMENT 'SSH 跳板机端口',
+proxy_user varchar(30) NOT NULL DEFAULT '' COMMENT 'SSH 跳板机用户',
+proxy_password varchar(512) NOT NULL DEFAULT '' COMMENT 'SSH 跳板机密码（AES 加密）',
+proxy_key_file varchar(255) NOT NULL DEFAULT '' COMMENT 'SSH 跳板机私钥文件，优先使用私钥认证',
 create_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
 update_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
 PRIMARY KEY (id) ,
@@ -266,6 +272,40 @@ ENGINE = InnoDB
 DEFAULT CHARACTER SET = utf8mb4
 COMMENT = '机器列表';
 
+CREATE TABLE IF NOT EXISTS machine_host_key (
+ssh_host varchar(255) NOT NULL COMMENT 'SSH 主机',
+ssh_port int NOT NULL COMMENT 'SSH 端口',
+key_type varchar(64) NOT NULL COMMENT '主机公钥类型',
+fingerprint varchar(128) NOT NULL COMMENT '主机公钥指纹 SHA256',
+public_key text NOT NULL COMMENT '主机公钥，authorized_keys 格式',
+create_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+update_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+PRIMARY KEY (ssh_host, ssh_port)
+)
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8mb4
+COMMENT = '机器以及跳板机已信任的 SSH 主机公钥';
+
+CREATE TABLE IF NOT EXISTS machine_facts (
+ssh_host varchar(255) NOT NULL COMMENT 'SSH 主机',
+ssh_port int NOT NULL COMMENT 'SSH 端口',
+os varchar(255) NOT NULL DEFAULT '' COMMENT '操作系统发行版',
+kernel varchar(255) NOT NULL DEFAULT '' COMMENT '内核版本',
+arch varchar(30) NOT NULL DEFAULT '' COMMENT 'CPU 架构',
+cpu_cores int NOT NULL DEFAULT 0 COMMENT 'CPU 逻辑核数',
+memory_total bigint NOT NULL DEFAULT 0 COMMENT '内存总量，单位：字节',
+filesystems text COMMENT '已挂载文件系统以及可用空间，JSON 数组',
+listen_ports text COMMENT '已监听的 TCP 端口，JSON 数组',
+systemd_version varchar(30) NOT NULL DEFAULT '' COMMENT 'systemd 版本',
+time_sync varchar(30) NOT NULL DEFAULT '' COMMENT '时间同步状态 yes、no、unknown',
+create_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+update_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '采集时间',
+PRIMARY KEY (ssh_host, ssh_port)
+)
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8mb4
+COMMENT = '机器主机信息';
+
 CREATE TABLE IF NOT EXISTS warehouse (
 id bigint NOT NULL AUTO_INCREMENT COMMENT '元数据 ID',
 cluster_version varchar(30) NOT NULL COMMENT '集群版本',
@@ -292,6 +332,7 @@ cluster_status varchar(10) NOT NULL DEFAULT 'Offline' COMMENT '集群状态是
 admin_user  varchar(255) NOT NULL COMMENT 'grafana 用户名',
 admin_password  varchar(255) NOT NULL COMMENT 'grafana 用户密码',
 skip_create_user varchar(30) NOT NULL DEFAULT 'false' COMMENT '是否创建集群用户名, false 不跳过; true 跳过',
+tls_enabled varchar(30) NOT NULL DEFAULT 'false' COMMENT '集群组件间是否开启 TLS, false 不开启; true 开启',
 create_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
 update_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
 PRIMARY KEY (id) ,
@@ -327,5 +368,97 @@ INDEX idx_machine_host (machine_host)
 ENGINE = InnoDB
 DEFAULT CHARACTER SET = utf8mb4
 COLLATE = utf8mb4_bin
-COMMENT = '集群部署拓扑列表';`
+COMMENT = '集群部署拓扑列表';
+
+CREATE TABLE IF NOT EXISTS operation (
+id bigint NOT NULL AUTO_INCREMENT COMMENT '操作 ID',
+cluster_name varchar(255) NOT NULL COMMENT '集群名',
+operation_type varchar(30) NOT NULL COMMENT '操作类型 deploy/start/stop/restart/scale-out/scale-in/reload/upgrade/patch/destroy',
+operation_status varchar(30) NOT NULL DEFAULT 'queued' COMMENT '操作状态 queued 排队; running 运行; succeeded 成功; failed 失败; canceled 取消',
+error_msg text COMMENT '操作失败错误信息',
+retry_msg text COMMENT '步骤重试记录',
+request_body longtext COMMENT '操作请求参数，用于断点续做',
+start_time datetime COMMENT '操作开始时间',
+end_time datetime COMMENT '操作结束时间',
+create_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+update_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+PRIMARY KEY (id) ,
+INDEX idx_cluster_name (cluster_name),
+INDEX idx_operation_status (operation_status)
 )
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8mb4
+COLLATE = utf8mb4_bin
+COMMENT = '集群操作列表';
+
+CREATE TABLE IF NOT EXISTS operation_step (
+id bigint NOT NULL AUTO_INCREMENT COMMENT '自增编号',
+operation_id bigint NOT NULL COMMENT '操作 ID',
+step_key varchar(64) NOT NULL COMMENT '步骤标识 sha256',
+step_name text COMMENT '步骤名',
+create_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '步骤完成时间',
+PRIMARY KEY (id) ,
+UNIQUE INDEX idx_operation_step (operation_id,step_key)
+)
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8mb4
+COLLATE = utf8mb4_bin
+COMMENT = '集群操作步骤检查点';
+
+CREATE TABLE IF NOT EXISTS operation_command (
+id bigint NOT NULL AUTO_INCREMENT COMMENT '自增编号',
+operation_id bigint NOT NULL COMMENT '操作 ID',
+host varchar(255) NOT NULL COMMENT '主机 IP',
+command text COMMENT '执行命令，密码等敏感信息已脱敏',
+sudo tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否 sudo 执行',
+exit_code int NOT NULL DEFAULT 0 COMMENT '退出码，-1 表示未获取到退出码',
+duration_ms bigint NOT NULL DEFAULT 0 COMMENT '执行耗时，单位毫秒',
+stdout mediumtext COMMENT '标准输出',
+stderr mediumtext COMMENT '标准错误输出',
+error_msg text COMMENT '执行失败错误信息',
+create_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '执行完成时间',
+PRIMARY KEY (id) ,
+INDEX idx_operation_host (operation_id,host)
+)
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8mb4
+COLLATE = utf8mb4_bin
+COMMENT = '集群操作远程命令执行记录';
+
+CREATE TABLE IF NOT EXISTS cluster_lock (
+cluster_name varchar(255) NOT NULL COMMENT '集群名',
+lock_token varchar(64) NOT NULL COMMENT '锁标识，用于持有者释放',
+owner varchar(255) NOT NULL COMMENT '持有用户',
+operation_type varchar(30) NOT NULL COMMENT '操作类型',
+operation_id bigint NOT NULL DEFAULT 0 COMMENT '集群操作 ID，同步运行的操作为 0',
+expire_time datetime NOT NULL COMMENT '过期时间，过期后可被其他操作获取',
+create_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+update_time datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+PRIMARY KEY (cluster_name)
+)
+ENGINE = InnoDB
+DEFAULT CHARACTER SET = utf8mb4
+COLLATE = utf8mb4_bin
+COMMENT = '集群排他锁';`
+)
+
+// 已存在数据表新增列，CREATE TABLE IF NOT EXISTS 不修改已存在的数据表，程序启动时按顺序补充缺少的列
+// 列定义与建表语句保持一致
+type tableColumn struct {
+	table      string
+	column     string
+	definition string
+}
+
+var clusterTableColumns = []tableColumn{
+	// SSH 跳板机
+	{"machine", "proxy_host", "varchar(255) NOT NULL DEFAULT '' COMMENT 'SSH 跳板机，空表示直连' AFTER ssh_port"},
+	{"machine", "proxy_port", "int NOT NULL DEFAULT 22 COMMENT 'SSH 跳板机端口' AFTER proxy_host"},
+	{"machine", "proxy_user", "varchar(30) NOT NULL DEFAULT '' COMMENT 'SSH 跳板机用户' AFTER proxy_port"},
+	{"machine", "proxy_password", "varchar(512) NOT NULL DEFAULT '' COMMENT 'SSH 跳板机密码（AES 加密）' AFTER proxy_user"},
+	{"machine", "proxy_key_file", "varchar(255) NOT NULL DEFAULT '' COMMENT 'SSH 跳板机私钥文件，优先使用私钥认证' AFTER proxy_password"},
+	// SSH 用户 sudo 密码
+	{"machine", "sudo_password", "varchar(512) NOT NULL DEFAULT '' COMMENT 'SSH 用户 sudo 密码（AES 加密），空表示免密 sudo' AFTER ssh_port"},
+	// 集群组件间 TLS
+	{"cluster_meta", "tls_enabled", "varchar(30) NOT NULL DEFAULT 'false' COMMENT '集群组件间是否开启 TLS, false 不开启; true 开启' AFTER skip_create_user"},
+}